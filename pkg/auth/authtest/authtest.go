@@ -0,0 +1,119 @@
+// Package authtest checks that the routes of an API require the roles they
+// should.  It provides an API key for each role, and a goconvey test that
+// requests every route with each of them.
+package authtest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raintank/raintank-apps/pkg/auth"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	// AdminKey should be used as the admin key of the API under test.
+	AdminKey = "changeme"
+	// OrgId is the org of the users of Keys.
+	OrgId = 10
+)
+
+// Keys are the API keys of a user with each role in OrgId.
+var Keys = map[auth.RoleType]string{
+	auth.ROLE_VIEWER:           "viewer-key",
+	auth.ROLE_READ_ONLY_EDITOR: "read-only-editor-key",
+	auth.ROLE_EDITOR:           "editor-key",
+	auth.ROLE_ADMIN:            "admin-key",
+}
+
+// UseKeys makes auth accept Keys, without needing grafana.net.
+func UseKeys() {
+	keys := make(auth.KeyFile)
+	for role, key := range Keys {
+		keys[auth.HashKey(key)] = &auth.ApiKey{
+			Name:  string(role),
+			OrgId: OrgId,
+			Role:  role,
+		}
+	}
+	auth.SetProvider(auth.NewLocalProvider(keys))
+}
+
+// Route is an API route and the roles that may use it.  Routes without
+// Roles are only for the admin key.
+type Route struct {
+	Method string
+	Path   string
+	Roles  []auth.RoleType
+}
+
+// Viewer returns a route for auth.ViewerRoles.
+func Viewer(method, path string) Route {
+	return Route{Method: method, Path: path, Roles: auth.ViewerRoles}
+}
+
+// Editor returns a route for auth.EditorRoles.
+func Editor(method, path string) Route {
+	return Route{Method: method, Path: path, Roles: auth.EditorRoles}
+}
+
+// Admin returns a route only the admin key may use.
+func Admin(method, path string) Route {
+	return Route{Method: method, Path: path}
+}
+
+// Request sends a request with a JSON body to h using key, and returns the
+// status code.
+func Request(h http.Handler, key, method, url, body string) int {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+// CheckRoutes requests every route with the key of each role, and checks
+// that only the allowed roles get past the role checks.  It also checks
+// that the admin key may use every route and that an unknown key is
+// rejected.  h must accept AdminKey and, after UseKeys, Keys.
+func CheckRoutes(t *testing.T, h http.Handler, routes []Route) {
+	Convey("Given a user with each role", t, func() {
+		for role, key := range Keys {
+			role, key := role, key
+			for _, r := range routes {
+				r := r
+				allowed := (&auth.SignedInUser{Role: role}).HasRole(r.Roles...)
+				Convey(fmt.Sprintf("%s %s %s is allowed: %t", role, r.Method, r.Path, allowed), func() {
+					code := Request(h, key, r.Method, r.Path, "{}")
+					if allowed {
+						So(code, ShouldNotEqual, 401)
+						So(code, ShouldNotEqual, 403)
+					} else {
+						So(code, ShouldEqual, 403)
+					}
+				})
+			}
+		}
+	})
+	Convey("Given the admin key", t, func() {
+		Convey("all routes are allowed", func() {
+			for _, r := range routes {
+				So(Request(h, AdminKey, r.Method, r.Path, "{}"), ShouldNotEqual, 403)
+			}
+		})
+	})
+	Convey("Given an invalid key", t, func() {
+		Convey("requests are unauthorized", func() {
+			for _, r := range routes {
+				So(Request(h, "bad-key", r.Method, r.Path, "{}"), ShouldEqual, 401)
+			}
+		})
+	})
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/raintank/met"
+)
+
+var (
+	// CacheSize is the maximum number of API keys held by a CachedProvider.
+	CacheSize = 10000
+	// CacheStaleTTL is how long after expiring a valid key is still
+	// accepted while it is revalidated.  This keeps users logged in when
+	// the provider is unavailable.  0 disables serving stale keys.
+	CacheStaleTTL time.Duration
+
+	validTTL   = time.Minute * 5
+	invalidTTL = time.Second * 30
+
+	cacheHit       met.Count = nopCount{}
+	cacheMiss      met.Count = nopCount{}
+	cacheStale     met.Count = nopCount{}
+	cacheCoalesced met.Count = nopCount{}
+	cacheEvicted   met.Count = nopCount{}
+	authErrors     met.Count = nopCount{}
+)
+
+type nopCount struct{}
+
+func (nopCount) Inc(val int64) {}
+
+func InitMetrics(metrics met.Backend) {
+	cacheHit = metrics.NewCount("auth.cache.hit")
+	cacheMiss = metrics.NewCount("auth.cache.miss")
+	cacheStale = metrics.NewCount("auth.cache.stale")
+	cacheCoalesced = metrics.NewCount("auth.cache.coalesced")
+	cacheEvicted = metrics.NewCount("auth.cache.evicted")
+	authErrors = metrics.NewCount("auth.errors")
+}
+
+type CacheItem struct {
+	Key        string
+	User       *SignedInUser
+	ExpireTime time.Time
+	// StaleTime is when the item is removed.  Between ExpireTime and
+	// StaleTime the item needs to be revalidated.
+	StaleTime time.Time
+}
+
+// AuthCache is a size bounded LRU cache of API key lookups.
+type AuthCache struct {
+	sync.Mutex
+	size  int
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+func NewAuthCache(size int) *AuthCache {
+	return &AuthCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// Get returns the item for key, if it is not yet stale.
+func (a *AuthCache) Get(key string) (*CacheItem, bool) {
+	a.Lock()
+	defer a.Unlock()
+	e, ok := a.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := e.Value.(*CacheItem)
+	if !item.StaleTime.After(time.Now()) {
+		a.remove(e)
+		return nil, false
+	}
+	a.lru.MoveToFront(e)
+	return item, true
+}
+
+func (a *AuthCache) Set(key string, u *SignedInUser, ttl, staleTTL time.Duration) {
+	now := time.Now()
+	item := &CacheItem{
+		Key:        key,
+		User:       u,
+		ExpireTime: now.Add(ttl),
+		StaleTime:  now.Add(ttl + staleTTL),
+	}
+	a.Lock()
+	defer a.Unlock()
+	if e, ok := a.items[key]; ok {
+		e.Value = item
+		a.lru.MoveToFront(e)
+		return
+	}
+	a.items[key] = a.lru.PushFront(item)
+	for a.lru.Len() > a.size {
+		a.remove(a.lru.Back())
+		cacheEvicted.Inc(1)
+	}
+}
+
+func (a *AuthCache) Len() int {
+	a.Lock()
+	defer a.Unlock()
+	return a.lru.Len()
+}
+
+func (a *AuthCache) remove(e *list.Element) {
+	a.lru.Remove(e)
+	delete(a.items, e.Value.(*CacheItem).Key)
+}
+
+type lookup struct {
+	wg   sync.WaitGroup
+	user *SignedInUser
+	err  error
+}
+
+// CachedProvider caches the results of another Provider.  Concurrent
+// lookups of the same key are coalesced into a single call.
+type CachedProvider struct {
+	Provider
+	ValidTTL   time.Duration
+	InvalidTTL time.Duration
+	StaleTTL   time.Duration
+
+	cache    *AuthCache
+	mu       sync.Mutex
+	inflight map[string]*lookup
+}
+
+// NewCachedProvider wraps p in a cache using CacheSize and CacheStaleTTL.
+func NewCachedProvider(p Provider) *CachedProvider {
+	return &CachedProvider{
+		Provider:   p,
+		ValidTTL:   validTTL,
+		InvalidTTL: invalidTTL,
+		StaleTTL:   CacheStaleTTL,
+		cache:      NewAuthCache(CacheSize),
+		inflight:   make(map[string]*lookup),
+	}
+}
+
+func (c *CachedProvider) Auth(keyString string) (*SignedInUser, error) {
+	item, ok := c.cache.Get(keyString)
+	if !ok {
+		cacheMiss.Inc(1)
+		return c.lookup(keyString)
+	}
+	if item.ExpireTime.Before(time.Now()) {
+		// only valid keys are kept past their ExpireTime.
+		cacheStale.Inc(1)
+		go c.lookup(keyString)
+		return item.User, nil
+	}
+	cacheHit.Inc(1)
+	if item.User == nil {
+		return nil, ErrInvalidApiKey
+	}
+	return item.User, nil
+}
+
+func (c *CachedProvider) lookup(keyString string) (*SignedInUser, error) {
+	c.mu.Lock()
+	if l, ok := c.inflight[keyString]; ok {
+		c.mu.Unlock()
+		cacheCoalesced.Inc(1)
+		l.wg.Wait()
+		return l.user, l.err
+	}
+	l := new(lookup)
+	l.wg.Add(1)
+	c.inflight[keyString] = l
+	c.mu.Unlock()
+
+	l.user, l.err = c.Provider.Auth(keyString)
+	switch l.err {
+	case nil:
+		c.cache.Set(keyString, l.user, c.ValidTTL, c.StaleTTL)
+	case ErrInvalidApiKey:
+		c.cache.Set(keyString, nil, c.InvalidTTL, 0)
+	default:
+		// leave any stale item in place, so it can still be used.
+		authErrors.Inc(1)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, keyString)
+	c.mu.Unlock()
+	l.wg.Done()
+	return l.user, l.err
+}
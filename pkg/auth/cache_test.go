@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingProvider accepts every key except "invalid", after delay.
+type countingProvider struct {
+	calls int32
+	delay time.Duration
+	err   atomic.Value
+}
+
+func (p *countingProvider) Auth(key string) (*SignedInUser, error) {
+	atomic.AddInt32(&p.calls, 1)
+	time.Sleep(p.delay)
+	if err, _ := p.err.Load().(error); err != nil {
+		return nil, err
+	}
+	if key == "invalid" {
+		return nil, ErrInvalidApiKey
+	}
+	return &SignedInUser{Name: key, key: key}, nil
+}
+
+func (p *countingProvider) Calls() int32 {
+	return atomic.LoadInt32(&p.calls)
+}
+
+func TestCachedProvider(t *testing.T) {
+	Convey("Given a cached provider", t, func() {
+		p := &countingProvider{}
+		c := NewCachedProvider(p)
+
+		Convey("valid and invalid keys are cached", func() {
+			for i := 0; i < 3; i++ {
+				user, err := c.Auth("key")
+				So(err, ShouldBeNil)
+				So(user.Name, ShouldEqual, "key")
+				_, err = c.Auth("invalid")
+				So(err, ShouldEqual, ErrInvalidApiKey)
+			}
+			So(p.Calls(), ShouldEqual, 2)
+		})
+
+		Convey("concurrent lookups of a key are coalesced", func() {
+			p.delay = time.Millisecond * 50
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					c.Auth("key")
+					wg.Done()
+				}()
+			}
+			wg.Wait()
+			So(p.Calls(), ShouldEqual, 1)
+		})
+
+		Convey("the least recently used keys are evicted", func() {
+			c.cache = NewAuthCache(2)
+			c.Auth("a")
+			c.Auth("b")
+			c.Auth("a")
+			c.Auth("c")
+			So(c.cache.Len(), ShouldEqual, 2)
+			_, ok := c.cache.Get("b")
+			So(ok, ShouldBeFalse)
+			_, ok = c.cache.Get("a")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("expired keys are removed", func() {
+			c.ValidTTL = time.Millisecond
+			c.Auth("key")
+			time.Sleep(time.Millisecond * 5)
+			c.Auth("key")
+			So(p.Calls(), ShouldEqual, 2)
+		})
+
+		Convey("stale keys are used while the provider is failing", func() {
+			c.ValidTTL = time.Millisecond
+			c.StaleTTL = time.Hour
+			c.Auth("key")
+			time.Sleep(time.Millisecond * 5)
+			p.err.Store(errors.New("provider down"))
+
+			user, err := c.Auth("key")
+			So(err, ShouldBeNil)
+			So(user.Name, ShouldEqual, "key")
+			// wait for the revalidation to fail.
+			time.Sleep(time.Millisecond * 20)
+			user, err = c.Auth("key")
+			So(err, ShouldBeNil)
+			So(user.Name, ShouldEqual, "key")
+		})
+	})
+}
+
+// countingKeyStore holds a single key and counts lookups.
+type countingKeyStore struct {
+	calls int32
+	key   *ApiKey
+}
+
+func (s *countingKeyStore) GetApiKey(keyHash string) (*ApiKey, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if keyHash != s.key.KeyHash {
+		return nil, ErrInvalidApiKey
+	}
+	return s.key, nil
+}
+
+func TestNewProviderCaches(t *testing.T) {
+	Convey("Given a db provider", t, func() {
+		store := &countingKeyStore{key: &ApiKey{KeyHash: HashKey("key"), Name: "test", OrgId: 2, Role: ROLE_EDITOR}}
+		p, err := NewProvider("db", "", "", store)
+		So(err, ShouldBeNil)
+
+		Convey("lookups are cached", func() {
+			So(p, ShouldHaveSameTypeAs, &CachedProvider{})
+			for i := 0; i < 3; i++ {
+				user, err := p.Auth("key")
+				So(err, ShouldBeNil)
+				So(user.OrgId, ShouldEqual, 2)
+			}
+			So(atomic.LoadInt32(&store.calls), ShouldEqual, 1)
+		})
+	})
+}
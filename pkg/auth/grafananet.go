@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/grafana/grafana/pkg/log"
+)
+
+const DefaultGrafanaNetUrl = "https://grafana.net/api/api-keys/check"
+
+// GrafanaNetProvider validates API keys against the grafana.net api-keys
+// check endpoint. Every call makes a request, so it should be wrapped in a
+// CachedProvider.
+type GrafanaNetProvider struct {
+	Url string
+}
+
+func NewGrafanaNetProvider(url string) *GrafanaNetProvider {
+	return &GrafanaNetProvider{Url: url}
+}
+
+func (g *GrafanaNetProvider) Auth(keyString string) (*SignedInUser, error) {
+	//validate the API key against grafana.net
+	payload := url.Values{}
+	payload.Add("token", keyString)
+	res, err := http.PostForm(g.Url, payload)
+
+	if err != nil {
+		log.Error(3, "failed to check apiKey. %s", err)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	log.Debug("apiKey check response was: %s", body)
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		// grafana.net is having problems, the key may well be valid.
+		return nil, fmt.Errorf("apiKey check failed with status %d", res.StatusCode)
+	}
+	if res.StatusCode != 200 {
+		return nil, ErrInvalidApiKey
+	}
+
+	user := &SignedInUser{key: keyString}
+	err = json.Unmarshal(body, user)
+	if err != nil {
+		log.Error(3, "failed to parse api-keys/check response. %s", err)
+		return nil, err
+	}
+	return user, nil
+}
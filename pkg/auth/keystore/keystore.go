@@ -0,0 +1,23 @@
+// Package keystore stores the API keys used by auth.LocalProvider in the
+// api_key table of a service's database.  Services add the table with
+// AddMigrations and look keys up with GetApiKey from their own sqlstore.
+package keystore
+
+import (
+	"github.com/go-xorm/xorm"
+	"github.com/raintank/raintank-apps/pkg/auth"
+)
+
+// GetApiKey returns the key with keyHash from the api_key table, or
+// auth.ErrInvalidApiKey if there is none.
+func GetApiKey(sess *xorm.Session, keyHash string) (*auth.ApiKey, error) {
+	k := new(auth.ApiKey)
+	has, err := sess.Table("api_key").Where("key_hash=?", keyHash).Get(k)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, auth.ErrInvalidApiKey
+	}
+	return k, nil
+}
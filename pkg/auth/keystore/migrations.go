@@ -0,0 +1,34 @@
+package keystore
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// AddMigrations adds the api_key table.  The migration ids are shared by
+// every service using the table.
+func AddMigrations(mg *migrator.Migrator) {
+	apiKeyV1 := migrator.Table{
+		Name: "api_key",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "key_hash", Type: migrator.DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "org_name", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "org_slug", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "role", Type: migrator.DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "is_admin", Type: migrator.DB_Bool, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"key_hash"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"org_id"}},
+		},
+	}
+	mg.AddMigration("create api_key table v1", migrator.NewAddTableMigration(apiKeyV1))
+	for _, index := range apiKeyV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(apiKeyV1.Name), "v1")
+		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(apiKeyV1, index))
+	}
+}
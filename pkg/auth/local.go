@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ApiKey maps the hash of an API key to the user it authenticates as.
+type ApiKey struct {
+	Id      int64    `json:"-"`
+	KeyHash string   `json:"keyHash"`
+	Name    string   `json:"name"`
+	OrgId   int64    `json:"orgId"`
+	OrgName string   `json:"orgName"`
+	OrgSlug string   `json:"orgSlug"`
+	Role    RoleType `json:"role"`
+	IsAdmin bool     `json:"isAdmin"`
+}
+
+// HashKey returns the hex encoded sha256 hash of key, as stored in
+// ApiKey.KeyHash.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// A KeyStore looks up API keys by their hash. GetApiKey returns
+// ErrInvalidApiKey if there is no matching key.
+type KeyStore interface {
+	GetApiKey(keyHash string) (*ApiKey, error)
+}
+
+// KeyFile is a KeyStore loaded from a JSON file holding a list of ApiKeys.
+type KeyFile map[string]*ApiKey
+
+func LoadKeyFile(path string) (KeyFile, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*ApiKey, 0)
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s. %s", path, err)
+	}
+	keyFile := make(KeyFile)
+	for _, k := range keys {
+		if k.KeyHash == "" {
+			return nil, fmt.Errorf("key %q in %s has no keyHash", k.Name, path)
+		}
+		if !k.Role.IsValid() {
+			return nil, fmt.Errorf("key %q in %s has invalid role %q", k.Name, path, k.Role)
+		}
+		keyFile[k.KeyHash] = k
+	}
+	return keyFile, nil
+}
+
+func (f KeyFile) GetApiKey(keyHash string) (*ApiKey, error) {
+	k, ok := f[keyHash]
+	if !ok {
+		return nil, ErrInvalidApiKey
+	}
+	return k, nil
+}
+
+// LocalProvider validates API keys against a KeyStore, so that no external
+// service is needed.
+type LocalProvider struct {
+	store KeyStore
+}
+
+func NewLocalProvider(store KeyStore) *LocalProvider {
+	return &LocalProvider{store: store}
+}
+
+func (l *LocalProvider) Auth(keyString string) (*SignedInUser, error) {
+	k, err := l.store.GetApiKey(HashKey(keyString))
+	if err != nil {
+		return nil, err
+	}
+	return &SignedInUser{
+		Name:    k.Name,
+		OrgId:   k.OrgId,
+		OrgName: k.OrgName,
+		OrgSlug: k.OrgSlug,
+		Role:    k.Role,
+		IsAdmin: k.IsAdmin,
+		key:     keyString,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/Unknwon/macaron"
+	"github.com/grafana/grafana/pkg/log"
+)
+
+// UserFunc returns the signed in user of a request.  Every service maps its
+// own request context, so the middleware is told how to find the user in it.
+type UserFunc func(c *macaron.Context) *SignedInUser
+
+// RequireRole rejects requests from users that have none of roles.
+func RequireRole(user UserFunc, roles ...RoleType) macaron.Handler {
+	return func(c *macaron.Context) {
+		if !user(c).HasRole(roles...) {
+			c.JSON(403, "Permision denied")
+		}
+	}
+}
+
+// ApplyOrgOverride returns the user acting on behalf of the org in the
+// OrgIdHeader of req, or user itself if the header is not set.  If the
+// override is not allowed it returns the HTTP status and error to respond
+// with.
+func ApplyOrgOverride(user *SignedInUser, req *http.Request) (*SignedInUser, int, error) {
+	orgId := req.Header.Get(OrgIdHeader)
+	if orgId == "" {
+		return user, 200, nil
+	}
+	user, err := user.ForOrg(orgId)
+	if err != nil {
+		if err == ErrOrgIdForbidden {
+			return nil, 403, err
+		}
+		return nil, 400, err
+	}
+	log.Info("admin acting on behalf of org %d: %s %s", user.OrgId, req.Method, req.URL.Path)
+	return user, 200, nil
+}
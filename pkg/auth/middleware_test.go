@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Unknwon/macaron"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testUser(c *macaron.Context) *SignedInUser {
+	return c.GetVal(reflect.TypeOf(&SignedInUser{})).Interface().(*SignedInUser)
+}
+
+func TestRequireRole(t *testing.T) {
+	Convey("Given routes requiring roles", t, func() {
+		user := &SignedInUser{}
+		m := macaron.New()
+		m.Use(macaron.Renderer())
+		m.Use(func(c *macaron.Context) {
+			c.Map(user)
+		})
+		ok := func(c *macaron.Context) {
+			c.JSON(200, "ok")
+		}
+		m.Get("/viewer", RequireRole(testUser, ViewerRoles...), ok)
+		m.Get("/editor", RequireRole(testUser, EditorRoles...), ok)
+		m.Get("/admin", RequireRole(testUser, ROLE_ADMIN), ok)
+		m.Get("/none", RequireRole(testUser), ok)
+
+		status := func(path string) int {
+			req, err := http.NewRequest("GET", path, nil)
+			So(err, ShouldBeNil)
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+			return resp.Code
+		}
+
+		cases := []struct {
+			user  SignedInUser
+			allow map[string]bool
+		}{
+			{SignedInUser{Role: ROLE_VIEWER}, map[string]bool{"/viewer": true}},
+			{SignedInUser{Role: ROLE_READ_ONLY_EDITOR}, map[string]bool{"/viewer": true}},
+			{SignedInUser{Role: ROLE_EDITOR}, map[string]bool{"/viewer": true, "/editor": true}},
+			{SignedInUser{Role: ROLE_ADMIN}, map[string]bool{"/viewer": true, "/editor": true, "/admin": true}},
+			{SignedInUser{Role: ROLE_VIEWER, IsAdmin: true}, map[string]bool{"/viewer": true, "/editor": true, "/admin": true, "/none": true}},
+			{SignedInUser{}, map[string]bool{}},
+		}
+		for _, c := range cases {
+			*user = c.user
+			for _, path := range []string{"/viewer", "/editor", "/admin", "/none"} {
+				expected := 403
+				if c.allow[path] {
+					expected = 200
+				}
+				So(fmt.Sprintf("%q admin=%t %s: %d", c.user.Role, c.user.IsAdmin, path, status(path)), ShouldEqual,
+					fmt.Sprintf("%q admin=%t %s: %d", c.user.Role, c.user.IsAdmin, path, expected))
+			}
+		}
+	})
+}
+
+func TestApplyOrgOverride(t *testing.T) {
+	Convey("When a request sets the org id header", t, func() {
+		admin := &SignedInUser{OrgId: 1, Role: ROLE_ADMIN, IsAdmin: true}
+		request := func(orgId string) *http.Request {
+			req, err := http.NewRequest("GET", "/api/v1/agents", nil)
+			So(err, ShouldBeNil)
+			if orgId != "" {
+				req.Header.Set(OrgIdHeader, orgId)
+			}
+			return req
+		}
+
+		Convey("users without the header are unchanged", func() {
+			user, status, err := ApplyOrgOverride(admin, request(""))
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(user, ShouldEqual, admin)
+		})
+		Convey("admins act on behalf of the org", func() {
+			user, status, err := ApplyOrgOverride(admin, request("10"))
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(user.OrgId, ShouldEqual, 10)
+			So(user.OrgOverride, ShouldBeTrue)
+		})
+		Convey("invalid org ids are a bad request", func() {
+			_, status, err := ApplyOrgOverride(admin, request("abc"))
+			So(err, ShouldEqual, ErrInvalidOrgId)
+			So(status, ShouldEqual, 400)
+		})
+		Convey("other users are forbidden", func() {
+			_, status, err := ApplyOrgOverride(&SignedInUser{OrgId: 2, Role: ROLE_ADMIN}, request("10"))
+			So(err, ShouldEqual, ErrOrgIdForbidden)
+			So(status, ShouldEqual, 403)
+		})
+	})
+}
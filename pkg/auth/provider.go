@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/log"
+)
+
+// A Provider validates API keys.  Auth returns ErrInvalidApiKey if the key
+// is not known to the provider, any other error means the key could not be
+// checked.
+type Provider interface {
+	Auth(key string) (*SignedInUser, error)
+}
+
+// Chain tries each of its providers in order and returns the user from the
+// first one that accepts the key.
+type Chain []Provider
+
+func (c Chain) Auth(key string) (*SignedInUser, error) {
+	var lastErr error
+	for _, p := range c {
+		user, err := p.Auth(key)
+		if err == nil {
+			return user, nil
+		}
+		if err != ErrInvalidApiKey {
+			log.Error(3, "auth provider failed. %s", err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrInvalidApiKey
+}
+
+// NewProvider builds a Provider from a comma separated list of provider
+// names. Supported names are "grafana.net", "file" and "db". The "db"
+// provider uses store, and is only available if store is not nil. Each
+// provider is wrapped in its own CachedProvider, so keys from every source
+// are cached for the same time, and revoked keys stop working once their
+// cache entry expires.
+func NewProvider(names, grafanaNetUrl, keyFile string, store KeyStore) (Provider, error) {
+	chain := make(Chain, 0)
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "grafana.net":
+			chain = append(chain, NewGrafanaNetProvider(grafanaNetUrl))
+		case "file":
+			if keyFile == "" {
+				return nil, fmt.Errorf("file auth provider requires a key file")
+			}
+			keys, err := LoadKeyFile(keyFile)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, NewLocalProvider(keys))
+		case "db":
+			if store == nil {
+				return nil, fmt.Errorf("db auth provider is not supported")
+			}
+			chain = append(chain, NewLocalProvider(store))
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", name)
+		}
+		chain[len(chain)-1] = NewCachedProvider(chain[len(chain)-1])
+	}
+	switch len(chain) {
+	case 0:
+		return nil, fmt.Errorf("no auth providers configured")
+	case 1:
+		return chain[0], nil
+	}
+	return chain, nil
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"strconv"
 	"time"
 )
 
@@ -9,8 +10,13 @@ import (
 var (
 	ErrInvalidRoleType = errors.New("Invalid role type")
 	ErrInvalidApiKey   = errors.New("Invalid API Key")
+	ErrInvalidOrgId    = errors.New("Invalid " + OrgIdHeader + " header")
+	ErrOrgIdForbidden  = errors.New("Only admins may set the " + OrgIdHeader + " header")
 )
 
+// OrgIdHeader lets admins act on behalf of another org.
+const OrgIdHeader = "X-Org-Id"
+
 type RoleType string
 
 const (
@@ -24,6 +30,13 @@ func (r RoleType) IsValid() bool {
 	return r == ROLE_VIEWER || r == ROLE_ADMIN || r == ROLE_EDITOR || r == ROLE_READ_ONLY_EDITOR
 }
 
+var (
+	// ViewerRoles may use read only API routes.
+	ViewerRoles = []RoleType{ROLE_VIEWER, ROLE_READ_ONLY_EDITOR, ROLE_EDITOR, ROLE_ADMIN}
+	// EditorRoles may also use routes that make changes.
+	EditorRoles = []RoleType{ROLE_EDITOR, ROLE_ADMIN}
+)
+
 type SignedInUser struct {
 	Id        int64     `json:"id"`
 	OrgName   string    `json:"orgName"`
@@ -33,5 +46,39 @@ type SignedInUser struct {
 	Role      RoleType  `json:"role"`
 	CreatedAt time.Time `json:"createAt"`
 	IsAdmin   bool      `json:"-"`
-	key       string
+	// OrgOverride is set when an admin is acting on behalf of OrgId.
+	OrgOverride bool `json:"-"`
+	key         string
+}
+
+// HasRole returns true if the user has one of roles. Admins have every
+// role.
+func (u *SignedInUser) HasRole(roles ...RoleType) bool {
+	if u.IsAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if u.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// ForOrg returns a copy of the user acting on behalf of the org given in
+// an OrgIdHeader. Only admins can act on behalf of other orgs.
+func (u *SignedInUser) ForOrg(orgIdHeader string) (*SignedInUser, error) {
+	if !u.IsAdmin {
+		return nil, ErrOrgIdForbidden
+	}
+	orgId, err := strconv.ParseInt(orgIdHeader, 10, 64)
+	if err != nil || orgId <= 0 {
+		return nil, ErrInvalidOrgId
+	}
+	user := *u
+	user.OrgId = orgId
+	user.OrgName = ""
+	user.OrgSlug = ""
+	user.OrgOverride = true
+	return &user, nil
 }
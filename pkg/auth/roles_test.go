@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHasRole(t *testing.T) {
+	Convey("When checking user roles", t, func() {
+		cases := []struct {
+			user   *SignedInUser
+			viewer bool
+			editor bool
+		}{
+			{&SignedInUser{Role: ROLE_VIEWER}, true, false},
+			{&SignedInUser{Role: ROLE_READ_ONLY_EDITOR}, true, false},
+			{&SignedInUser{Role: ROLE_EDITOR}, true, true},
+			{&SignedInUser{Role: ROLE_ADMIN}, true, true},
+			{&SignedInUser{Role: ROLE_VIEWER, IsAdmin: true}, true, true},
+			{&SignedInUser{Role: RoleType("")}, false, false},
+		}
+		for _, c := range cases {
+			So(c.user.HasRole(ViewerRoles...), ShouldEqual, c.viewer)
+			So(c.user.HasRole(EditorRoles...), ShouldEqual, c.editor)
+		}
+	})
+}
+
+func TestForOrg(t *testing.T) {
+	Convey("When acting on behalf of an org", t, func() {
+		Convey("admins get a copy of their user in the org", func() {
+			admin := &SignedInUser{OrgId: 1, OrgName: "Admin", Role: ROLE_ADMIN, IsAdmin: true}
+			user, err := admin.ForOrg("10")
+			So(err, ShouldBeNil)
+			So(user.OrgId, ShouldEqual, 10)
+			So(user.OrgName, ShouldEqual, "")
+			So(user.OrgOverride, ShouldBeTrue)
+			So(admin.OrgId, ShouldEqual, 1)
+			So(admin.OrgOverride, ShouldBeFalse)
+		})
+		Convey("invalid org ids are rejected", func() {
+			admin := &SignedInUser{IsAdmin: true}
+			for _, orgId := range []string{"abc", "0", "-1"} {
+				_, err := admin.ForOrg(orgId)
+				So(err, ShouldEqual, ErrInvalidOrgId)
+			}
+		})
+		Convey("other users are forbidden", func() {
+			_, err := (&SignedInUser{OrgId: 2, Role: ROLE_ADMIN}).ForOrg("10")
+			So(err, ShouldEqual, ErrOrgIdForbidden)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"flag"
+	"os"
+
+	"github.com/rakyll/globalconf"
+)
+
+// Reloader re-reads a globalconf configuration file so that changes can be
+// applied without restarting the process.  Flags given on the command line
+// take precedence over the config file and are never changed by a reload.
+type Reloader struct {
+	file    string
+	cmdline map[string]bool
+}
+
+// NewReloader must be called after flag.Parse() and before the config file
+// is first parsed, so that it can record which flags were set on the
+// command line.
+func NewReloader(file string) *Reloader {
+	r := &Reloader{
+		file:    file,
+		cmdline: make(map[string]bool),
+	}
+	flag.Visit(func(f *flag.Flag) {
+		r.cmdline[f.Name] = true
+	})
+	return r
+}
+
+// Change is a flag whose value in the config file differs from the value
+// currently in use.
+type Change struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Reload reads the config file and updates the flags listed in reloadable
+// to their new values.  The applied changes are returned, along with any
+// changes to other flags, which only take effect after a restart.
+func (r *Reloader) Reload(reloadable ...string) (applied, restart []Change, err error) {
+	// parse the file into a copy of the flag set, so that the values
+	// currently in use are untouched until we know what has changed.
+	set := flag.NewFlagSet("reload", flag.ContinueOnError)
+	flag.VisitAll(func(f *flag.Flag) {
+		set.String(f.Name, f.DefValue, f.Usage)
+	})
+	if _, err := os.Stat(r.file); err == nil {
+		conf, err := globalconf.NewWithOptions(&globalconf.Options{Filename: r.file})
+		if err != nil {
+			return nil, nil, err
+		}
+		conf.ParseSet("", set)
+	}
+
+	canReload := make(map[string]bool)
+	for _, name := range reloadable {
+		canReload[name] = true
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if r.cmdline[f.Name] || err != nil {
+			return
+		}
+		old := f.Value.String()
+		// set the value before comparing, so that equivalent values such as
+		// "2m" and "2m0s" are not reported as changes.
+		if err = f.Value.Set(set.Lookup(f.Name).Value.String()); err != nil {
+			return
+		}
+		c := Change{Name: f.Name, Old: old, New: f.Value.String()}
+		if c.Old == c.New {
+			return
+		}
+		if !canReload[f.Name] {
+			err = f.Value.Set(old)
+			restart = append(restart, c)
+			return
+		}
+		applied = append(applied, c)
+	})
+	return applied, restart, err
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"net"
+	"time"
+
+	"github.com/Unknwon/macaron"
+	"github.com/raintank/raintank-apps/pkg/auth"
+)
+
+// PreAuthGroup is the group whose key limit applies, per remote IP, to
+// requests before they are authenticated.  Unlike other groups, it does
+// not fall back to the DefaultGroup limit.
+const PreAuthGroup = "preauth"
+
+// KeyFunc returns the API key of a request, or "" if it has none.
+type KeyFunc func(c *macaron.Context) string
+
+// PreAuth limits the rate of requests before they are authenticated, so
+// that invalid keys are limited too and can not cause unlimited auth
+// lookups.  Requests are counted per remote IP, whatever key they use, as
+// the key has not been verified yet and a client could otherwise get a
+// fresh bucket for every key it makes up.  Requests using the admin key
+// are not limited.  The limits are disabled if l is nil.
+func (l *Limits) PreAuth(key KeyFunc, adminKey func() string) macaron.Handler {
+	return func(c *macaron.Context) {
+		if l == nil {
+			return
+		}
+		if k := key(c); k != "" && k == adminKey() {
+			return
+		}
+		if ok, wait := l.Allow(PreAuthGroup, remoteIP(c), 0); !ok {
+			reject(c, wait)
+		}
+	}
+}
+
+// Handler limits the rate of requests to a route group per API key and
+// per org, and must come after authentication.  Admins are not limited.
+// The limits are disabled if l is nil.
+func (l *Limits) Handler(group string, key KeyFunc, user auth.UserFunc) macaron.Handler {
+	return func(c *macaron.Context) {
+		if l == nil {
+			return
+		}
+		u := user(c)
+		if u.IsAdmin {
+			return
+		}
+		if ok, wait := l.Allow(group, auth.HashKey(key(c)), u.OrgId); !ok {
+			reject(c, wait)
+		}
+	}
+}
+
+func reject(c *macaron.Context, wait time.Duration) {
+	c.Resp.Header().Set("Retry-After", RetryAfter(wait))
+	c.JSON(429, "Too many requests")
+}
+
+// remoteIP returns the address the request came from.  Proxy headers are
+// not trusted, as clients could set them to get a fresh bucket.
+func remoteIP(c *macaron.Context) string {
+	host, _, err := net.SplitHostPort(c.Req.RemoteAddr)
+	if err != nil {
+		return c.Req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Unknwon/macaron"
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testKey(c *macaron.Context) string {
+	return strings.TrimPrefix(c.Req.Header.Get("Authorization"), "Bearer ")
+}
+
+func testUser(c *macaron.Context) *auth.SignedInUser {
+	return c.GetVal(reflect.TypeOf(&auth.SignedInUser{})).Interface().(*auth.SignedInUser)
+}
+
+func TestMiddleware(t *testing.T) {
+	Convey("Given rate limited routes", t, func() {
+		stats, _ := helper.New(false, "localhost:8125", "standard", "test", "default")
+		limits, err := New("default=1:2,preauth=1:3", "", stats)
+		So(err, ShouldBeNil)
+
+		// authenticated counts the requests that got past PreAuth.
+		authenticated := 0
+		m := macaron.New()
+		m.Use(macaron.Renderer())
+		m.Use(limits.PreAuth(testKey, func() string { return "admin-key" }))
+		m.Use(func(c *macaron.Context) {
+			authenticated++
+			key := testKey(c)
+			if key != "admin-key" && key != "valid-key" {
+				c.JSON(401, "Unauthorized")
+				return
+			}
+			c.Map(&auth.SignedInUser{OrgId: 1, IsAdmin: key == "admin-key"})
+		})
+		m.Get("/", limits.Handler("tasks", testKey, testUser), func(c *macaron.Context) {
+			c.JSON(200, "ok")
+		})
+
+		request := func(key, remoteAddr string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", "/", nil)
+			So(err, ShouldBeNil)
+			req.RemoteAddr = remoteAddr
+			if key != "" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("requests over the group limit get a 429 with Retry-After", func() {
+			So(request("valid-key", "10.0.0.1:1234").Code, ShouldEqual, 200)
+			So(request("valid-key", "10.0.0.1:1234").Code, ShouldEqual, 200)
+			resp := request("valid-key", "10.0.0.1:1234")
+			So(resp.Code, ShouldEqual, 429)
+			So(resp.Header().Get("Retry-After"), ShouldEqual, "1")
+		})
+
+		Convey("invalid keys are limited before they are authenticated", func() {
+			for i := 0; i < 3; i++ {
+				So(request("bad-key", "10.0.0.1:1234").Code, ShouldEqual, 401)
+			}
+			resp := request("bad-key", "10.0.0.1:1234")
+			So(resp.Code, ShouldEqual, 429)
+			So(resp.Header().Get("Retry-After"), ShouldEqual, "1")
+			So(authenticated, ShouldEqual, 3)
+		})
+
+		Convey("made up keys do not get a fresh limit", func() {
+			for i := 0; i < 3; i++ {
+				So(request(fmt.Sprintf("bad-key-%d", i), "10.0.0.1:1234").Code, ShouldEqual, 401)
+			}
+			So(request("bad-key-3", "10.0.0.1:1234").Code, ShouldEqual, 429)
+			So(request("valid-key", "10.0.0.1:1234").Code, ShouldEqual, 429)
+			So(authenticated, ShouldEqual, 3)
+			So(request("bad-key-4", "10.0.0.2:1234").Code, ShouldEqual, 401)
+		})
+
+		Convey("requests without a key are limited per remote IP", func() {
+			for i := 0; i < 3; i++ {
+				So(request("", "10.0.0.1:1234").Code, ShouldEqual, 401)
+			}
+			So(request("", "10.0.0.1:5678").Code, ShouldEqual, 429)
+			So(request("", "10.0.0.2:1234").Code, ShouldEqual, 401)
+		})
+
+		Convey("the admin key is not limited", func() {
+			for i := 0; i < 5; i++ {
+				So(request("admin-key", "10.0.0.1:1234").Code, ShouldEqual, 200)
+			}
+		})
+
+		Convey("nil limits allow every request", func() {
+			var none *Limits
+			h := none.PreAuth(testKey, func() string { return "" }).(func(*macaron.Context))
+			So(func() { h(nil) }, ShouldNotPanic)
+		})
+	})
+}
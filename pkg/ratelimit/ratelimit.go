@@ -0,0 +1,205 @@
+// Package ratelimit provides token bucket rate limits for API route
+// groups, per API key and per org.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raintank/met"
+)
+
+// DefaultGroup is the limit used for route groups without their own.
+const DefaultGroup = "default"
+
+// sweepInterval is how often idle buckets are removed.
+var sweepInterval = time.Minute
+
+// Limit allows Rate requests per second, with bursts of up to Burst
+// requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimits parses a comma separated list of group=rate:burst limits, eg.
+// "default=10:20,metrics=100:500".
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, l := range strings.Split(s, ",") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %q. must be group=rate:burst", l)
+		}
+		values := strings.SplitN(parts[1], ":", 2)
+		if len(values) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %q. must be group=rate:burst", l)
+		}
+		rate, err := strconv.ParseFloat(values[0], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate in rate limit %q", l)
+		}
+		burst, err := strconv.Atoi(values[1])
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid burst in rate limit %q", l)
+		}
+		limits[strings.TrimSpace(parts[0])] = Limit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets sharing a Limit.
+type Limiter struct {
+	sync.Mutex
+	limit     Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket for key.  If the bucket is empty it
+// returns false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep removes buckets that have refilled, as they are the same as a new
+// bucket.
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) Len() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.buckets)
+}
+
+type group struct {
+	key      *Limiter
+	org      *Limiter
+	rejected met.Count
+}
+
+// Limits rate limits route groups by API key and by org.
+type Limits struct {
+	sync.Mutex
+	groups    map[string]*group
+	keyLimits map[string]Limit
+	orgLimits map[string]Limit
+	metrics   met.Backend
+}
+
+// New creates Limits from the group=rate:burst lists accepted by
+// ParseLimits.  Groups without a limit, and no DefaultGroup limit, are
+// not limited.  PreAuthGroup only has a key limit, which is applied per
+// remote IP.  Rejected requests are counted as api.rate_limited.<group>.
+func New(keyLimits, orgLimits string, metrics met.Backend) (*Limits, error) {
+	l := &Limits{
+		groups:  make(map[string]*group),
+		metrics: metrics,
+	}
+	var err error
+	if l.keyLimits, err = ParseLimits(keyLimits); err != nil {
+		return nil, err
+	}
+	if l.orgLimits, err = ParseLimits(orgLimits); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Limits) getGroup(name string) *group {
+	l.Lock()
+	defer l.Unlock()
+	g, ok := l.groups[name]
+	if ok {
+		return g
+	}
+	g = &group{rejected: l.metrics.NewCount("api.rate_limited." + name)}
+	if limit, ok := lookup(l.keyLimits, name); ok {
+		g.key = NewLimiter(limit)
+	}
+	if limit, ok := lookup(l.orgLimits, name); ok && name != PreAuthGroup {
+		g.org = NewLimiter(limit)
+	}
+	l.groups[name] = g
+	return g
+}
+
+func lookup(limits map[string]Limit, name string) (Limit, bool) {
+	if limit, ok := limits[name]; ok || name == PreAuthGroup {
+		return limit, ok
+	}
+	limit, ok := limits[DefaultGroup]
+	return limit, ok
+}
+
+// Allow checks the limits of the route group for the API key and org of a
+// request.  If the request is rejected, Allow returns false and how long
+// the client should wait before retrying.
+func (l *Limits) Allow(name, apiKey string, orgId int64) (bool, time.Duration) {
+	g := l.getGroup(name)
+	if g.key != nil {
+		if ok, wait := g.key.Allow(apiKey); !ok {
+			g.rejected.Inc(1)
+			return false, wait
+		}
+	}
+	if g.org != nil {
+		if ok, wait := g.org.Allow(strconv.FormatInt(orgId, 10)); !ok {
+			g.rejected.Inc(1)
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// RetryAfter formats a wait as the value of a Retry-After header.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raintank/met/helper"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseLimits(t *testing.T) {
+	Convey("When parsing limits", t, func() {
+		limits, err := ParseLimits("default=10:20, metrics=0.5:1")
+		So(err, ShouldBeNil)
+		So(limits, ShouldResemble, map[string]Limit{
+			"default": {Rate: 10, Burst: 20},
+			"metrics": {Rate: 0.5, Burst: 1},
+		})
+		for _, invalid := range []string{"default", "default=10", "default=a:1", "default=1:0", "default=-1:5"} {
+			_, err := ParseLimits(invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	Convey("Given a limiter", t, func() {
+		l := NewLimiter(Limit{Rate: 10, Burst: 3})
+		Convey("bursts are allowed", func() {
+			for i := 0; i < 3; i++ {
+				ok, _ := l.Allow("a")
+				So(ok, ShouldBeTrue)
+			}
+			ok, wait := l.Allow("a")
+			So(ok, ShouldBeFalse)
+			So(wait, ShouldBeGreaterThan, 0)
+			So(wait, ShouldBeLessThanOrEqualTo, time.Millisecond*100)
+			So(RetryAfter(wait), ShouldEqual, "1")
+
+			Convey("other keys have their own bucket", func() {
+				ok, _ := l.Allow("b")
+				So(ok, ShouldBeTrue)
+			})
+			Convey("tokens are refilled", func() {
+				time.Sleep(wait + time.Millisecond)
+				ok, _ := l.Allow("a")
+				So(ok, ShouldBeTrue)
+			})
+		})
+		Convey("idle buckets are removed", func() {
+			l.Allow("a")
+			l.lastSweep = time.Now().Add(-sweepInterval * 2)
+			time.Sleep(time.Millisecond * 350)
+			l.Allow("b")
+			So(l.Len(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestLimits(t *testing.T) {
+	Convey("Given key and org limits", t, func() {
+		stats, _ := helper.New(false, "localhost:8125", "standard", "test", "default")
+		limits, err := New("default=100:2", "tasks=100:3", stats)
+		So(err, ShouldBeNil)
+
+		Convey("a key is limited in each group", func() {
+			for _, group := range []string{"tasks", "agents"} {
+				ok, _ := limits.Allow(group, "key1", 1)
+				So(ok, ShouldBeTrue)
+				ok, _ = limits.Allow(group, "key1", 1)
+				So(ok, ShouldBeTrue)
+				ok, _ = limits.Allow(group, "key1", 1)
+				So(ok, ShouldBeFalse)
+			}
+		})
+		Convey("an org is limited across its keys", func() {
+			for _, key := range []string{"key1", "key2", "key3"} {
+				ok, _ := limits.Allow("tasks", key, 1)
+				So(ok, ShouldBeTrue)
+			}
+			ok, _ := limits.Allow("tasks", "key4", 1)
+			So(ok, ShouldBeFalse)
+			ok, _ = limits.Allow("tasks", "key4", 2)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("the preauth group does not use the default limits", func() {
+			for i := 0; i < 5; i++ {
+				ok, _ := limits.Allow(PreAuthGroup, "key1", 1)
+				So(ok, ShouldBeTrue)
+			}
+		})
+	})
+}
@@ -21,9 +21,12 @@ type Session struct {
 	EventHandlers    map[string]*message.Handler
 	Conn             *websocket.Conn
 	writeMessageChan chan *message.Message
-	closing          bool
-	rDone            chan struct{}
-	wDone            chan struct{}
+	// pending is a message that could not be sent before the writer was
+	// stopped.  It is sent first when Start is called again.
+	pending *message.Message
+	closing bool
+	rDone   chan struct{}
+	wDone   chan struct{}
 }
 
 func NewSession(conn *websocket.Conn, writeQueueSize int) *Session {
@@ -59,33 +62,52 @@ func (s *Session) Emit(event *message.Event) error {
 	return nil
 }
 
+// Start reads and writes messages until the connection fails.  Start can be
+// called again after Conn has been replaced, and any messages still queued,
+// including one the writer was still trying to send, are then sent on the
+// new connection.
 func (s *Session) Start() {
-	s.rDone = make(chan struct{})
-	s.wDone = make(chan struct{})
-	go s.socketReader(s.rDone)
-	go s.socketWriter(s.wDone)
+	rDone := make(chan struct{})
+	wDone := make(chan struct{})
+	s.Lock()
+	s.rDone = rDone
+	s.wDone = wDone
+	s.Unlock()
+	stop := make(chan struct{})
+	go s.socketReader(rDone)
+	go s.socketWriter(wDone, stop)
 
+	// wait for both the reader and writer to finish, so they never use a
+	// new Conn set by the disconnect handler.
 	select {
-	case <-s.wDone:
+	case <-wDone:
 		log.Debug("writer closed.")
-		s.disconnected()
-		return
-	case <-s.rDone:
+		<-rDone
+	case <-rDone:
 		log.Debug("reader closed.")
-		s.disconnected()
-		return
+		close(stop)
+		<-wDone
 	}
+	s.disconnected()
 }
 
 func (s *Session) Close() {
 	s.Lock()
 	s.closing = true
 	s.Unlock()
-	s.writeMessageChan <- &message.Message{MessageType: websocket.CloseMessage, Body: websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")}
+	select {
+	case s.writeMessageChan <- &message.Message{MessageType: websocket.CloseMessage, Body: websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")}:
+	default:
+		// the writer has stopped and the queue is full.
+		log.Debug("write queue full. not sending close message.")
+	}
 	close(s.writeMessageChan)
 	log.Info("waiting for socketWriter to finish sending all messages.")
+	s.Lock()
+	wDone := s.wDone
+	s.Unlock()
 	select {
-	case <-s.wDone:
+	case <-wDone:
 	case <-time.After(time.Second * 2):
 		log.Warn("socketWriter taking too long. Closing connectio now. %d messages in queue will be lost.", len(s.writeMessageChan)+1)
 	}
@@ -132,11 +154,27 @@ func (s *Session) socketReader(done chan struct{}) {
 	}
 }
 
-func (s *Session) socketWriter(done chan struct{}) {
+func (s *Session) socketWriter(done, stop chan struct{}) {
 	defer s.Conn.Close()
 	defer close(done)
 
-	for msg := range s.writeMessageChan {
+	for {
+		s.Lock()
+		msg := s.pending
+		s.pending = nil
+		s.Unlock()
+		if msg == nil {
+			select {
+			case <-stop:
+				return
+			case m, ok := <-s.writeMessageChan:
+				if !ok {
+					log.Debug("writeMessageChan closed.")
+					return
+				}
+				msg = m
+			}
+		}
 		log.Debug("socket %s sending message", s.Id)
 		err := s.Conn.WriteMessage(msg.MessageType, msg.Body)
 		retryDelay := time.Millisecond * 25
@@ -151,9 +189,16 @@ func (s *Session) socketWriter(done chan struct{}) {
 			if retryDelay < time.Second {
 				retryDelay = retryDelay * 2
 			}
-			time.Sleep(retryDelay)
+			select {
+			case <-stop:
+				// keep the message for the next connection.
+				s.Lock()
+				s.pending = msg
+				s.Unlock()
+				return
+			case <-time.After(retryDelay):
+			}
 			err = s.Conn.WriteMessage(msg.MessageType, msg.Body)
 		}
 	}
-	log.Debug("writeMessageChan closed.")
 }
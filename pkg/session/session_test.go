@@ -0,0 +1,58 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/raintank/raintank-apps/pkg/message"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSession(t *testing.T) {
+	Convey("Given a session whose connection has failed", t, func() {
+		received := make(chan string, 10)
+		upgrader := websocket.Upgrader{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			sess := NewSession(conn, 10)
+			for _, event := range []string{"first", "second"} {
+				event := event
+				sess.On(event, func(body []byte) { received <- event })
+			}
+			go sess.Start()
+		}))
+		Reset(server.Close)
+		dial := func() *websocket.Conn {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			So(err, ShouldBeNil)
+			return conn
+		}
+
+		sess := NewSession(dial(), 10)
+		sess.Conn.Close()
+		So(sess.Emit(&message.Event{Event: "first", Payload: []byte("payload")}), ShouldBeNil)
+		sess.Start()
+
+		Convey("the message being sent is sent first on the next connection", func() {
+			sess.Conn = dial()
+			So(sess.Emit(&message.Event{Event: "second", Payload: []byte("payload")}), ShouldBeNil)
+			go sess.Start()
+			Reset(sess.Close)
+			for _, expected := range []string{"first", "second"} {
+				select {
+				case event := <-received:
+					So(event, ShouldEqual, expected)
+				case <-time.After(time.Second * 2):
+					So("message not received", ShouldBeEmpty)
+				}
+			}
+		})
+	})
+}
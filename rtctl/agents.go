@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+func agentsCmd(c *client.Client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		return listAgents(c, args)
+	case "show":
+		id, err := idArg(args)
+		if err != nil {
+			return err
+		}
+		agent, err := c.GetAgentById(id)
+		if err != nil {
+			return err
+		}
+		return showAgent(agent)
+	case "create", "update":
+		agent := new(model.AgentDTO)
+		if err := fileArg(cmd, args, agent); err != nil {
+			return err
+		}
+		var err error
+		if cmd == "create" {
+			err = c.AddAgent(agent)
+		} else {
+			err = c.UpdateAgent(agent)
+		}
+		if err != nil {
+			return err
+		}
+		return showAgent(agent)
+	case "delete":
+		id, err := idArg(args)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteAgent(&model.AgentDTO{Id: id}); err != nil {
+			return err
+		}
+		fmt.Printf("agent %d deleted\n", id)
+		return nil
+	}
+	return unknownCommand("agents", cmd)
+}
+
+func listAgents(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("agents list", flag.ExitOnError)
+	name := flags.String("name", "", "only list agents with this name")
+	metric := flags.String("metric", "", "only list agents providing this metric. may contain wildcards")
+	tag := flags.String("tag", "", "only list agents with this tag")
+	enabled := flags.String("enabled", "", "only list enabled (true) or disabled (false) agents")
+	flags.Parse(args)
+
+	q := model.GetAgentsQuery{
+		Name:    *name,
+		Metric:  *metric,
+		Enabled: *enabled,
+	}
+	if *tag != "" {
+		q.Tag = []string{*tag}
+	}
+	agents, err := c.GetAllAgents(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	return render(agents, func() {
+		rows := make([][]string, len(agents))
+		for i, a := range agents {
+			rows[i] = []string{
+				strconv.FormatInt(a.Id, 10),
+				a.Name,
+				strconv.FormatBool(a.Enabled),
+				strconv.FormatBool(a.Online),
+				strconv.FormatBool(a.Public),
+				strings.Join(a.Tags, ","),
+			}
+		}
+		printTable([]string{"ID", "NAME", "ENABLED", "ONLINE", "PUBLIC", "TAGS"}, rows)
+	})
+}
+
+func showAgent(a *model.AgentDTO) error {
+	return render(a, func() {
+		printFields([][2]string{
+			{"Id", strconv.FormatInt(a.Id, 10)},
+			{"Name", a.Name},
+			{"Enabled", fmt.Sprintf("%t (since %s)", a.Enabled, formatTime(a.EnabledChange))},
+			{"Online", fmt.Sprintf("%t (since %s)", a.Online, formatTime(a.OnlineChange))},
+			{"Public", strconv.FormatBool(a.Public)},
+			{"Tags", strings.Join(a.Tags, ",")},
+			{"Created", formatTime(a.Created)},
+			{"Updated", formatTime(a.Updated)},
+		})
+	})
+}
+
+// idArg returns the id that is the only argument.
+func idArg(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected an id")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", args[0])
+	}
+	return id, nil
+}
+
+// fileArg reads the file given with -f into v.
+func fileArg(cmd string, args []string, v interface{}) error {
+	flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+	file := flags.String("f", "", "YAML or JSON file. - reads from stdin")
+	flags.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+	return readFile(*file, v)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+// a taskPlan is the change needed to make a task match its definition.
+type taskPlan struct {
+	Action  string             `json:"action"`
+	Name    string             `json:"name"`
+	Id      int64              `json:"id,omitempty"`
+	Changes []model.TaskChange `json:"changes,omitempty"`
+	task    *model.TaskDTO
+}
+
+// applyTasks makes the tasks of the org match the definitions in a file.
+// Tasks are matched by name.
+func applyTasks(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("tasks apply", flag.ExitOnError)
+	file := flags.String("f", "", "YAML or JSON file holding a list of tasks. - reads from stdin")
+	dryRun := flags.Bool("dry-run", false, "only show the changes that would be made")
+	prune := flags.Bool("prune", false, "delete tasks that are not in the file")
+	flags.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+
+	desired := make([]*model.TaskDTO, 0)
+	if err := readFile(*file, &desired); err != nil {
+		return err
+	}
+	current, err := c.GetAllTasks(context.Background(), model.GetTasksQuery{})
+	if err != nil {
+		return err
+	}
+	plans, err := planTasks(current, desired, *prune)
+	if err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		if err := printJSON(plans); err != nil {
+			return err
+		}
+	} else {
+		printPlans(plans)
+	}
+	if *dryRun {
+		return nil
+	}
+
+	for _, p := range plans {
+		var err error
+		switch p.Action {
+		case "create":
+			err = c.AddTask(p.task)
+		case "update":
+			err = c.UpdateTask(p.task)
+		case "delete":
+			err = c.DeleteTask(p.task)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s task %s. %s", p.Action, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// planTasks works out the changes needed to make current match desired.
+// The whole plan is checked before any change is made, and every problem
+// found is returned in a single error, so that apply does not fail part
+// way through.
+func planTasks(current, desired []*model.TaskDTO, prune bool) ([]*taskPlan, error) {
+	problems := make([]string, 0)
+	byName := make(map[string]*model.TaskDTO)
+	for _, t := range current {
+		if _, ok := byName[t.Name]; ok {
+			problems = append(problems, fmt.Sprintf("there is more than one task named %q", t.Name))
+			continue
+		}
+		byName[t.Name] = t
+	}
+
+	plans := make([]*taskPlan, 0)
+	seen := make(map[string]bool)
+	for _, t := range desired {
+		if t.Name == "" {
+			problems = append(problems, "all tasks must have a name")
+			continue
+		}
+		if seen[t.Name] {
+			problems = append(problems, fmt.Sprintf("task %q is defined more than once", t.Name))
+			continue
+		}
+		seen[t.Name] = true
+		if t.Route == nil {
+			problems = append(problems, fmt.Sprintf("task %q has no route", t.Name))
+		} else if ok, err := t.Route.Validate(); !ok {
+			problems = append(problems, fmt.Sprintf("task %q has an invalid route. %s", t.Name, err))
+		}
+
+		existing, ok := byName[t.Name]
+		if !ok {
+			plans = append(plans, &taskPlan{Action: "create", Name: t.Name, task: t})
+			continue
+		}
+		t.Id = existing.Id
+		changes := existing.Diff(t)
+		if len(changes) == 0 {
+			plans = append(plans, &taskPlan{Action: "unchanged", Name: t.Name, Id: t.Id})
+			continue
+		}
+		if existing.ProvisionedBy != "" {
+			problems = append(problems, fmt.Sprintf("task %q is provisioned by %s and can not be updated", t.Name, existing.ProvisionedBy))
+		}
+		plans = append(plans, &taskPlan{Action: "update", Name: t.Name, Id: t.Id, Changes: changes, task: t})
+	}
+
+	if prune {
+		names := make([]string, 0)
+		for name, t := range byName {
+			// provisioned tasks are owned by their source, not the file.
+			if !seen[name] && t.ProvisionedBy == "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := byName[name]
+			plans = append(plans, &taskPlan{Action: "delete", Name: name, Id: t.Id, task: t})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, planError(problems)
+	}
+	return plans, nil
+}
+
+func planError(problems []string) error {
+	return fmt.Errorf("no changes made. the plan has %d problems:\n  %s", len(problems), strings.Join(problems, "\n  "))
+}
+
+func printPlans(plans []*taskPlan) {
+	symbols := map[string]string{
+		"create":    "+",
+		"update":    "~",
+		"delete":    "-",
+		"unchanged": " ",
+	}
+	counts := make(map[string]int)
+	for _, p := range plans {
+		counts[p.Action]++
+		fmt.Printf("%s task %s", symbols[p.Action], p.Name)
+		if p.Id != 0 {
+			fmt.Printf(" (id %d)", p.Id)
+		}
+		fmt.Println()
+		for _, c := range p.Changes {
+			fmt.Printf("    %s:\n      - %s\n      + %s\n", c.Field, c.Old, c.New)
+		}
+	}
+	fmt.Printf("\n%d to create, %d to update, %d to delete, %d unchanged\n", counts["create"], counts["update"], counts["delete"], counts["unchanged"])
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/client/clienttest"
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func planTestTask(id int64, name string, interval int64) *model.TaskDTO {
+	return &model.TaskDTO{
+		Id:       id,
+		Name:     name,
+		Interval: interval,
+		Enabled:  true,
+		Metrics:  map[string]int64{"/raintank/ping": 0},
+		Route:    &model.TaskRoute{Type: model.RouteAny},
+	}
+}
+
+func TestPlanTasks(t *testing.T) {
+	Convey("When planning task changes", t, func() {
+		current := func() []*model.TaskDTO {
+			return []*model.TaskDTO{
+				planTestTask(1, "a", 60),
+				planTestTask(2, "b", 60),
+				planTestTask(3, "c", 60),
+			}
+		}
+		// provisioned returns the current tasks with b owned by a
+		// provisioning source.
+		provisioned := func() []*model.TaskDTO {
+			tasks := current()
+			tasks[1].ProvisionedBy = "file:/etc/tasks"
+			return tasks
+		}
+		cases := []struct {
+			name    string
+			current []*model.TaskDTO
+			desired []*model.TaskDTO
+			prune   bool
+			actions []string
+			// problems are the problems the plan is expected to fail with.
+			problems []string
+		}{
+			{
+				name:    "new tasks are created",
+				current: current(),
+				desired: []*model.TaskDTO{planTestTask(0, "d", 60)},
+				actions: []string{"create d"},
+			},
+			{
+				name:    "matching tasks are unchanged",
+				current: current(),
+				desired: []*model.TaskDTO{planTestTask(0, "a", 60), planTestTask(0, "b", 60)},
+				actions: []string{"unchanged a 1", "unchanged b 2"},
+			},
+			{
+				name:    "changed tasks are updated",
+				current: current(),
+				desired: []*model.TaskDTO{planTestTask(0, "b", 30)},
+				actions: []string{"update b 2 interval"},
+			},
+			{
+				name:    "tasks not in the file are kept without prune",
+				current: current(),
+				desired: []*model.TaskDTO{planTestTask(0, "b", 60)},
+				actions: []string{"unchanged b 2"},
+			},
+			{
+				name:    "tasks not in the file are deleted with prune",
+				current: current(),
+				desired: []*model.TaskDTO{planTestTask(0, "b", 60)},
+				prune:   true,
+				actions: []string{"unchanged b 2", "delete a 1", "delete c 3"},
+			},
+			{
+				name:     "tasks defined twice are an error",
+				current:  current(),
+				desired:  []*model.TaskDTO{planTestTask(0, "d", 60), planTestTask(0, "d", 30)},
+				problems: []string{`task "d" is defined more than once`},
+			},
+			{
+				name:     "existing tasks sharing a name are an error",
+				current:  append(current(), planTestTask(4, "a", 30)),
+				desired:  []*model.TaskDTO{planTestTask(0, "b", 60)},
+				problems: []string{`there is more than one task named "a"`},
+			},
+			{
+				name:     "tasks without a name are an error",
+				current:  current(),
+				desired:  []*model.TaskDTO{planTestTask(0, "", 60)},
+				problems: []string{"all tasks must have a name"},
+			},
+			{
+				name:    "every problem is reported at once",
+				current: append(current(), planTestTask(4, "a", 30)),
+				desired: []*model.TaskDTO{planTestTask(0, "", 60), planTestTask(0, "d", 60), planTestTask(0, "d", 30)},
+				problems: []string{
+					`there is more than one task named "a"`,
+					"all tasks must have a name",
+					`task "d" is defined more than once`,
+				},
+			},
+			{
+				name:    "tasks with invalid routes are an error",
+				current: current(),
+				desired: []*model.TaskDTO{{Name: "d", Interval: 60, Route: &model.TaskRoute{Type: "bogus"}}, {Name: "e", Interval: 60}},
+				problems: []string{
+					fmt.Sprintf(`task "d" has an invalid route. %s`, model.UnknownRouteType),
+					`task "e" has no route`,
+				},
+			},
+			{
+				name:     "provisioned tasks can not be updated",
+				current:  provisioned(),
+				desired:  []*model.TaskDTO{planTestTask(0, "b", 30)},
+				problems: []string{`task "b" is provisioned by file:/etc/tasks and can not be updated`},
+			},
+			{
+				name:    "unchanged provisioned tasks are allowed",
+				current: provisioned(),
+				desired: []*model.TaskDTO{planTestTask(0, "b", 60)},
+				actions: []string{"unchanged b 2"},
+			},
+			{
+				name:    "provisioned tasks are not pruned",
+				current: provisioned(),
+				desired: []*model.TaskDTO{planTestTask(0, "a", 60)},
+				prune:   true,
+				actions: []string{"unchanged a 1", "delete c 3"},
+			},
+		}
+		for _, c := range cases {
+			Convey(c.name, func() {
+				plans, err := planTasks(c.current, c.desired, c.prune)
+				if len(c.problems) > 0 {
+					So(plans, ShouldBeNil)
+					So(err, ShouldResemble, planError(c.problems))
+					return
+				}
+				So(err, ShouldBeNil)
+				actions := make([]string, len(plans))
+				for i, p := range plans {
+					actions[i] = p.Action + " " + p.Name
+					if p.Id != 0 {
+						actions[i] += fmt.Sprintf(" %d", p.Id)
+					}
+					for _, change := range p.Changes {
+						actions[i] += " " + change.Field
+					}
+				}
+				So(actions, ShouldResemble, c.actions)
+			})
+		}
+
+		Convey("updates keep the id of the existing task", func() {
+			desired := planTestTask(0, "b", 30)
+			plans, err := planTasks(current(), []*model.TaskDTO{desired}, false)
+			So(err, ShouldBeNil)
+			So(plans[0].task, ShouldEqual, desired)
+			So(desired.Id, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestApplyTasks(t *testing.T) {
+	Convey("Given more than a page of tasks with several metrics", t, func() {
+		s := clienttest.NewServer()
+		Reset(s.Close)
+		metrics := []*model.Metric{
+			{Namespace: "/raintank/ping", Version: 1},
+			{Namespace: "/raintank/dns", Version: 1},
+		}
+		agent := s.AddAgent(clienttest.DefaultOrgId, &model.AgentDTO{Name: "probe1", Enabled: true})
+		So(s.SetAgentMetrics(agent.Id, metrics), ShouldBeNil)
+
+		desired := make([]*model.TaskDTO, 0)
+		for i := 0; i <= client.PageSize; i++ {
+			task := planTestTask(0, fmt.Sprintf("task%03d", i), 60)
+			task.Metrics = map[string]int64{"/raintank/ping": 1, "/raintank/dns": 1}
+			s.AddTask(clienttest.DefaultOrgId, task)
+			desired = append(desired, planTestTask(0, task.Name, 60))
+			desired[i].Metrics = task.Metrics
+		}
+
+		Convey("tasks past the first page are updated, not created", func() {
+			desired[client.PageSize].Interval = 30
+			dir, err := ioutil.TempDir("", "rtctl")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			file := filepath.Join(dir, "tasks.json")
+			body, err := json.Marshal(desired)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(file, body, 0644), ShouldBeNil)
+
+			So(applyTasks(s.NewClient(), []string{"-f", file}), ShouldBeNil)
+			tasks := s.Tasks()
+			So(tasks, ShouldHaveLength, client.PageSize+1)
+			So(tasks[client.PageSize].Interval, ShouldEqual, 30)
+		})
+	})
+}
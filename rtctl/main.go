@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/rakyll/globalconf"
+)
+
+var (
+	GitHash     = "(none)"
+	showVersion = flag.Bool("version", false, "print version string")
+	confFile    = flag.String("config", filepath.Join(os.Getenv("HOME"), ".rtctl.ini"), "configuration file path")
+
+	serverUrl = flag.String("url", "http://localhost:80", "task-server address")
+	apiKey    = flag.String("api-key", "", "API key")
+	insecure  = flag.Bool("insecure", false, "do not verify the task-server TLS certificate")
+	timeout   = flag.Duration("timeout", client.DefaultTimeout, "timeout for requests to the task-server")
+	output    = flag.String("output", "table", "output format. table|json")
+)
+
+// envPrefix is the prefix of environment variables that set flags, eg.
+// RTCTL_API_KEY sets -api-key.
+const envPrefix = "RTCTL_"
+
+// a resource handles the commands for one type of object.
+type resource struct {
+	usage string
+	run   func(c *client.Client, cmd string, args []string) error
+}
+
+var resources map[string]*resource
+
+func init() {
+	resources = map[string]*resource{
+		"agents": {
+			usage: "list|show <id>|create -f <file>|update -f <file>|delete <id>",
+			run:   agentsCmd,
+		},
+		"tasks": {
+			usage: "list|show <id>|create -f <file>|update -f <file>|delete <id>|apply -f <file>",
+			run:   tasksCmd,
+		},
+		"metrics": {
+			usage: "list|show <namespace>",
+			run:   metricsCmd,
+		},
+		"sessions": {
+			usage: "list|tail",
+			run:   sessionsCmd,
+		},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <resource> <command> [args]\n\nResources:\n", os.Args[0])
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, resources[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nOptions can also be set in the config file, or with %s<OPTION> environment variables.\n\nOptions:\n", envPrefix)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("rtctl (built with %s, git hash %s)\n", runtime.Version(), GitHash)
+		return
+	}
+
+	// Only try and parse the conf file if it exists
+	if _, err := os.Stat(*confFile); err == nil {
+		conf, err := globalconf.NewWithOptions(&globalconf.Options{Filename: *confFile, EnvPrefix: envPrefix})
+		if err != nil {
+			fatal(fmt.Errorf("error with configuration file: %s", err))
+		}
+		conf.ParseAll()
+	} else {
+		parseEnv()
+	}
+
+	if *output != "table" && *output != "json" {
+		fatal(fmt.Errorf("invalid output format %q", *output))
+	}
+
+	args := flag.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	r, ok := resources[args[0]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	c, err := client.New(*serverUrl, *apiKey, *insecure)
+	if err != nil {
+		fatal(err)
+	}
+	c.SetTimeout(*timeout)
+
+	if err := r.run(c, args[1], args[2:]); err != nil {
+		fatal(err)
+	}
+}
+
+// parseEnv sets flags that were not given on the command line from
+// environment variables.
+func parseEnv() {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if value, ok := os.LookupEnv(name); ok {
+			if err := f.Value.Set(value); err != nil {
+				fatal(fmt.Errorf("invalid value for %s. %s", name, err))
+			}
+		}
+	})
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	os.Exit(1)
+}
+
+func unknownCommand(resource, cmd string) error {
+	return fmt.Errorf("unknown %s command %q. usage: %s %s", resource, cmd, resource, resources[resource].usage)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+// metrics are published by agents, so they can not be created or changed
+// with the API.
+func metricsCmd(c *client.Client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		q := model.GetMetricsQuery{}
+		if len(args) > 0 {
+			q.Namespace = args[0]
+		}
+		metrics, err := c.GetAllMetrics(context.Background(), q)
+		if err != nil {
+			return err
+		}
+		return render(metrics, func() {
+			rows := make([][]string, len(metrics))
+			for i, m := range metrics {
+				rows[i] = []string{m.Namespace, strconv.FormatInt(m.Version, 10), strconv.FormatBool(m.Public)}
+			}
+			printTable([]string{"NAMESPACE", "VERSION", "PUBLIC"}, rows)
+		})
+	case "show":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a metric namespace")
+		}
+		metrics, err := c.GetAllMetrics(context.Background(), model.GetMetricsQuery{Namespace: args[0]})
+		if err != nil {
+			return err
+		}
+		if len(metrics) == 0 {
+			return client.ErrNotFound
+		}
+		return render(metrics, func() {
+			for i, m := range metrics {
+				if i > 0 {
+					fmt.Println()
+				}
+				printFields([][2]string{
+					{"Namespace", m.Namespace},
+					{"Version", strconv.FormatInt(m.Version, 10)},
+					{"Public", strconv.FormatBool(m.Public)},
+					{"Created", formatTime(m.Created)},
+				})
+				rows := make([][]string, 0)
+				for _, table := range m.Policy {
+					rows = append(rows, []string{table.Name, table.Type, strconv.FormatBool(table.Required), formatJSON(table.Default)})
+				}
+				if len(rows) > 0 {
+					fmt.Println()
+					printTable([]string{"CONFIG", "TYPE", "REQUIRED", "DEFAULT"}, rows)
+				}
+			}
+		})
+	}
+	return unknownCommand("metrics", cmd)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+// printTable writes rows to stdout in aligned columns.
+func printTable(header []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// printFields writes name: value pairs to stdout.
+func printFields(fields [][2]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s:\t%s\n", f[0], f[1])
+	}
+	w.Flush()
+}
+
+// render writes v as JSON, or using table if the output format is table.
+func render(v interface{}, table func()) error {
+	if *output == "json" {
+		return printJSON(v)
+	}
+	table()
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatJSON(v interface{}) string {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(body)
+}
+
+// readFile decodes a YAML or JSON file into v.  "-" reads stdin.
+func readFile(path string, v interface{}) error {
+	var body []byte
+	var err error
+	if path == "-" {
+		body, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		body, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(body, v)
+	default:
+		// YAML is a superset of JSON, so this handles stdin either way.
+		err = yaml.Unmarshal(body, v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s. %s", path, err)
+	}
+	return nil
+}
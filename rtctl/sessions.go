@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+func sessionsCmd(c *client.Client, cmd string, args []string) error {
+	flags := flag.NewFlagSet("sessions "+cmd, flag.ExitOnError)
+	agentId := flags.Int64("agent", 0, "only show sessions of this agent id")
+	server := flags.String("server", "", "only show sessions connected to this task-server")
+	interval := flags.Duration("interval", time.Second*5, "how often to poll for changes when tailing")
+	flags.Parse(args)
+	q := &model.GetAgentSessionsQuery{
+		AgentId: *agentId,
+		Server:  *server,
+	}
+
+	switch cmd {
+	case "list":
+		sessions, err := c.GetAgentSessions(q)
+		if err != nil {
+			return err
+		}
+		return render(sessions, func() {
+			rows := make([][]string, len(sessions))
+			for i, s := range sessions {
+				rows[i] = sessionRow(s)
+			}
+			printTable(sessionHeader, rows)
+		})
+	case "tail":
+		return tailSessions(c, q, *interval)
+	}
+	return unknownCommand("sessions", cmd)
+}
+
+var sessionHeader = []string{"AGENT", "SESSION", "SERVER", "REMOTE IP", "VERSION", "CONNECTED"}
+
+func sessionRow(s model.AgentSession) []string {
+	return []string{
+		strconv.FormatInt(s.AgentId, 10),
+		s.Id,
+		s.Server,
+		s.RemoteIp,
+		strconv.FormatInt(s.Version, 10),
+		formatTime(s.Created),
+	}
+}
+
+// tailSessions polls the session list and prints sessions as they connect
+// and disconnect.  It runs until interrupted.
+func tailSessions(c *client.Client, q *model.GetAgentSessionsQuery, interval time.Duration) error {
+	known := make(map[string]model.AgentSession)
+	first := true
+	for {
+		sessions, err := c.GetAgentSessions(q)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]model.AgentSession)
+		for _, s := range sessions {
+			current[s.Id] = s
+			if _, ok := known[s.Id]; !ok {
+				printSessionEvent("connected", s, first)
+			}
+		}
+		for id, s := range known {
+			if _, ok := current[id]; !ok {
+				printSessionEvent("disconnected", s, false)
+			}
+		}
+		known = current
+		first = false
+		time.Sleep(interval)
+	}
+}
+
+func printSessionEvent(action string, s model.AgentSession, initial bool) {
+	if initial {
+		action = "existing"
+	}
+	if *output == "json" {
+		printJSON(map[string]interface{}{
+			"action":  action,
+			"time":    time.Now(),
+			"session": s,
+		})
+		return
+	}
+	fmt.Printf("%s %-12s agent=%d session=%s server=%s remoteIp=%s version=%d\n",
+		time.Now().Format("15:04:05"), action, s.AgentId, s.Id, s.Server, s.RemoteIp, s.Version)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+func tasksCmd(c *client.Client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		return listTasks(c, args)
+	case "show":
+		id, err := idArg(args)
+		if err != nil {
+			return err
+		}
+		task, err := c.GetTaskById(id)
+		if err != nil {
+			return err
+		}
+		return showTask(task)
+	case "create", "update":
+		task := new(model.TaskDTO)
+		if err := fileArg(cmd, args, task); err != nil {
+			return err
+		}
+		var err error
+		if cmd == "create" {
+			err = c.AddTask(task)
+		} else {
+			err = c.UpdateTask(task)
+		}
+		if err != nil {
+			return err
+		}
+		return showTask(task)
+	case "delete":
+		id, err := idArg(args)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteTask(&model.TaskDTO{Id: id}); err != nil {
+			return err
+		}
+		fmt.Printf("task %d deleted\n", id)
+		return nil
+	case "apply":
+		return applyTasks(c, args)
+	}
+	return unknownCommand("tasks", cmd)
+}
+
+func listTasks(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("tasks list", flag.ExitOnError)
+	name := flags.String("name", "", "only list tasks with this name")
+	metric := flags.String("metric", "", "only list tasks collecting this metric")
+	enabled := flags.String("enabled", "", "only list enabled (true) or disabled (false) tasks")
+	flags.Parse(args)
+
+	q := model.GetTasksQuery{
+		Name:    *name,
+		Metric:  *metric,
+		Enabled: *enabled,
+	}
+	tasks, err := c.GetAllTasks(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	return render(tasks, func() {
+		rows := make([][]string, len(tasks))
+		for i, t := range tasks {
+			rows[i] = []string{
+				strconv.FormatInt(t.Id, 10),
+				t.Name,
+				strconv.FormatInt(t.Interval, 10),
+				strconv.FormatBool(t.Enabled),
+				formatRoute(t.Route),
+				strings.Join(metricNames(t), ","),
+			}
+		}
+		printTable([]string{"ID", "NAME", "INTERVAL", "ENABLED", "ROUTE", "METRICS"}, rows)
+	})
+}
+
+func showTask(t *model.TaskDTO) error {
+	return render(t, func() {
+		printFields([][2]string{
+			{"Id", strconv.FormatInt(t.Id, 10)},
+			{"Name", t.Name},
+			{"Interval", strconv.FormatInt(t.Interval, 10)},
+			{"Enabled", strconv.FormatBool(t.Enabled)},
+			{"Route", formatRoute(t.Route)},
+			{"Metrics", formatJSON(t.Metrics)},
+			{"Config", formatJSON(t.Config)},
+			{"Created", formatTime(t.Created)},
+			{"Updated", formatTime(t.Updated)},
+		})
+	})
+}
+
+func formatRoute(r *model.TaskRoute) string {
+	if r == nil {
+		return "-"
+	}
+	if len(r.Config) == 0 {
+		return string(r.Type)
+	}
+	return fmt.Sprintf("%s %s", r.Type, formatJSON(r.Config))
+}
+
+func metricNames(t *model.TaskDTO) []string {
+	names := make([]string, 0, len(t.Metrics))
+	for name := range t.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,225 @@
+package builtin
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/codeskyblue/go-uuid"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-agent/executor"
+	"github.com/raintank/raintank-apps/task-agent/publisher"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-metric/schema"
+)
+
+// make sure that we actually satisfy the Executor interface
+var _ executor.Executor = (*Executor)(nil)
+
+// Executor runs tasks using the registered Collectors and publishes the
+// results directly to the tsdb /metrics endpoint, so that no snap daemon is
+// needed.
+type Executor struct {
+	sync.RWMutex
+	NodeName  string
+	TsdbAddr  string
+	ApiKey    string
+	tasks     map[string]*runningTask
+	resync    chan struct{}
+	publisher *publisher.Publisher
+}
+
+type runningTask struct {
+	sync.Mutex
+	state    rbody.ScheduledTask
+	task     *model.TaskDTO
+	shutdown chan struct{}
+}
+
+func NewExecutor(nodeName, tsdbAddr, apiKey string) *Executor {
+	return &Executor{
+		NodeName:  nodeName,
+		TsdbAddr:  tsdbAddr,
+		ApiKey:    apiKey,
+		tasks:     make(map[string]*runningTask),
+		resync:    make(chan struct{}),
+		publisher: publisher.New(tsdbAddr, apiKey),
+	}
+}
+
+func (e *Executor) Run() {
+	log.Info("running builtin executor with %d collectors.", len(registeredCollectors()))
+	// there is nothing to connect to, so the task list can be indexed
+	// straight away.
+	go func() {
+		e.resync <- struct{}{}
+	}()
+}
+
+// Connected is always true as the builtin executor has no external
+// dependencies.
+func (e *Executor) Connected() bool {
+	return true
+}
+
+func (e *Executor) Reconfigure(tsdbAddr, apiKey string) error {
+	e.Lock()
+	e.TsdbAddr = tsdbAddr
+	e.ApiKey = apiKey
+	e.publisher = publisher.New(tsdbAddr, apiKey)
+	e.Unlock()
+	return nil
+}
+
+func (e *Executor) Resync() <-chan struct{} {
+	return e.resync
+}
+
+func (e *Executor) Catalog() ([]*rbody.Metric, error) {
+	catalog := make([]*rbody.Metric, 0)
+	for _, c := range registeredCollectors() {
+		catalog = append(catalog, c.Catalog()...)
+	}
+	return catalog, nil
+}
+
+func (e *Executor) ListTasks() ([]*rbody.ScheduledTask, error) {
+	e.RLock()
+	defer e.RUnlock()
+	tasks := make([]*rbody.ScheduledTask, 0, len(e.tasks))
+	for _, t := range e.tasks {
+		t.Lock()
+		state := t.state
+		t.Unlock()
+		tasks = append(tasks, &state)
+	}
+	return tasks, nil
+}
+
+func (e *Executor) CreateTask(task *model.TaskDTO, name string) (*rbody.ScheduledTask, error) {
+	if task.Interval <= 0 {
+		return nil, fmt.Errorf("invalid task interval %d", task.Interval)
+	}
+	for ns := range task.Metrics {
+		if len(collectorsFor(ns)) == 0 {
+			return nil, fmt.Errorf("no collector provides %s", ns)
+		}
+	}
+	t := &runningTask{
+		state: rbody.ScheduledTask{
+			ID:                uuid.NewRandom().String(),
+			Name:              name,
+			CreationTimestamp: time.Now().Unix(),
+			State:             "Running",
+		},
+		task:     task,
+		shutdown: make(chan struct{}),
+	}
+	e.Lock()
+	if existing, ok := e.tasks[name]; ok {
+		close(existing.shutdown)
+	}
+	e.tasks[name] = t
+	e.Unlock()
+
+	state := t.state
+	go e.runTask(t)
+	return &state, nil
+}
+
+func (e *Executor) RemoveTask(task *rbody.ScheduledTask) error {
+	e.Lock()
+	defer e.Unlock()
+	t, ok := e.tasks[task.Name]
+	if !ok || t.state.ID != task.ID {
+		return fmt.Errorf("task %s not found", task.ID)
+	}
+	close(t.shutdown)
+	delete(e.tasks, task.Name)
+	return nil
+}
+
+func (e *Executor) runTask(t *runningTask) {
+	ticker := time.NewTicker(time.Duration(t.task.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.shutdown:
+			return
+		case ts := <-ticker.C:
+			err := e.collect(t.task, ts)
+			t.Lock()
+			t.state.LastRunTimestamp = ts.Unix()
+			if err != nil {
+				log.Error(3, "task %s failed. %s", t.state.Name, err)
+				t.state.FailedCount++
+				t.state.LastFailureMessage = err.Error()
+			} else {
+				t.state.HitCount++
+			}
+			t.Unlock()
+		}
+	}
+}
+
+func (e *Executor) collect(task *model.TaskDTO, ts time.Time) error {
+	namespaces := make(map[Collector][]string)
+	for ns := range task.Metrics {
+		for _, c := range collectorsFor(ns) {
+			namespaces[c] = append(namespaces[c], ns)
+		}
+	}
+	metrics := make([]*schema.MetricData, 0)
+	for c, nsList := range namespaces {
+		config := make(map[string]interface{})
+		for _, ns := range nsList {
+			for k, v := range task.Config[ns] {
+				config[k] = v
+			}
+		}
+		m, err := c.Collect(nsList, config)
+		if err != nil {
+			return fmt.Errorf("collector %s failed. %s", c.Name(), err)
+		}
+		metrics = append(metrics, m...)
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	for _, m := range metrics {
+		if m.OrgId == 0 {
+			m.OrgId = int(task.OrgId)
+		}
+		if m.Interval == 0 {
+			m.Interval = int(task.Interval)
+		}
+		if m.Time == 0 {
+			m.Time = ts.Unix()
+		}
+		if m.TargetType == "" {
+			m.TargetType = "gauge"
+		}
+		m.SetId()
+	}
+	e.RLock()
+	p := e.publisher
+	e.RUnlock()
+	return p.Publish(metrics)
+}
+
+// collectorsFor returns the collectors providing a metric that matches the
+// task namespace, which may contain "*" wildcards.
+func collectorsFor(namespace string) []Collector {
+	matched := make([]Collector, 0)
+	for _, c := range registeredCollectors() {
+		for _, m := range c.Catalog() {
+			if ok, _ := path.Match(namespace, m.Namespace); ok {
+				matched = append(matched, c)
+				break
+			}
+		}
+	}
+	return matched
+}
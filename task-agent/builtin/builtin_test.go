@@ -0,0 +1,207 @@
+package builtin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-metric/msg"
+	"github.com/raintank/raintank-metric/schema"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() {
+	Register(testCollector{})
+}
+
+// testCollector returns one metric per namespace, with the "value" config
+// option as its value.
+type testCollector struct{}
+
+func (c testCollector) Name() string {
+	return "test"
+}
+
+func (c testCollector) Catalog() []*rbody.Metric {
+	return []*rbody.Metric{
+		{Namespace: "/testing/builtin/a", Version: 1},
+		{Namespace: "/testing/builtin/b", Version: 1},
+	}
+}
+
+func (c testCollector) Collect(namespaces []string, config map[string]interface{}) ([]*schema.MetricData, error) {
+	value, _ := config["value"].(float64)
+	metrics := make([]*schema.MetricData, len(namespaces))
+	for i, ns := range namespaces {
+		metrics[i] = &schema.MetricData{Name: ns, Metric: ns, Value: value}
+	}
+	return metrics, nil
+}
+
+// tsdbServer stands in for the tsdb /metrics endpoint.
+type tsdbServer struct {
+	sync.Mutex
+	*httptest.Server
+	status   int
+	apiKeys  []string
+	received chan []*schema.MetricData
+}
+
+func newTsdbServer() *tsdbServer {
+	s := &tsdbServer{status: 200, received: make(chan []*schema.MetricData, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/metrics" {
+			w.WriteHeader(404)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		metricData := new(msg.MetricData)
+		if err := metricData.InitFromMsg(body); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		if err := metricData.DecodeMetricData(); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		s.Lock()
+		s.apiKeys = append(s.apiKeys, r.Header.Get("Authorization"))
+		status := s.status
+		s.Unlock()
+		w.WriteHeader(status)
+		if status == 200 {
+			s.received <- metricData.Metrics
+		}
+	}))
+	return s
+}
+
+func (s *tsdbServer) setStatus(status int) {
+	s.Lock()
+	s.status = status
+	s.Unlock()
+}
+
+func newTestTask(namespaces ...string) *model.TaskDTO {
+	task := &model.TaskDTO{
+		Id:       1,
+		Name:     "task1",
+		OrgId:    3,
+		Interval: 1,
+		Metrics:  make(map[string]int64),
+		Config: map[string]map[string]interface{}{
+			"/testing/builtin/*": {"value": 42.0},
+		},
+		Route:   &model.TaskRoute{Type: model.RouteAny},
+		Enabled: true,
+	}
+	for _, ns := range namespaces {
+		task.Metrics[ns] = 1
+	}
+	return task
+}
+
+// waitForTask waits up to 3 seconds for the only task of e to satisfy ok,
+// and returns it.  nil is returned if it never does.
+func waitForTask(e *Executor, ok func(*rbody.ScheduledTask) bool) *rbody.ScheduledTask {
+	deadline := time.Now().Add(time.Second * 3)
+	for time.Now().Before(deadline) {
+		tasks, _ := e.ListTasks()
+		if len(tasks) == 1 && ok(tasks[0]) {
+			return tasks[0]
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	return nil
+}
+
+func TestExecutor(t *testing.T) {
+	Convey("Given a builtin executor publishing to tsdb", t, func() {
+		tsdb := newTsdbServer()
+		Reset(tsdb.Close)
+		e := NewExecutor("test-agent", tsdb.URL, "test-key")
+
+		Convey("the catalog includes the registered collectors", func() {
+			catalog, err := e.Catalog()
+			So(err, ShouldBeNil)
+			namespaces := make(map[string]bool)
+			for _, m := range catalog {
+				namespaces[m.Namespace] = true
+			}
+			So(namespaces["/testing/builtin/a"], ShouldBeTrue)
+			So(namespaces["/raintank/agent/runtime/goroutines"], ShouldBeTrue)
+		})
+
+		Convey("tasks for metrics no collector provides are rejected", func() {
+			_, err := e.CreateTask(newTestTask("/testing/unknown"), "task1")
+			So(err, ShouldNotBeNil)
+			tasks, err := e.ListTasks()
+			So(err, ShouldBeNil)
+			So(tasks, ShouldHaveLength, 0)
+		})
+
+		Convey("collected metrics are completed and posted to /metrics", func() {
+			ts := time.Unix(1460000000, 0)
+			err := e.collect(newTestTask("/testing/builtin/*", "/raintank/agent/runtime/goroutines"), ts)
+			So(err, ShouldBeNil)
+
+			var metrics []*schema.MetricData
+			select {
+			case metrics = <-tsdb.received:
+			case <-time.After(time.Second):
+			}
+			So(metrics, ShouldHaveLength, 3)
+			for _, m := range metrics {
+				So(m.OrgId, ShouldEqual, 3)
+				So(m.Interval, ShouldEqual, 1)
+				So(m.Time, ShouldEqual, ts.Unix())
+				So(m.TargetType, ShouldEqual, "gauge")
+				if m.Name != "raintank.agent.runtime.goroutines" {
+					So(m.Value, ShouldEqual, 42)
+				}
+			}
+			So(tsdb.apiKeys, ShouldResemble, []string{"Bearer test-key"})
+		})
+
+		Convey("scheduled tasks publish every interval until removed", func() {
+			state, err := e.CreateTask(newTestTask("/testing/builtin/a"), "task1")
+			So(err, ShouldBeNil)
+			So(state.State, ShouldEqual, "Running")
+
+			for i := 0; i < 2; i++ {
+				var metrics []*schema.MetricData
+				select {
+				case metrics = <-tsdb.received:
+				case <-time.After(time.Second * 3):
+				}
+				So(metrics, ShouldHaveLength, 1)
+				So(metrics[0].Name, ShouldEqual, "/testing/builtin/a")
+			}
+			task := waitForTask(e, func(t *rbody.ScheduledTask) bool { return t.HitCount >= 2 })
+			So(task, ShouldNotBeNil)
+			So(task.FailedCount, ShouldEqual, 0)
+
+			So(e.RemoveTask(state), ShouldBeNil)
+			tasks, err := e.ListTasks()
+			So(err, ShouldBeNil)
+			So(tasks, ShouldHaveLength, 0)
+		})
+
+		Convey("failed publishes are recorded on the task", func() {
+			tsdb.setStatus(500)
+			state, err := e.CreateTask(newTestTask("/testing/builtin/a"), "task1")
+			So(err, ShouldBeNil)
+			Reset(func() { e.RemoveTask(state) })
+
+			task := waitForTask(e, func(t *rbody.ScheduledTask) bool { return t.FailedCount > 0 })
+			So(task, ShouldNotBeNil)
+			So(task.HitCount, ShouldEqual, 0)
+			So(task.LastFailureMessage, ShouldContainSubstring, "500")
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package builtin
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-metric/schema"
+)
+
+// Collector gathers metrics in-process for the builtin executor.
+type Collector interface {
+	// Name uniquely identifies the collector.
+	Name() string
+	// Catalog returns the metrics the collector provides.  Tasks are
+	// matched against the catalog namespaces.
+	Catalog() []*rbody.Metric
+	// Collect gathers the metrics matching namespaces using the task
+	// config for this collector.  OrgId, Interval and Time are filled in by
+	// the executor if they are not set.
+	Collect(namespaces []string, config map[string]interface{}) ([]*schema.MetricData, error)
+}
+
+var (
+	collectorsLock sync.RWMutex
+	collectors     = make(map[string]Collector)
+)
+
+// Register makes a collector available to the builtin executor.  It is
+// intended to be called from the init() function of collector packages.
+func Register(c Collector) {
+	collectorsLock.Lock()
+	defer collectorsLock.Unlock()
+	if _, ok := collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("collector %s already registered", c.Name()))
+	}
+	collectors[c.Name()] = c
+}
+
+func registeredCollectors() []Collector {
+	collectorsLock.RLock()
+	defer collectorsLock.RUnlock()
+	list := make([]Collector, 0, len(collectors))
+	for _, c := range collectors {
+		list = append(list, c)
+	}
+	return list
+}
@@ -0,0 +1,84 @@
+package builtin
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-metric/schema"
+)
+
+func init() {
+	Register(new(RuntimeCollector))
+}
+
+var runtimeMetrics = []struct {
+	namespace string
+	unit      string
+	desc      string
+	value     func(m *runtime.MemStats) float64
+}{
+	{"/raintank/agent/runtime/goroutines", "goroutines", "number of running goroutines",
+		func(m *runtime.MemStats) float64 { return float64(runtime.NumGoroutine()) }},
+	{"/raintank/agent/runtime/memory/alloc", "bytes", "bytes of allocated heap objects",
+		func(m *runtime.MemStats) float64 { return float64(m.Alloc) }},
+	{"/raintank/agent/runtime/memory/sys", "bytes", "bytes of memory obtained from the OS",
+		func(m *runtime.MemStats) float64 { return float64(m.Sys) }},
+	{"/raintank/agent/runtime/gc/count", "gcs", "number of completed GC cycles",
+		func(m *runtime.MemStats) float64 { return float64(m.NumGC) }},
+}
+
+// RuntimeCollector reports the goroutine count and memory usage of the
+// task-agent itself.  It takes no config.
+type RuntimeCollector struct{}
+
+func (c *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+func (c *RuntimeCollector) Catalog() []*rbody.Metric {
+	catalog := make([]*rbody.Metric, len(runtimeMetrics))
+	for i, m := range runtimeMetrics {
+		catalog[i] = &rbody.Metric{
+			Namespace:   m.namespace,
+			Version:     1,
+			Description: m.desc,
+			Unit:        m.unit,
+		}
+	}
+	return catalog
+}
+
+func (c *RuntimeCollector) Collect(namespaces []string, config map[string]interface{}) ([]*schema.MetricData, error) {
+	stats := new(runtime.MemStats)
+	runtime.ReadMemStats(stats)
+	metrics := make([]*schema.MetricData, 0)
+	for _, m := range runtimeMetrics {
+		if !matchAny(namespaces, m.namespace) {
+			continue
+		}
+		name := strings.Replace(strings.TrimPrefix(m.namespace, "/"), "/", ".", -1)
+		metrics = append(metrics, &schema.MetricData{
+			Name:   name,
+			Metric: name,
+			Value:  m.value(stats),
+			Unit:   m.unit,
+		})
+	}
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no runtime metrics match %v", namespaces)
+	}
+	return metrics, nil
+}
+
+// matchAny returns true if namespace matches any of the patterns.
+func matchAny(patterns []string, namespace string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package executor
+
+import (
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// Executor runs the tasks the agent receives from the task-server.  Tasks
+// are identified by name and reported using the snap REST types so that
+// all executors can be reconciled in the same way.
+type Executor interface {
+	// CreateTask starts running task under the given name.
+	CreateTask(task *model.TaskDTO, name string) (*rbody.ScheduledTask, error)
+	// RemoveTask stops and removes a running task.
+	RemoveTask(task *rbody.ScheduledTask) error
+	// ListTasks returns all tasks currently known to the executor.
+	ListTasks() ([]*rbody.ScheduledTask, error)
+	// Catalog returns the metrics that the executor can collect.
+	Catalog() ([]*rbody.Metric, error)
+	// Run starts any background processing needed by the executor.
+	Run()
+	// Connected reports whether the executor is currently able to run
+	// tasks.
+	Connected() bool
+	// Reconfigure changes the tsdb address and API key that metrics are
+	// published with.  Tasks created before the change may need to be
+	// recreated to pick it up.
+	Reconfigure(tsdbAddr, apiKey string) error
+	// Resync receives a value whenever the executor's task list needs to
+	// be reconciled with the agent's task list.
+	Resync() <-chan struct{}
+}
@@ -1,26 +1,25 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"net/http"
+	"math/rand"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
 	"runtime"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/grafana/grafana/pkg/log"
-	"github.com/raintank/raintank-apps/pkg/message"
-	"github.com/raintank/raintank-apps/pkg/session"
+	"github.com/raintank/raintank-apps/pkg/config"
+	"github.com/raintank/raintank-apps/task-agent/builtin"
+	"github.com/raintank/raintank-apps/task-agent/executor"
 	"github.com/raintank/raintank-apps/task-agent/snap"
+	"github.com/raintank/raintank-apps/task-server/agentclient"
 	"github.com/rakyll/globalconf"
 )
 
-const Version int = 1
+const Version int = 2
 
 var (
 	GitHash     = "(none)"
@@ -28,23 +27,31 @@ var (
 	logLevel    = flag.Int("log-level", 2, "log level. 0=TRACE|1=DEBUG|2=INFO|3=WARN|4=ERROR|5=CRITICAL|6=FATAL")
 	confFile    = flag.String("config", "/etc/raintank/collector.ini", "configuration file path")
 
-	serverAddr = flag.String("server-url", "ws://localhost:80/api/v1/", "addres of raintank-apps server")
+	serverAddr = flag.String("server-url", "ws://localhost:80/api/v1/", "addres of raintank-apps server. Multiple servers can be given as a comma separated list")
 	tsdbAddr   = flag.String("tsdb-url", "http://localhost:80/", "addres of raintank-apps server")
 	snapUrlStr = flag.String("snap-url", "http://localhost:8181", "url of SNAP server.")
+	execType   = flag.String("executor", "snap", "how tasks are run. snap or builtin")
+	stateFile  = flag.String("state-file", "/var/lib/raintank/task-agent.json", "file to save the task list to. Set to empty string to disable")
+	statusAddr = flag.String("status-addr", "", "address for the local status API, eg. localhost:8183. Disabled if empty")
+	stateAge   = flag.Duration("state-max-age", time.Hour, "how long to keep running tasks that can not be confirmed by the server. 0 means forever")
 	nodeName   = flag.String("name", "", "agent-name")
 	apiKey     = flag.String("api-key", "not_very_secret_key", "Api Key")
+
+	tlsCertFile = flag.String("tls-cert-file", "", "client certificate to present to the server")
+	tlsKeyFile  = flag.String("tls-key-file", "", "key for the client certificate")
+	tlsCaFile   = flag.String("tls-ca-file", "", "CA bundle used to verify the server certificate")
+
+	reconnectMinDelay = flag.Duration("reconnect-min-delay", time.Second, "initial delay between attempts to connect to the server")
+	reconnectMaxDelay = flag.Duration("reconnect-max-delay", time.Minute*2, "maximum delay between attempts to connect to the server")
+
+	telemetryInterval = flag.Duration("telemetry-interval", time.Minute, "how often to send the agent's own metrics to tsdb. 0 disables")
 )
 
-func connect(u *url.URL) (*websocket.Conn, error) {
-	log.Info("connecting to %s", u.String())
-	header := make(http.Header)
-	header.Set("Authorization", fmt.Sprintf("Bearer %s", *apiKey))
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
-	return conn, err
-}
+var client *agentclient.Client
 
 func main() {
 	flag.Parse()
+	reloader := config.NewReloader(*confFile)
 	// Only try and parse the conf file if it exists
 	if _, err := os.Stat(*confFile); err == nil {
 		conf, err := globalconf.NewWithOptions(&globalconf.Options{Filename: *confFile})
@@ -55,23 +62,7 @@ func main() {
 	}
 
 	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, *logLevel))
-	// workaround for https://github.com/grafana/grafana/issues/4055
-	switch *logLevel {
-	case 0:
-		log.Level(log.TRACE)
-	case 1:
-		log.Level(log.DEBUG)
-	case 2:
-		log.Level(log.INFO)
-	case 3:
-		log.Level(log.WARN)
-	case 4:
-		log.Level(log.ERROR)
-	case 5:
-		log.Level(log.CRITICAL)
-	case 6:
-		log.Level(log.FATAL)
-	}
+	setLogLevel(*logLevel)
 
 	if *showVersion {
 		fmt.Printf("task-agent (built with %s, git hash %s)\n", runtime.Version(), GitHash)
@@ -81,114 +72,154 @@ func main() {
 	if *nodeName == "" {
 		log.Fatal(4, "name must be set.")
 	}
+	if *reconnectMinDelay <= 0 {
+		log.Fatal(4, "reconnect-min-delay must be greater than 0.")
+	}
 
-	snapUrl, err := url.Parse(*snapUrlStr)
-	if err != nil {
-		log.Fatal(4, "could not parse snapUrl. %s", err)
+	var exec executor.Executor
+	switch *execType {
+	case "snap":
+		snapUrl, err := url.Parse(*snapUrlStr)
+		if err != nil {
+			log.Fatal(4, "could not parse snapUrl. %s", err)
+		}
+		snapClient, err := snap.NewClient(*nodeName, *tsdbAddr, *apiKey, snapUrl)
+		if err != nil {
+			log.Fatal(4, err.Error())
+		}
+		exec = snapClient
+	case "builtin":
+		exec = builtin.NewExecutor(*nodeName, *tsdbAddr, *apiKey)
+	default:
+		log.Fatal(4, "unknown executor %s. must be snap or builtin", *execType)
 	}
-	snapClient, err := snap.NewClient(*nodeName, *tsdbAddr, *apiKey, snapUrl)
-	if err != nil {
-		log.Fatal(4, err.Error())
+
+	if err := InitTaskCache(exec, *stateFile, *stateAge); err != nil {
+		log.Error(3, "failed to load saved task state. %s", err)
 	}
 
-	InitTaskCache(snapClient)
+	rand.Seed(time.Now().UnixNano())
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 	shutdownStart := make(chan struct{})
+	go func() {
+		<-interrupt
+		log.Info("interrupt")
+		close(shutdownStart)
+	}()
 
-	controllerUrl, err := url.Parse(*serverAddr)
+	servers, err := agentclient.ParseServerUrls(*serverAddr, *nodeName, Version)
 	if err != nil {
 		log.Fatal(4, err.Error())
 	}
-	controllerUrl.Path = path.Clean(controllerUrl.Path + fmt.Sprintf("/socket/%s/%d", *nodeName, Version))
-
-	if controllerUrl.Scheme != "ws" && controllerUrl.Scheme != "wss" {
-		log.Fatal(4, "invalid server address.  scheme must be ws or wss. was %s", controllerUrl.Scheme)
+	tlsConfig, err := agentclient.NewTLSConfig(*tlsCertFile, *tlsKeyFile, *tlsCaFile)
+	if err != nil {
+		log.Fatal(4, "failed to load TLS config. %s", err)
+	}
+	client = agentclient.New(servers, *apiKey, tlsConfig, *reconnectMinDelay, *reconnectMaxDelay, shutdownStart)
+	client.OnTaskList = HandleTaskList
+	client.OnTaskAdd = HandleTaskAdd
+	client.OnTaskUpdate = HandleTaskUpdate
+	client.OnTaskRemove = HandleTaskRemove
+	// send the catalog as soon as a server accepts the connection.
+	client.OnConnect = func() { go emitMetrics(exec) }
+
+	// the saved task list is reconciled with the executor, and expires,
+	// whether or not a server can be reached.
+	startTaskSync(exec, shutdownStart)
+
+	if *statusAddr != "" {
+		go func() {
+			err := NewStatusServer(exec).ListenAndServe(*statusAddr)
+			log.Error(3, "status API stopped. %s", err)
+		}()
 	}
 
-	conn, err := connect(controllerUrl)
-	if err != nil {
-		log.Fatal(4, "unable to connect to server on url %s: %s", controllerUrl.String(), err)
+	var telemetry *Telemetry
+	if *telemetryInterval > 0 {
+		telemetry = NewTelemetry(*nodeName, *tsdbAddr, *apiKey, *telemetryInterval, exec)
+		go telemetry.Run(shutdownStart)
 	}
 
-	//create new session, allow 1000 events to be queued in the writeQueue before Emit() blocks.
-	sess := session.NewSession(conn, 1000)
-	sess.On("disconnect", func() {
-		// on disconnect, reconnect.
-		ticker := time.NewTicker(time.Second)
-		connected := false
-		for !connected {
-			select {
-			case <-shutdownStart:
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				conn, err := connect(controllerUrl)
-				if err == nil {
-					sess.Conn = conn
-					connected = true
-					go sess.Start()
-				}
-			}
-		}
-		ticker.Stop()
-	})
+	// reload the config file on SIGHUP.
+	go HandleReload(reloader, exec, telemetry)
 
-	sess.On("heartbeat", func(body []byte) {
-		log.Debug("recieved heartbeat event. %s", body)
-	})
+	if err := client.Start(); err != nil {
+		// we were interrupted before a connection could be established.
+		return
+	}
 
-	sess.On("taskList", HandleTaskList())
-	sess.On("taskUpdate", HandleTaskUpdate())
-	sess.On("taskAdd", HandleTaskAdd())
-	sess.On("taskRemove", HandleTaskRemove())
+	//wait for interupt Signal.
+	<-shutdownStart
+	client.Close()
+	return
+}
 
-	go sess.Start()
+// workaround for https://github.com/grafana/grafana/issues/4055
+func setLogLevel(level int) {
+	switch level {
+	case 0:
+		log.Level(log.TRACE)
+	case 1:
+		log.Level(log.DEBUG)
+	case 2:
+		log.Level(log.INFO)
+	case 3:
+		log.Level(log.WARN)
+	case 4:
+		log.Level(log.ERROR)
+	case 5:
+		log.Level(log.CRITICAL)
+	case 6:
+		log.Level(log.FATAL)
+	}
+}
 
+// startTaskSync starts the executor and the goroutines that keep the task
+// cache in sync with it.  None of them need a server connection.
+func startTaskSync(exec executor.Executor, shutdownStart chan struct{}) {
 	//periodically send an Updated Catalog.
-	go SendCatalog(sess, snapClient, shutdownStart)
+	go SendCatalog(exec, shutdownStart)
 
-	// connect to the snap server and monitor that it is up.
-	go snapClient.Run()
+	// stop tasks that the server has not confirmed for too long.
+	go GlobalTaskCache.RunExpiry(shutdownStart)
 
-	//wait for interupt Signal.
-	<-interrupt
-	log.Info("interrupt")
-	close(shutdownStart)
-	sess.Close()
-	return
+	// start the executor. For snap this connects to the snap server and monitors that it is up.
+	go exec.Run()
 }
 
-func SendCatalog(sess *session.Session, snapClient *snap.Client, shutdownStart chan struct{}) {
+func SendCatalog(exec executor.Executor, shutdownStart chan struct{}) {
 	ticker := time.NewTicker(time.Minute * 5)
 	for {
 		select {
 		case <-shutdownStart:
 			return
 		case <-ticker.C:
-			emitMetrics(sess, snapClient)
-		case <-snapClient.ConnectChan:
-			log.Debug("connected to SNAP. re-indexing task list")
+			emitMetrics(exec)
+		case <-exec.Resync():
+			log.Debug("executor ready. re-indexing task list")
 			if err := GlobalTaskCache.IndexSnapTasks(); err != nil {
 				log.Error(3, "failed to add task to cache. %s", err)
 			}
-			emitMetrics(sess, snapClient)
+			emitMetrics(exec)
 		}
 	}
 }
 
-func emitMetrics(sess *session.Session, snapClient *snap.Client) {
-	catalog, err := snapClient.GetSnapMetrics()
+func emitMetrics(exec executor.Executor) {
+	catalog, err := exec.Catalog()
 	if err != nil {
 		log.Error(3, err.Error())
 		return
 	}
-	body, err := json.Marshal(catalog)
-	if err != nil {
-		log.Error(3, err.Error())
+	if err := client.SendCatalog(catalog); err == agentclient.ErrNotStarted {
+		// the catalog is sent once the client connects.
+		log.Debug("not connected to a server. catalog not sent.")
+		return
+	} else if err != nil {
+		log.Error(3, "failed to emit catalog event. %s", err)
 		return
 	}
-	e := &message.Event{Event: "catalog", Payload: body}
-	sess.Emit(e)
+	lastCatalog.Set(catalog)
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-server/agentclient"
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testExecutor runs tasks in memory.
+type testExecutor struct {
+	sync.Mutex
+	tasks  map[string]*rbody.ScheduledTask
+	resync chan struct{}
+}
+
+func newTestExecutor() *testExecutor {
+	return &testExecutor{
+		tasks:  make(map[string]*rbody.ScheduledTask),
+		resync: make(chan struct{}, 1),
+	}
+}
+
+func (e *testExecutor) CreateTask(task *model.TaskDTO, name string) (*rbody.ScheduledTask, error) {
+	e.Lock()
+	defer e.Unlock()
+	t := &rbody.ScheduledTask{ID: name, Name: name, State: "Running", CreationTimestamp: time.Now().Unix()}
+	e.tasks[name] = t
+	return t, nil
+}
+
+func (e *testExecutor) RemoveTask(task *rbody.ScheduledTask) error {
+	e.Lock()
+	defer e.Unlock()
+	delete(e.tasks, task.Name)
+	return nil
+}
+
+func (e *testExecutor) ListTasks() ([]*rbody.ScheduledTask, error) {
+	e.Lock()
+	defer e.Unlock()
+	tasks := make([]*rbody.ScheduledTask, 0, len(e.tasks))
+	for _, t := range e.tasks {
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+func (e *testExecutor) names() []string {
+	tasks, _ := e.ListTasks()
+	names := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *testExecutor) Catalog() ([]*rbody.Metric, error) { return testCatalog(), nil }
+func (e *testExecutor) Run()                              { e.resync <- struct{}{} }
+func (e *testExecutor) Connected() bool                   { return true }
+func (e *testExecutor) Reconfigure(tsdbAddr, apiKey string) error {
+	return nil
+}
+func (e *testExecutor) Resync() <-chan struct{} { return e.resync }
+
+// waitFor polls cond until it is true or a few seconds have passed.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return true
+}
+
+func TestRestartWithoutServer(t *testing.T) {
+	Convey("Given an agent restarted with saved state while no server is reachable", t, func() {
+		dir, err := ioutil.TempDir("", "task-agent")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		stateFile := filepath.Join(dir, "tasks.json")
+
+		// the saved list was confirmed just short of the max age.
+		task1 := newTestTask(1, 10)
+		saved := &TaskState{
+			Revision:  model.NewTaskList([]*model.TaskDTO{task1}).Revision,
+			Timestamp: time.Now().Add(-time.Hour + time.Millisecond*500),
+			Tasks:     []*model.TaskDTO{task1},
+		}
+		So(saved.Save(stateFile), ShouldBeNil)
+
+		interval := expiryInterval
+		expiryInterval = time.Millisecond * 10
+		Reset(func() { expiryInterval = interval })
+
+		exec := newTestExecutor()
+		So(InitTaskCache(exec, stateFile, time.Hour), ShouldBeNil)
+
+		shutdown := make(chan struct{})
+		servers, err := agentclient.ParseServerUrls("ws://127.0.0.1:1/api/v1", "test-agent", Version)
+		So(err, ShouldBeNil)
+		client = agentclient.New(servers, "test-key", nil, time.Millisecond*10, time.Millisecond*10, shutdown)
+		started := make(chan error, 1)
+		startTaskSync(exec, shutdown)
+		go func() { started <- client.Start() }()
+		Reset(func() {
+			close(shutdown)
+			<-started
+		})
+
+		Convey("the saved tasks are started and then expire", func() {
+			So(waitFor(func() bool { return len(exec.names()) == 1 }), ShouldBeTrue)
+			So(exec.names(), ShouldResemble, []string{taskName(task1)})
+
+			So(waitFor(func() bool { return len(exec.names()) == 0 }), ShouldBeTrue)
+			So(cachedTaskIds(), ShouldBeEmpty)
+			So(client.Status().State, ShouldNotEqual, agentclient.ConnStateConnected)
+			So(client.Status().TotalAttempts, ShouldBeGreaterThan, 1)
+		})
+	})
+}
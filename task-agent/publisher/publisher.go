@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raintank/raintank-metric/msg"
+	"github.com/raintank/raintank-metric/schema"
+)
+
+// Publisher sends metrics to the tsdb /metrics endpoint using the same
+// binary format as the rt-hostedtsdb snap publisher.
+type Publisher struct {
+	TsdbAddr string
+	ApiKey   string
+	http     *http.Client
+}
+
+func New(tsdbAddr, apiKey string) *Publisher {
+	if !strings.HasSuffix(tsdbAddr, "/") {
+		tsdbAddr += "/"
+	}
+	return &Publisher{
+		TsdbAddr: tsdbAddr,
+		ApiKey:   apiKey,
+		http:     &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (p *Publisher) Publish(metrics []*schema.MetricData) error {
+	body, err := msg.CreateMsg(metrics, time.Now().UnixNano(), msg.FormatMetricDataArrayMsgp)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.TsdbAddr+"metrics", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "rt-metric-binary")
+	req.Header.Set("Authorization", "Bearer "+p.ApiKey)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Posting data failed. %d - %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/pkg/config"
+	"github.com/raintank/raintank-apps/task-agent/executor"
+)
+
+// settings that can be changed without restarting the agent.
+var reloadable = []string{"log-level", "api-key", "tsdb-url"}
+
+// HandleReload re-reads the config file whenever the agent receives SIGHUP.
+func HandleReload(reloader *config.Reloader, exec executor.Executor, telemetry *Telemetry) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Info("SIGHUP received. reloading %s", *confFile)
+		reloadConfig(reloader, exec, telemetry)
+	}
+}
+
+func reloadConfig(reloader *config.Reloader, exec executor.Executor, telemetry *Telemetry) {
+	applied, restart, err := reloader.Reload(reloadable...)
+	if err != nil {
+		log.Error(3, "failed to reload config. %s", err)
+	}
+	for _, c := range restart {
+		log.Warn("%s has changed, but the change will only take effect after a restart.", c.Name)
+	}
+
+	publishChanged := false
+	keyChanged := false
+	for _, c := range applied {
+		log.Info("%s has changed.", c.Name)
+		switch c.Name {
+		case "log-level":
+			setLogLevel(*logLevel)
+		case "api-key":
+			keyChanged = true
+			publishChanged = true
+		case "tsdb-url":
+			publishChanged = true
+		}
+	}
+
+	if publishChanged {
+		if err := exec.Reconfigure(*tsdbAddr, *apiKey); err != nil {
+			log.Error(3, "failed to update executor config. %s", err)
+		} else {
+			// tasks only pick up the new settings when they are created.
+			GlobalTaskCache.RecreateTasks()
+		}
+		if telemetry != nil {
+			telemetry.Reconfigure(*tsdbAddr, *apiKey)
+		}
+	}
+	if keyChanged {
+		client.SetApiKey(*apiKey)
+		log.Info("reconnecting to server with new api-key.")
+		client.Reconnect()
+	}
+}
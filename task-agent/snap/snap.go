@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana/pkg/log"
@@ -11,10 +12,15 @@ import (
 	"github.com/intelsdi-x/snap/mgmt/rest/client"
 	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
 	"github.com/intelsdi-x/snap/scheduler/wmap"
+	"github.com/raintank/raintank-apps/task-agent/executor"
 	"github.com/raintank/raintank-apps/task-server/model"
 )
 
+// make sure that we actually satisfy the Executor interface
+var _ executor.Executor = (*Client)(nil)
+
 type Client struct {
+	sync.RWMutex
 	NodeName    string
 	TsdbAddr    string
 	ApiKey      string
@@ -46,6 +52,33 @@ func (c *Client) Run() {
 	go c.watchTasks()
 }
 
+func (c *Client) Connected() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.connected
+}
+
+func (c *Client) setConnected(connected bool) {
+	c.Lock()
+	c.connected = connected
+	c.Unlock()
+}
+
+// Reconfigure updates the tsdb address and API key in the snap global
+// config.  Snap only applies the global config when a task is created, so
+// existing tasks keep publishing with the old settings until recreated.
+func (c *Client) Reconfigure(tsdbAddr, apiKey string) error {
+	c.Lock()
+	c.TsdbAddr = tsdbAddr
+	c.ApiKey = apiKey
+	c.Unlock()
+	return c.SetSnapGlobalConfig()
+}
+
+func (c *Client) Resync() <-chan struct{} {
+	return c.ConnectChan
+}
+
 func (c *Client) watchSnapServer() {
 	log.Info("running SnapClient supervisor.")
 	ticker := time.NewTicker(time.Second)
@@ -53,9 +86,9 @@ func (c *Client) watchSnapServer() {
 		conf, err := c.GetSnapGlobalConfig()
 		if err != nil {
 			log.Debug("Snap server is unreachable. %s", err.Error())
-			if c.connected {
+			if c.Connected() {
 				log.Error(3, "Snap server unreachable. %s", err.Error())
-				c.connected = false
+				c.setConnected(false)
 			}
 			continue
 		}
@@ -65,9 +98,9 @@ func (c *Client) watchSnapServer() {
 				continue
 			}
 		}
-		if !c.connected {
+		if !c.Connected() {
 			log.Info("connected to snap server.")
-			c.connected = true
+			c.setConnected(true)
 			c.ConnectChan <- struct{}{}
 		}
 	}
@@ -78,45 +111,51 @@ func (c *Client) watchTasks() {
 	ticker := time.NewTicker(time.Minute)
 
 	for range ticker.C {
-		tasks, err := c.GetSnapTasks()
-		if err != nil {
-			log.Error(3, "Failed get task list from snap server.")
+		if c.RemoveDisabledTasks() {
+			c.ConnectChan <- struct{}{}
 		}
-		syncNeeded := false
-		for _, t := range tasks {
-			if t.State == "Disabled" {
-				log.Info("task %s is marked as disabled. Removing it.", t.Name)
-				err = c.RemoveSnapTask(t)
-				if err != nil {
-					log.Error(3, "Failed to remove task. %s", err)
-				}
-				syncNeeded = true
+	}
+}
+
+// RemoveDisabledTasks removes any tasks that snap has disabled, returning
+// true if a resync is needed to recreate them.
+func (c *Client) RemoveDisabledTasks() bool {
+	tasks, err := c.ListTasks()
+	if err != nil {
+		log.Error(3, "Failed get task list from snap server.")
+	}
+	syncNeeded := false
+	for _, t := range tasks {
+		if t.State == "Disabled" {
+			log.Info("task %s is marked as disabled. Removing it.", t.Name)
+			err = c.RemoveTask(t)
+			if err != nil {
+				log.Error(3, "Failed to remove task. %s", err)
 			}
-		}
-		if syncNeeded {
-			c.ConnectChan <- struct{}{}
+			syncNeeded = true
 		}
 	}
+	return syncNeeded
 }
 
-func (c *Client) GetSnapMetrics() ([]*rbody.Metric, error) {
+func (c *Client) Catalog() ([]*rbody.Metric, error) {
 	resp := c.c.GetMetricCatalog()
 	return resp.Catalog, resp.Err
 }
 
-func (c *Client) GetSnapTasks() ([]*rbody.ScheduledTask, error) {
+func (c *Client) ListTasks() ([]*rbody.ScheduledTask, error) {
 	resp := c.c.GetTasks()
 	var tasks []*rbody.ScheduledTask
 	if resp.Err == nil {
 		tasks = make([]*rbody.ScheduledTask, len(resp.ScheduledTasks))
-		for i, t := range resp.ScheduledTasks {
-			tasks[i] = &t
+		for i := range resp.ScheduledTasks {
+			tasks[i] = &resp.ScheduledTasks[i]
 		}
 	}
 	return tasks, resp.Err
 }
 
-func (c *Client) RemoveSnapTask(task *rbody.ScheduledTask) error {
+func (c *Client) RemoveTask(task *rbody.ScheduledTask) error {
 	resp := c.c.GetTask(task.ID)
 	if resp.Err != nil {
 		return resp.Err
@@ -136,7 +175,7 @@ func (c *Client) RemoveSnapTask(task *rbody.ScheduledTask) error {
 	return removeResp.Err
 }
 
-func (c *Client) CreateSnapTask(t *model.TaskDTO, name string) (*rbody.ScheduledTask, error) {
+func (c *Client) CreateTask(t *model.TaskDTO, name string) (*rbody.ScheduledTask, error) {
 	s := &client.Schedule{
 		Type:     "simple",
 		Interval: fmt.Sprintf("%ds", t.Interval),
@@ -191,15 +230,18 @@ func (c *Client) GetSnapGlobalConfig() (*rbody.PluginConfigItem, error) {
 }
 
 func (c *Client) SetSnapGlobalConfig() error {
+	c.RLock()
+	nodeName, tsdbAddr, apiKey := c.NodeName, c.TsdbAddr, c.ApiKey
+	c.RUnlock()
 	agentName := ctypes.ConfigValueStr{
-		Value: c.NodeName,
+		Value: nodeName,
 	}
 	resp := c.c.SetPluginConfig("", "", "", "raintank_agent_name", agentName)
 	if resp.Err != nil {
 		return resp.Err
 	}
 
-	url, err := url.Parse(c.TsdbAddr)
+	url, err := url.Parse(tsdbAddr)
 	if err != nil {
 		return err
 	}
@@ -212,7 +254,7 @@ func (c *Client) SetSnapGlobalConfig() error {
 	}
 
 	key := ctypes.ConfigValueStr{
-		Value: c.ApiKey,
+		Value: apiKey,
 	}
 	resp = c.c.SetPluginConfig("", "", "", "raintank_api_key", key)
 	if resp.Err != nil {
@@ -0,0 +1,369 @@
+// Package snaptest provides an in-process stand-in for the snap REST API,
+// implementing the subset of endpoints used by the task-agent: the metric
+// catalog, tasks and the global plugin config.
+package snaptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+)
+
+// response types understood by the snap REST client.
+const (
+	metricsReturnedType           = "metrics_returned"
+	scheduledTaskListReturnedType = "scheduled_task_list_returned"
+	scheduledTaskReturnedType     = "scheduled_task_returned"
+	addScheduledTaskType          = "scheduled_task_created"
+	scheduledTaskStartedType      = "scheduled_task_started"
+	scheduledTaskStoppedType      = "scheduled_task_stopped"
+	scheduledTaskEnabledType      = "scheduled_task_enabled"
+	scheduledTaskRemovedType      = "scheduled_task_removed"
+	pluginConfigItemType          = "config_plugin_item_returned"
+	setPluginConfigItemType       = "config_plugin_item_created"
+	errorType                     = "error"
+)
+
+type responseMeta struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+type response struct {
+	Meta *responseMeta `json:"meta"`
+	Body interface{}   `json:"body"`
+}
+
+type errorBody struct {
+	ErrorMessage string            `json:"message"`
+	Fields       map[string]string `json:"fields"`
+}
+
+type taskCreationRequest struct {
+	Name     string      `json:"name"`
+	Deadline string      `json:"deadline"`
+	Workflow interface{} `json:"workflow"`
+	Schedule interface{} `json:"schedule"`
+	Start    bool        `json:"start"`
+}
+
+// ConfigValue is a single item of the plugin config.
+type ConfigValue struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Task is a task stored by the fake server, along with the workflow and
+// schedule it was created with.
+type Task struct {
+	rbody.ScheduledTask
+	Workflow interface{}
+	Schedule interface{}
+}
+
+// Server is a fake snap daemon.  All state is held in memory and can be
+// inspected and changed by tests.
+type Server struct {
+	sync.Mutex
+	*httptest.Server
+	tasks   map[string]*Task
+	catalog []*rbody.Metric
+	config  map[string]ConfigValue
+	nextId  int
+}
+
+// NewServer starts a fake snap server.  The caller should Close it when
+// finished.
+func NewServer() *Server {
+	s := &Server{
+		tasks:   make(map[string]*Task),
+		catalog: make([]*rbody.Metric, 0),
+		config:  make(map[string]ConfigValue),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetCatalog sets the metrics returned by the catalog endpoint.
+func (s *Server) SetCatalog(metrics []*rbody.Metric) {
+	s.Lock()
+	s.catalog = metrics
+	s.Unlock()
+}
+
+// Tasks returns a copy of all tasks, sorted by name.
+func (s *Server) Tasks() []*Task {
+	s.Lock()
+	defer s.Unlock()
+	tasks := make([]*Task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		task := *t
+		tasks = append(tasks, &task)
+	}
+	sort.Sort(byName(tasks))
+	return tasks
+}
+
+// TaskByName returns a copy of the task with the given name, or nil.
+func (s *Server) TaskByName(name string) *Task {
+	for _, t := range s.Tasks() {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// SetTaskState changes the state of a task, eg. to "Disabled" to simulate
+// a task that has failed too many times.
+func (s *Server) SetTaskState(id, state string) error {
+	s.Lock()
+	defer s.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return fmt.Errorf("task not found")
+	}
+	t.State = state
+	return nil
+}
+
+// Config returns a copy of the global plugin config.
+func (s *Server) Config() map[string]ConfigValue {
+	s.Lock()
+	defer s.Unlock()
+	config := make(map[string]ConfigValue)
+	for k, v := range s.config {
+		config[k] = v
+	}
+	return config
+}
+
+type byName []*Task
+
+func (t byName) Len() int           { return len(t) }
+func (t byName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byName) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	// we cant use a ServeMux as the global config path has empty
+	// segments, /v1/plugins////config, which it would redirect.
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		s.respondError(w, 404, fmt.Errorf("not found"))
+		return
+	}
+	parts = parts[1:]
+
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case len(parts) == 1 && parts[0] == "metrics" && r.Method == "GET":
+		s.respond(w, 200, metricsReturnedType, "Metrics returned", s.catalog)
+	case len(parts) == 1 && parts[0] == "tasks" && r.Method == "GET":
+		s.listTasks(w)
+	case len(parts) == 1 && parts[0] == "tasks" && r.Method == "POST":
+		s.createTask(w, r)
+	case len(parts) == 2 && parts[0] == "tasks" && r.Method == "GET":
+		s.getTask(w, parts[1])
+	case len(parts) == 2 && parts[0] == "tasks" && r.Method == "DELETE":
+		s.removeTask(w, parts[1])
+	case len(parts) == 3 && parts[0] == "tasks" && r.Method == "PUT":
+		s.changeTaskState(w, parts[1], parts[2])
+	case len(parts) == 5 && parts[0] == "plugins" && parts[4] == "config":
+		s.pluginConfig(w, r)
+	default:
+		s.respondError(w, 404, fmt.Errorf("not found"))
+	}
+}
+
+func (s *Server) listTasks(w http.ResponseWriter) {
+	tasks := make([]*Task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	sort.Sort(byName(tasks))
+	list := rbody.ScheduledTaskListReturned{ScheduledTasks: make([]rbody.ScheduledTask, len(tasks))}
+	for i, t := range tasks {
+		list.ScheduledTasks[i] = t.ScheduledTask
+	}
+	s.respond(w, 200, scheduledTaskListReturnedType, "Scheduled tasks retrieved", list)
+}
+
+func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
+	req := taskCreationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, 400, err)
+		return
+	}
+	s.nextId++
+	id := fmt.Sprintf("%08d-0000-0000-0000-000000000000", s.nextId)
+	state := "Stopped"
+	if req.Start {
+		state = "Running"
+	}
+	t := &Task{
+		ScheduledTask: rbody.ScheduledTask{
+			ID:                id,
+			Name:              req.Name,
+			Deadline:          req.Deadline,
+			CreationTimestamp: time.Now().Unix(),
+			State:             state,
+			Href:              fmt.Sprintf("%s/v1/tasks/%s", s.URL, id),
+		},
+		Workflow: req.Workflow,
+		Schedule: req.Schedule,
+	}
+	s.tasks[id] = t
+	s.respond(w, 201, addScheduledTaskType, "Scheduled task created", rbody.AddScheduledTask(t.ScheduledTask))
+}
+
+func (s *Server) getTask(w http.ResponseWriter, id string) {
+	t, ok := s.tasks[id]
+	if !ok {
+		s.respondError(w, 404, fmt.Errorf("No task found with id '%s'", id))
+		return
+	}
+	s.respond(w, 200, scheduledTaskReturnedType, "Scheduled task retrieved", rbody.ScheduledTaskReturned{
+		AddScheduledTask: rbody.AddScheduledTask(t.ScheduledTask),
+	})
+}
+
+func (s *Server) removeTask(w http.ResponseWriter, id string) {
+	t, ok := s.tasks[id]
+	if !ok {
+		s.respondError(w, 404, fmt.Errorf("No task found with id '%s'", id))
+		return
+	}
+	if t.State == "Running" {
+		s.respondError(w, 500, fmt.Errorf("Task must be stopped"))
+		return
+	}
+	delete(s.tasks, id)
+	s.respond(w, 200, scheduledTaskRemovedType, "Scheduled task removed", map[string]string{"id": id})
+}
+
+func (s *Server) changeTaskState(w http.ResponseWriter, id, action string) {
+	t, ok := s.tasks[id]
+	if !ok {
+		s.respondError(w, 404, fmt.Errorf("No task found with id '%s'", id))
+		return
+	}
+	switch action {
+	case "start":
+		if t.State == "Disabled" {
+			s.respondError(w, 500, fmt.Errorf("Task is disabled. Cannot be started"))
+			return
+		}
+		t.State = "Running"
+		s.respond(w, 200, scheduledTaskStartedType, "Scheduled task started", map[string]string{"id": id})
+	case "stop":
+		if t.State == "Disabled" {
+			s.respondError(w, 500, fmt.Errorf("Task is disabled. Only running tasks can be stopped"))
+			return
+		}
+		t.State = "Stopped"
+		s.respond(w, 200, scheduledTaskStoppedType, "Scheduled task stopped", map[string]string{"id": id})
+	case "enable":
+		if t.State != "Disabled" {
+			s.respondError(w, 500, fmt.Errorf("Task must be disabled"))
+			return
+		}
+		t.State = "Stopped"
+		s.respond(w, 200, scheduledTaskEnabledType, "Disabled task enabled", rbody.AddScheduledTask(t.ScheduledTask))
+	default:
+		s.respondError(w, 404, fmt.Errorf("not found"))
+	}
+}
+
+func (s *Server) pluginConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.respond(w, 200, pluginConfigItemType, "Plugin config item retrieved", s.configTable())
+	case "PUT":
+		items := make(map[string]json.RawMessage)
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			s.respondError(w, 400, err)
+			return
+		}
+		// accept both a bare map of items and one wrapped in a table.
+		if table, ok := items["table"]; ok {
+			items = make(map[string]json.RawMessage)
+			if err := json.Unmarshal(table, &items); err != nil {
+				s.respondError(w, 400, err)
+				return
+			}
+		}
+		for key, raw := range items {
+			v, err := decodeConfigValue(raw)
+			if err != nil {
+				s.respondError(w, 400, err)
+				return
+			}
+			s.config[key] = v
+		}
+		s.respond(w, 200, setPluginConfigItemType, "Plugin config item(s) set", s.configTable())
+	default:
+		s.respondError(w, 405, fmt.Errorf("method not allowed"))
+	}
+}
+
+func (s *Server) configTable() interface{} {
+	table := make(map[string]ConfigValue)
+	for k, v := range s.config {
+		table[k] = v
+	}
+	return map[string]interface{}{"table": table}
+}
+
+// decodeConfigValue accepts either a typed value, {"type": .., "value": ..},
+// or a bare JSON value.
+func decodeConfigValue(raw json.RawMessage) (ConfigValue, error) {
+	v := ConfigValue{}
+	if err := json.Unmarshal(raw, &v); err == nil && v.Type != "" {
+		return v, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return v, err
+	}
+	switch value.(type) {
+	case string:
+		v.Type = "string"
+	case float64:
+		v.Type = "float"
+	case bool:
+		v.Type = "bool"
+	default:
+		return v, fmt.Errorf("unsupported config value %s", raw)
+	}
+	v.Value = value
+	return v, nil
+}
+
+func (s *Server) respond(w http.ResponseWriter, code int, bodyType, message string, body interface{}) {
+	resp := response{
+		Meta: &responseMeta{
+			Code:    code,
+			Message: message,
+			Type:    bodyType,
+			Version: 1,
+		},
+		Body: body,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) respondError(w http.ResponseWriter, code int, err error) {
+	s.respond(w, code, errorType, err.Error(), errorBody{ErrorMessage: err.Error(), Fields: map[string]string{}})
+}
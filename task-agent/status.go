@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-agent/executor"
+	"github.com/raintank/raintank-apps/task-server/agentclient"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+type catalogRecord struct {
+	sync.RWMutex
+	Sent    time.Time       `json:"sent"`
+	Metrics []*rbody.Metric `json:"metrics"`
+}
+
+func (c *catalogRecord) Set(metrics []*rbody.Metric) {
+	c.Lock()
+	c.Sent = time.Now()
+	c.Metrics = metrics
+	c.Unlock()
+}
+
+// lastCatalog is the catalog most recently sent to the server.
+var lastCatalog = &catalogRecord{}
+
+type TaskStatus struct {
+	Task     *model.TaskDTO       `json:"task"`
+	Executor *rbody.ScheduledTask `json:"executor"`
+}
+
+type AgentStatus struct {
+	Name              string             `json:"name"`
+	Controller        agentclient.Status `json:"controller"`
+	ExecutorConnected bool               `json:"executorConnected"`
+	Tasks             []*TaskStatus      `json:"tasks"`
+}
+
+// StatusServer is a local HTTP API for inspecting and controlling the agent.
+type StatusServer struct {
+	exec executor.Executor
+}
+
+func NewStatusServer(exec executor.Executor) *StatusServer {
+	return &StatusServer{exec: exec}
+}
+
+func (s *StatusServer) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.status)
+	mux.HandleFunc("/tasks", s.tasks)
+	mux.HandleFunc("/catalog", s.catalog)
+	mux.HandleFunc("/resync", s.resync)
+	log.Info("status API listening on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *StatusServer) status(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	tasks, err := s.taskStatus()
+	if err != nil {
+		writeJSON(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, 200, &AgentStatus{
+		Name:              *nodeName,
+		Controller:        client.Status(),
+		ExecutorConnected: s.exec.Connected(),
+		Tasks:             tasks,
+	})
+}
+
+func (s *StatusServer) tasks(w http.ResponseWriter, r *http.Request) {
+	tasks, err := s.taskStatus()
+	if err != nil {
+		writeJSON(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, 200, tasks)
+}
+
+// catalog returns the last catalog sent to the server. POST sends the
+// current catalog again.
+func (s *StatusServer) catalog(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		lastCatalog.RLock()
+		defer lastCatalog.RUnlock()
+		writeJSON(w, 200, lastCatalog)
+	case "POST":
+		emitMetrics(s.exec)
+		writeJSON(w, 200, "ok")
+	default:
+		writeJSON(w, 405, "method not allowed")
+	}
+}
+
+// resync re-indexes the executor's tasks and reconciles them with the
+// task list.
+func (s *StatusServer) resync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSON(w, 405, "method not allowed")
+		return
+	}
+	if err := GlobalTaskCache.IndexSnapTasks(); err != nil {
+		writeJSON(w, 500, fmt.Sprintf("resync failed. %s", err))
+		return
+	}
+	writeJSON(w, 200, "ok")
+}
+
+// taskStatus pairs each cached task with its current state in the
+// executor. If the executor is unreachable the cached state is used.
+func (s *StatusServer) taskStatus() ([]*TaskStatus, error) {
+	tasks, snapTasks := GlobalTaskCache.Snapshot()
+	if s.exec.Connected() {
+		current, err := s.exec.ListTasks()
+		if err != nil {
+			return nil, err
+		}
+		snapTasks = make(map[string]*rbody.ScheduledTask)
+		for _, t := range current {
+			snapTasks[t.Name] = t
+		}
+	}
+	status := make([]*TaskStatus, 0, len(tasks))
+	for _, t := range tasks {
+		status = append(status, &TaskStatus{
+			Task:     t,
+			Executor: snapTasks[taskName(t)],
+		})
+	}
+	return status, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error(3, "failed to write status response. %s", err)
+	}
+}
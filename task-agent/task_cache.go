@@ -1,29 +1,176 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grafana/grafana/pkg/log"
 	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
-	"github.com/raintank/raintank-apps/task-agent/snap"
+	"github.com/raintank/raintank-apps/task-agent/executor"
 	"github.com/raintank/raintank-apps/task-server/model"
 )
 
 type TaskCache struct {
 	sync.RWMutex
-	c           *snap.Client
+	executor    executor.Executor
 	Tasks       map[int64]*model.TaskDTO
 	SnapTasks   map[string]*rbody.ScheduledTask
 	initialized bool
+
+	// stateFile is where the task list is persisted. If empty the task
+	// list is only kept in memory.
+	stateFile string
+	// maxAge is how long tasks are kept running without the task list
+	// being confirmed by the server.
+	maxAge    time.Duration
+	confirmed time.Time
+	revision  string
+}
+
+// saveState writes the current task list to the state file. The caller
+// must hold the lock.
+func (t *TaskCache) saveState() {
+	if t.stateFile == "" {
+		return
+	}
+	tasks := make([]*model.TaskDTO, 0, len(t.Tasks))
+	for _, task := range t.Tasks {
+		tasks = append(tasks, task)
+	}
+	state := &TaskState{
+		Revision:  t.revision,
+		Timestamp: t.confirmed,
+		Tasks:     tasks,
+	}
+	if err := state.Save(t.stateFile); err != nil {
+		log.Error(3, "failed to save task state to %s. %s", t.stateFile, err)
+	}
+}
+
+// loadState populates the task list from the state file, unless the saved
+// list is older than maxAge.
+func (t *TaskCache) loadState() error {
+	if t.stateFile == "" {
+		return nil
+	}
+	state, err := LoadTaskState(t.stateFile)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		log.Info("no saved task state found at %s", t.stateFile)
+		return nil
+	}
+	age := time.Since(state.Timestamp)
+	if t.maxAge > 0 && age > t.maxAge {
+		log.Warn("saved task list (revision %q) is %s old. Tasks will be stopped until confirmed by the server.", state.Revision, age)
+		return nil
+	}
+	log.Info("loaded %d tasks from saved task list (revision %q), last confirmed %s ago.", len(state.Tasks), state.Revision, age)
+	t.Lock()
+	for _, task := range state.Tasks {
+		t.Tasks[task.Id] = task
+	}
+	t.revision = state.Revision
+	t.confirmed = state.Timestamp
+	t.Unlock()
+	return nil
+}
+
+// ExpireTasks stops all tasks if the task list has not been confirmed by
+// the server within maxAge.
+func (t *TaskCache) ExpireTasks() {
+	if t.maxAge <= 0 {
+		return
+	}
+	t.Lock()
+	if len(t.Tasks) == 0 || time.Since(t.confirmed) <= t.maxAge {
+		t.Unlock()
+		return
+	}
+	log.Warn("task list (revision %q) has not been confirmed for %s. Stopping %d tasks.", t.revision, time.Since(t.confirmed), len(t.Tasks))
+	t.Tasks = make(map[int64]*model.TaskDTO)
+	t.saveState()
+	t.Unlock()
+	t.Sync()
+}
+
+// expiryInterval is how often RunExpiry checks the task list.
+var expiryInterval = time.Minute
+
+func (t *TaskCache) RunExpiry(shutdown chan struct{}) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			t.ExpireTasks()
+		}
+	}
+}
+
+// taskName returns the name used for the task in the executor.  The task's
+// config hash is encoded in the name so that changes can be detected without
+// comparing timestamps.
+func taskName(task *model.TaskDTO) string {
+	if task.ConfigHash == "" {
+		return fmt.Sprintf("raintank-apps:%d", task.Id)
+	}
+	return fmt.Sprintf("raintank-apps:%d:%s", task.Id, task.ConfigHash)
+}
+
+// taskIdFromName returns the task id encoded in an executor task name.
+func taskIdFromName(name string) (int64, bool) {
+	parts := strings.Split(name, ":")
+	if len(parts) < 2 || parts[0] != "raintank-apps" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// snapTaskNamesForId returns the names of all executor tasks for the task
+// id, whatever config hash they were created with.
+func (t *TaskCache) snapTaskNamesForId(id int64) []string {
+	names := make([]string, 0)
+	for name := range t.SnapTasks {
+		if taskId, ok := taskIdFromName(name); ok && taskId == id {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Snapshot returns copies of the task list and the executor tasks.
+func (t *TaskCache) Snapshot() ([]*model.TaskDTO, map[string]*rbody.ScheduledTask) {
+	t.RLock()
+	defer t.RUnlock()
+	tasks := make([]*model.TaskDTO, 0, len(t.Tasks))
+	for _, task := range t.Tasks {
+		tasks = append(tasks, task)
+	}
+	snapTasks := make(map[string]*rbody.ScheduledTask, len(t.SnapTasks))
+	for name, task := range t.SnapTasks {
+		snapTasks[name] = task
+	}
+	return tasks, snapTasks
 }
 
 func (t *TaskCache) AddTask(task *model.TaskDTO) error {
 	t.Lock()
 	defer t.Unlock()
-	return t.addTask(task)
+	err := t.addTask(task)
+	t.saveState()
+	return err
 }
 
 func (t *TaskCache) addTask(task *model.TaskDTO) error {
@@ -31,38 +178,44 @@ func (t *TaskCache) addTask(task *model.TaskDTO) error {
 	if !t.initialized {
 		return nil
 	}
-	snapTaskName := fmt.Sprintf("raintank-apps:%d", task.Id)
-	snapTask, ok := t.SnapTasks[snapTaskName]
-	if !ok {
-		log.Debug("New task recieved %s", snapTaskName)
-		snapTask, err := t.c.CreateSnapTask(task, snapTaskName)
-		if err != nil {
-			return err
+	snapTaskName := taskName(task)
+	if task.ConfigHash == "" {
+		// the server did not send a config hash, so fall back to
+		// comparing timestamps.
+		if snapTask, ok := t.SnapTasks[snapTaskName]; ok && !task.Updated.After(time.Unix(snapTask.CreationTimestamp, 0)) {
+			log.Debug("task %s already in the cache.", snapTaskName)
+			return nil
 		}
-		t.SnapTasks[snapTaskName] = snapTask
-	} else {
+	} else if _, ok := t.SnapTasks[snapTaskName]; ok {
 		log.Debug("task %s already in the cache.", snapTaskName)
-		if task.Updated.After(time.Unix(snapTask.CreationTimestamp, 0)) {
-			log.Debug("%s needs to be updated", snapTaskName)
-			// need to update task.
-			if err := t.c.RemoveSnapTask(snapTask); err != nil {
-				return err
-			}
-			snapTask, err := t.c.CreateSnapTask(task, snapTaskName)
-			if err != nil {
-				return err
-			}
-			t.SnapTasks[snapTaskName] = snapTask
+		return nil
+	}
+
+	// remove any copies of the task created with a different config.
+	for _, name := range t.snapTaskNamesForId(task.Id) {
+		log.Debug("%s needs to be updated", name)
+		if err := t.removeSnapTask(name); err != nil {
+			atomic.AddInt64(&taskAddFailures, 1)
+			return err
 		}
 	}
 
+	log.Debug("New task recieved %s", snapTaskName)
+	snapTask, err := t.executor.CreateTask(task, snapTaskName)
+	if err != nil {
+		atomic.AddInt64(&taskAddFailures, 1)
+		return err
+	}
+	t.SnapTasks[snapTaskName] = snapTask
 	return nil
 }
 
-func (t *TaskCache) UpdateTasks(tasks []*model.TaskDTO) {
+func (t *TaskCache) UpdateTasks(list *model.TaskList) {
 	seenTaskIds := make(map[int64]struct{})
 	t.Lock()
-	for _, task := range tasks {
+	t.confirmed = time.Now()
+	t.revision = list.Revision
+	for _, task := range list.Tasks {
 		seenTaskIds[task.Id] = struct{}{}
 		err := t.addTask(task)
 		if err != nil {
@@ -75,6 +228,7 @@ func (t *TaskCache) UpdateTasks(tasks []*model.TaskDTO) {
 			tasksToDel = append(tasksToDel, task)
 		}
 	}
+	t.saveState()
 	t.Unlock()
 	if len(tasksToDel) > 0 {
 		for _, task := range tasksToDel {
@@ -89,7 +243,7 @@ func (t *TaskCache) Sync() {
 	tasksByName := make(map[string]*model.TaskDTO)
 	t.Lock()
 	for _, task := range t.Tasks {
-		name := fmt.Sprintf("raintank-apps:%d", task.Id)
+		name := taskName(task)
 		tasksByName[name] = task
 		log.Debug("seen %s", name)
 		err := t.addTask(task)
@@ -100,7 +254,7 @@ func (t *TaskCache) Sync() {
 
 	for name := range t.SnapTasks {
 		if _, ok := tasksByName[name]; !ok {
-			log.Info("%s not in taskList. removing from snap.")
+			log.Info("%s not in taskList. removing from executor.", name)
 			if err := t.removeSnapTask(name); err != nil {
 				log.Error(3, "failed to remove snapTask. %s", name)
 			}
@@ -110,16 +264,35 @@ func (t *TaskCache) Sync() {
 
 }
 
+// RecreateTasks removes every task from the executor and creates it again,
+// so that the tasks pick up changes to the executor's configuration.
+func (t *TaskCache) RecreateTasks() {
+	t.Lock()
+	defer t.Unlock()
+	for name := range t.SnapTasks {
+		if err := t.removeSnapTask(name); err != nil {
+			log.Error(3, "failed to remove snapTask. %s", name)
+		}
+	}
+	for _, task := range t.Tasks {
+		if err := t.addTask(task); err != nil {
+			log.Error(3, err.Error())
+		}
+	}
+}
+
 func (t *TaskCache) RemoveTask(task *model.TaskDTO) error {
 	t.Lock()
 	defer t.Unlock()
-	snapTaskName := fmt.Sprintf("raintank-apps:%d", task.Id)
-	log.Debug("removing snap task %s", snapTaskName)
-	if err := t.removeSnapTask(snapTaskName); err != nil {
-		return err
+	for _, name := range t.snapTaskNamesForId(task.Id) {
+		log.Debug("removing snap task %s", name)
+		if err := t.removeSnapTask(name); err != nil {
+			return err
+		}
 	}
 
 	delete(t.Tasks, task.Id)
+	t.saveState()
 	return nil
 }
 
@@ -128,7 +301,8 @@ func (t *TaskCache) removeSnapTask(taskName string) error {
 	if !ok {
 		log.Debug("task to remove not in cache. %s", taskName)
 	} else {
-		if err := t.c.RemoveSnapTask(snapTask); err != nil {
+		if err := t.executor.RemoveTask(snapTask); err != nil {
+			atomic.AddInt64(&taskRemoveFailures, 1)
 			return err
 		}
 		delete(t.SnapTasks, taskName)
@@ -139,7 +313,7 @@ func (t *TaskCache) removeSnapTask(taskName string) error {
 
 func (t *TaskCache) IndexSnapTasks() error {
 	log.Debug("running indexSnapTasks")
-	tasks, err := t.c.GetSnapTasks()
+	tasks, err := t.executor.ListTasks()
 	if err != nil {
 		return err
 	}
@@ -158,68 +332,40 @@ func (t *TaskCache) IndexSnapTasks() error {
 
 var GlobalTaskCache *TaskCache
 
-func InitTaskCache(snapClient *snap.Client) {
+func InitTaskCache(e executor.Executor, stateFile string, maxAge time.Duration) error {
 	GlobalTaskCache = &TaskCache{
-		c:         snapClient,
+		executor:  e,
 		Tasks:     make(map[int64]*model.TaskDTO),
 		SnapTasks: make(map[string]*rbody.ScheduledTask),
+		stateFile: stateFile,
+		maxAge:    maxAge,
 	}
+	return GlobalTaskCache.loadState()
 }
 
-func HandleTaskList() interface{} {
-	return func(data []byte) {
-		tasks := make([]*model.TaskDTO, 0)
-		err := json.Unmarshal(data, &tasks)
-		if err != nil {
-			log.Error(3, "failed to decode taskUpdate payload. %s", err)
-			return
-		}
-		log.Debug("TaskList. %s", data)
-		GlobalTaskCache.UpdateTasks(tasks)
-	}
+// HandleTaskList replaces the task list with the complete list sent by
+// the server.
+func HandleTaskList(list *model.TaskList) {
+	GlobalTaskCache.UpdateTasks(list)
 }
 
-func HandleTaskUpdate() interface{} {
-	return func(data []byte) {
-		task := model.TaskDTO{}
-		err := json.Unmarshal(data, &task)
-		if err != nil {
-			log.Error(3, "failed to decode taskUpdate payload. %s", err)
-			return
-		}
-		log.Debug("TaskUpdate. %s", data)
-		if err := GlobalTaskCache.AddTask(&task); err != nil {
-			log.Error(3, "failed to add task to cache. %s", err)
-		}
+// HandleTaskAdd starts a task assigned to the agent.
+func HandleTaskAdd(task *model.TaskDTO) {
+	if err := GlobalTaskCache.AddTask(task); err != nil {
+		log.Error(3, "failed to add task to cache. %s", err)
 	}
 }
 
-func HandleTaskAdd() interface{} {
-	return func(data []byte) {
-		task := model.TaskDTO{}
-		err := json.Unmarshal(data, &task)
-		if err != nil {
-			log.Error(3, "failed to decode taskAdd payload. %s", err)
-			return
-		}
-		log.Debug("Adding Task. %s", data)
-		if err := GlobalTaskCache.AddTask(&task); err != nil {
-			log.Error(3, "failed to add task to cache. %s", err)
-		}
+// HandleTaskUpdate replaces a task the agent is running.
+func HandleTaskUpdate(task *model.TaskDTO) {
+	if err := GlobalTaskCache.AddTask(task); err != nil {
+		log.Error(3, "failed to add task to cache. %s", err)
 	}
 }
 
-func HandleTaskRemove() interface{} {
-	return func(data []byte) {
-		task := model.TaskDTO{}
-		err := json.Unmarshal(data, &task)
-		if err != nil {
-			log.Error(3, "failed to decode taskAdd payload. %s", err)
-			return
-		}
-		log.Debug("Removing Task. %s", data)
-		if err := GlobalTaskCache.RemoveTask(&task); err != nil {
-			log.Error(3, "failed to remove task from cache. %s", err)
-		}
+// HandleTaskRemove stops a task that is no longer assigned to the agent.
+func HandleTaskRemove(task *model.TaskDTO) {
+	if err := GlobalTaskCache.RemoveTask(task); err != nil {
+		log.Error(3, "failed to remove task from cache. %s", err)
 	}
 }
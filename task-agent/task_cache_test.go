@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/task-agent/snap"
+	"github.com/raintank/raintank-apps/task-agent/snap/snaptest"
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestTask(id int64, interval int64) *model.TaskDTO {
+	task := &model.TaskDTO{
+		Id:       id,
+		Name:     fmt.Sprintf("task%d", id),
+		OrgId:    1,
+		Interval: interval,
+		Metrics:  map[string]int64{"/testing/demo/demo1": 1},
+		Config: map[string]map[string]interface{}{
+			"/testing/demo": {"user": "test", "passwd": "secret"},
+		},
+		Route:   &model.TaskRoute{Type: model.RouteAny},
+		Enabled: true,
+		Created: time.Now(),
+		Updated: time.Now(),
+	}
+	task.UpdateConfigHash()
+	return task
+}
+
+func snapTaskNames(server *snaptest.Server) []string {
+	names := make([]string, 0)
+	for _, t := range server.Tasks() {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestTaskCache(t *testing.T) {
+	Convey("Given a task cache backed by a snap server", t, func() {
+		server := snaptest.NewServer()
+		Reset(server.Close)
+		u, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		c, err := snap.NewClient("test-agent", "http://localhost:8081/", "test-key", u)
+		So(err, ShouldBeNil)
+		So(InitTaskCache(c, "", 0), ShouldBeNil)
+		So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+
+		task1 := newTestTask(1, 10)
+		task2 := newTestTask(2, 60)
+
+		Convey("When a taskList is received", func() {
+			HandleTaskList(model.NewTaskList([]*model.TaskDTO{task1, task2}))
+
+			Convey("a snap task should be created for each task", func() {
+				So(snapTaskNames(server), ShouldResemble, []string{taskName(task1), taskName(task2)})
+				for _, st := range server.Tasks() {
+					So(st.State, ShouldEqual, "Running")
+				}
+			})
+
+			Convey("and a task is removed from the list", func() {
+				HandleTaskList(model.NewTaskList([]*model.TaskDTO{task1}))
+				So(snapTaskNames(server), ShouldResemble, []string{taskName(task1)})
+				So(GlobalTaskCache.Tasks, ShouldNotContainKey, task2.Id)
+			})
+
+			Convey("and the same list is received again", func() {
+				before := server.Tasks()
+				HandleTaskList(model.NewTaskList([]*model.TaskDTO{task1, task2}))
+				after := server.Tasks()
+				So(after, ShouldHaveLength, 2)
+				So(after[0].ID, ShouldEqual, before[0].ID)
+				So(after[1].ID, ShouldEqual, before[1].ID)
+			})
+		})
+
+		Convey("When a taskAdd is received", func() {
+			HandleTaskAdd(task1)
+			So(snapTaskNames(server), ShouldResemble, []string{taskName(task1)})
+			created := server.TaskByName(taskName(task1))
+			So(created, ShouldNotBeNil)
+
+			Convey("and the task config changes", func() {
+				updated := newTestTask(1, 30)
+				HandleTaskAdd(updated)
+
+				Convey("the snap task should be replaced", func() {
+					So(taskName(updated), ShouldNotEqual, taskName(task1))
+					So(snapTaskNames(server), ShouldResemble, []string{taskName(updated)})
+					So(server.TaskByName(taskName(updated)).ID, ShouldNotEqual, created.ID)
+				})
+			})
+
+			Convey("and only the route changes", func() {
+				moved := newTestTask(1, 10)
+				moved.Route = &model.TaskRoute{Type: model.RouteByIds}
+				moved.UpdateConfigHash()
+				HandleTaskAdd(moved)
+
+				Convey("the snap task should be left alone", func() {
+					So(server.Tasks(), ShouldHaveLength, 1)
+					So(server.Tasks()[0].ID, ShouldEqual, created.ID)
+				})
+			})
+
+			Convey("and then a taskRemove is received", func() {
+				HandleTaskRemove(task1)
+				So(server.Tasks(), ShouldBeEmpty)
+				So(GlobalTaskCache.Tasks, ShouldBeEmpty)
+				So(GlobalTaskCache.SnapTasks, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When snap disables a task", func() {
+			HandleTaskList(model.NewTaskList([]*model.TaskDTO{task1, task2}))
+			disabled := server.TaskByName(taskName(task2))
+			So(server.SetTaskState(disabled.ID, "Disabled"), ShouldBeNil)
+
+			Convey("the disabled task should be removed and recreated", func() {
+				So(c.RemoveDisabledTasks(), ShouldBeTrue)
+				So(snapTaskNames(server), ShouldResemble, []string{taskName(task1)})
+
+				So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+				So(snapTaskNames(server), ShouldResemble, []string{taskName(task1), taskName(task2)})
+				So(server.TaskByName(taskName(task2)).ID, ShouldNotEqual, disabled.ID)
+				So(server.TaskByName(taskName(task2)).State, ShouldEqual, "Running")
+			})
+		})
+
+		Convey("When the snap global config is set", func() {
+			So(c.SetSnapGlobalConfig(), ShouldBeNil)
+			config := server.Config()
+			So(config["raintank_agent_name"].Value, ShouldEqual, "test-agent")
+			So(config["raintank_tsdb_url"].Value, ShouldEqual, "http://localhost:8081/")
+			So(config["raintank_api_key"].Value, ShouldEqual, "test-key")
+		})
+
+		Convey("When the catalog is requested", func() {
+			server.SetCatalog(testCatalog())
+			catalog, err := c.Catalog()
+			So(err, ShouldBeNil)
+			So(catalog, ShouldHaveLength, 1)
+			So(catalog[0].Namespace, ShouldEqual, "/testing/demo/demo1")
+		})
+	})
+}
+
+func cachedTaskIds() []int64 {
+	GlobalTaskCache.RLock()
+	defer GlobalTaskCache.RUnlock()
+	ids := make([]int64, 0)
+	for id := range GlobalTaskCache.Tasks {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestTaskState(t *testing.T) {
+	Convey("Given a task cache with a state file", t, func() {
+		server := snaptest.NewServer()
+		Reset(server.Close)
+		u, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		c, err := snap.NewClient("test-agent", "http://localhost:8081/", "test-key", u)
+		So(err, ShouldBeNil)
+		dir, err := ioutil.TempDir("", "task-agent")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		stateFile := filepath.Join(dir, "state", "tasks.json")
+
+		task1 := newTestTask(1, 10)
+		saved := &TaskState{
+			Revision:  model.NewTaskList([]*model.TaskDTO{task1}).Revision,
+			Timestamp: time.Now().Add(-time.Hour),
+			Tasks:     []*model.TaskDTO{task1},
+		}
+
+		Convey("When there is no saved state", func() {
+			So(InitTaskCache(c, stateFile, time.Hour*2), ShouldBeNil)
+			So(GlobalTaskCache.Tasks, ShouldBeEmpty)
+
+			Convey("a received task list should be saved", func() {
+				So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+				HandleTaskList(model.NewTaskList([]*model.TaskDTO{task1}))
+				state, err := LoadTaskState(stateFile)
+				So(err, ShouldBeNil)
+				So(state.Revision, ShouldEqual, saved.Revision)
+				So(state.Tasks, ShouldHaveLength, 1)
+				So(time.Since(state.Timestamp), ShouldBeLessThan, time.Minute)
+			})
+		})
+
+		Convey("When the saved state is newer than the max age", func() {
+			So(saved.Save(stateFile), ShouldBeNil)
+			So(InitTaskCache(c, stateFile, time.Hour*2), ShouldBeNil)
+
+			Convey("its tasks should be started", func() {
+				So(cachedTaskIds(), ShouldResemble, []int64{1})
+				So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+				So(snapTaskNames(server), ShouldResemble, []string{taskName(task1)})
+			})
+
+			Convey("its tasks should not be expired", func() {
+				So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+				GlobalTaskCache.ExpireTasks()
+				So(cachedTaskIds(), ShouldResemble, []int64{1})
+				So(server.Tasks(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the saved state is older than the max age", func() {
+			So(saved.Save(stateFile), ShouldBeNil)
+			So(InitTaskCache(c, stateFile, time.Minute*30), ShouldBeNil)
+
+			Convey("it should be ignored", func() {
+				So(GlobalTaskCache.Tasks, ShouldBeEmpty)
+				So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+				So(server.Tasks(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When there is no max age", func() {
+			saved.Timestamp = time.Now().Add(-time.Hour * 24 * 365)
+			So(saved.Save(stateFile), ShouldBeNil)
+			So(InitTaskCache(c, stateFile, 0), ShouldBeNil)
+
+			Convey("old state should be loaded and never expire", func() {
+				So(cachedTaskIds(), ShouldResemble, []int64{1})
+				GlobalTaskCache.ExpireTasks()
+				So(cachedTaskIds(), ShouldResemble, []int64{1})
+			})
+		})
+
+		Convey("When the state file is corrupt", func() {
+			So(os.MkdirAll(filepath.Dir(stateFile), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(stateFile, []byte("{"), 0600), ShouldBeNil)
+			So(InitTaskCache(c, stateFile, time.Hour), ShouldNotBeNil)
+		})
+
+		Convey("When the task list is not confirmed within the max age", func() {
+			So(saved.Save(stateFile), ShouldBeNil)
+			So(InitTaskCache(c, stateFile, time.Hour*2), ShouldBeNil)
+			So(GlobalTaskCache.IndexSnapTasks(), ShouldBeNil)
+			So(server.Tasks(), ShouldHaveLength, 1)
+			GlobalTaskCache.Lock()
+			GlobalTaskCache.confirmed = time.Now().Add(-time.Hour * 3)
+			GlobalTaskCache.Unlock()
+
+			Convey("ExpireTasks should stop all tasks and save the empty list", func() {
+				GlobalTaskCache.ExpireTasks()
+				So(GlobalTaskCache.Tasks, ShouldBeEmpty)
+				So(server.Tasks(), ShouldBeEmpty)
+				state, err := LoadTaskState(stateFile)
+				So(err, ShouldBeNil)
+				So(state.Tasks, ShouldBeEmpty)
+			})
+
+			Convey("RunExpiry should stop all tasks", func() {
+				interval := expiryInterval
+				expiryInterval = time.Millisecond * 10
+				Reset(func() { expiryInterval = interval })
+				shutdown := make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					GlobalTaskCache.RunExpiry(shutdown)
+					close(done)
+				}()
+				deadline := time.Now().Add(time.Second)
+				for len(cachedTaskIds()) > 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond * 10)
+				}
+				close(shutdown)
+				<-done
+				So(cachedTaskIds(), ShouldBeEmpty)
+				So(server.Tasks(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func testCatalog() []*rbody.Metric {
+	return []*rbody.Metric{
+		{
+			Namespace: "/testing/demo/demo1",
+			Version:   1,
+			Policy: []rbody.PolicyTable{
+				{Name: "user", Type: "string", Required: true},
+				{Name: "passwd", Type: "string", Required: true},
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// TaskState is the last task list received from the task-server.  It is
+// saved to disk so that tasks can be reconciled when the agent restarts
+// while the server is unreachable.
+type TaskState struct {
+	// Revision is the server's revision of the task list.  It is empty
+	// if the server does not send revisions.
+	Revision string `json:"revision"`
+	// Timestamp is when the task list was last confirmed by the server.
+	Timestamp time.Time        `json:"timestamp"`
+	Tasks     []*model.TaskDTO `json:"tasks"`
+}
+
+// LoadTaskState reads the state file.  If the file does not exist, nil is
+// returned.
+func LoadTaskState(path string) (*TaskState, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := new(TaskState)
+	if err := json.Unmarshal(body, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s. %s", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file and moves it into place, so
+// that a crash never leaves a partially written state file.
+func (s *TaskState) Save(path string) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-agent/executor"
+	"github.com/raintank/raintank-apps/task-agent/publisher"
+	"github.com/raintank/raintank-apps/task-server/agentclient"
+	"github.com/raintank/raintank-metric/schema"
+)
+
+// counters for events that are not tracked anywhere else.
+var (
+	taskAddFailures    int64
+	taskRemoveFailures int64
+)
+
+// Telemetry periodically publishes metrics about the agent itself to tsdb,
+// under raintank.apps.agent.<name>.
+type Telemetry struct {
+	sync.RWMutex
+	name      string
+	interval  time.Duration
+	exec      executor.Executor
+	publisher *publisher.Publisher
+}
+
+func NewTelemetry(name, tsdbAddr, apiKey string, interval time.Duration, exec executor.Executor) *Telemetry {
+	return &Telemetry{
+		name:      name,
+		interval:  interval,
+		exec:      exec,
+		publisher: publisher.New(tsdbAddr, apiKey),
+	}
+}
+
+func (t *Telemetry) Run(shutdown chan struct{}) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			return
+		case ts := <-ticker.C:
+			t.RLock()
+			p := t.publisher
+			t.RUnlock()
+			metrics := t.metrics(ts)
+			if metrics == nil {
+				continue
+			}
+			if err := p.Publish(metrics); err != nil {
+				log.Error(3, "failed to publish agent metrics. %s", err)
+			}
+		}
+	}
+}
+
+func (t *Telemetry) Reconfigure(tsdbAddr, apiKey string) {
+	t.Lock()
+	t.publisher = publisher.New(tsdbAddr, apiKey)
+	t.Unlock()
+}
+
+// metrics returns the agent's metrics, or nil if the org of the agent is
+// not known because no server has accepted a connection yet.
+func (t *Telemetry) metrics(ts time.Time) []*schema.MetricData {
+	status := client.Status()
+	if status.OrgId == 0 {
+		log.Debug("org of the agent is not known yet. not publishing agent metrics.")
+		return nil
+	}
+	connected := 0.0
+	if status.State == agentclient.ConnStateConnected {
+		connected = 1
+	}
+	execConnected := 0.0
+	if t.exec.Connected() {
+		execConnected = 1
+	}
+	lastCatalog.RLock()
+	catalogSize := len(lastCatalog.Metrics)
+	lastCatalog.RUnlock()
+	tasks, _ := GlobalTaskCache.Snapshot()
+
+	metrics := []*schema.MetricData{
+		t.metric(status.OrgId, "server.connected", connected, "gauge", ts),
+		t.metric(status.OrgId, "server.reconnects", float64(status.Reconnects), "counter", ts),
+		t.metric(status.OrgId, "server.connect_attempts", float64(status.TotalAttempts), "counter", ts),
+		t.metric(status.OrgId, "executor.connected", execConnected, "gauge", ts),
+		t.metric(status.OrgId, "tasks.count", float64(len(tasks)), "gauge", ts),
+		t.metric(status.OrgId, "tasks.add_failures", float64(atomic.LoadInt64(&taskAddFailures)), "counter", ts),
+		t.metric(status.OrgId, "tasks.remove_failures", float64(atomic.LoadInt64(&taskRemoveFailures)), "counter", ts),
+		t.metric(status.OrgId, "catalog.size", float64(catalogSize), "gauge", ts),
+	}
+	if status.HeartbeatLag >= 0 {
+		m := t.metric(status.OrgId, "heartbeat.lag", float64(status.HeartbeatLag/time.Millisecond), "gauge", ts)
+		m.Unit = "ms"
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func (t *Telemetry) metric(orgId int64, name string, value float64, targetType string, ts time.Time) *schema.MetricData {
+	m := &schema.MetricData{
+		OrgId:      int(orgId),
+		Name:       fmt.Sprintf("raintank.apps.agent.%s.%s", t.name, name),
+		Metric:     "raintank.apps.agent." + name,
+		Interval:   int(t.interval.Seconds()),
+		Value:      value,
+		Unit:       "",
+		Time:       ts.Unix(),
+		TargetType: targetType,
+		Tags:       []string{"agent:" + t.name},
+	}
+	m.SetId()
+	return m
+}
@@ -3,6 +3,7 @@ package agent_session
 import (
 	"encoding/json"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,6 +16,7 @@ import (
 )
 
 type AgentSession struct {
+	sync.Mutex
 	Agent         *model.AgentDTO
 	AgentVersion  int64
 	dbSession     *model.AgentSession
@@ -22,6 +24,7 @@ type AgentSession struct {
 	Done          chan struct{}
 	Shutdown      chan struct{}
 	closing       bool
+	draining      bool
 }
 
 func NewSession(agent *model.AgentDTO, agentVer int64, conn *websocket.Conn) *AgentSession {
@@ -71,16 +74,41 @@ func (a *AgentSession) Close() {
 }
 
 func (a *AgentSession) close() {
-	if !a.closing {
-		a.closing = true
-		close(a.Shutdown)
-		log.Debug("closing websocket")
-		a.SocketSession.Close()
-		log.Debug("websocket closed")
-
+	a.Lock()
+	if a.closing {
+		a.Unlock()
+		return
+	}
+	a.closing = true
+	draining := a.draining
+	a.Unlock()
+
+	close(a.Shutdown)
+	log.Debug("closing websocket")
+	a.SocketSession.Close()
+	log.Debug("websocket closed")
+
+	// when draining, the DB session is kept until the agent has connected
+	// to another server, so that the agent is not marked as offline.
+	if !draining {
 		a.cleanup()
-		close(a.Done)
 	}
+	close(a.Done)
+}
+
+// Drain asks the agent to reconnect to another server.  The session's DB
+// entry is left in place when the connection closes and must be removed
+// with Cleanup().
+func (a *AgentSession) Drain() error {
+	a.Lock()
+	a.draining = true
+	a.Unlock()
+	e := &message.Event{Event: "reconnect", Payload: []byte{}}
+	return a.SocketSession.Emit(e)
+}
+
+func (a *AgentSession) Cleanup() {
+	a.cleanup()
 }
 
 func (a *AgentSession) saveDbSession() error {
@@ -103,9 +131,13 @@ func (a *AgentSession) saveDbSession() error {
 
 func (a *AgentSession) cleanup() {
 	//remove agentSession from DB.
-	if a.dbSession != nil {
+	a.Lock()
+	dbSession := a.dbSession
+	a.dbSession = nil
+	a.Unlock()
+	if dbSession != nil {
 		log.Debug("deleting agent_session for %s from DB", a.Agent.Name)
-		sqlstore.DeleteAgentSession(a.dbSession)
+		sqlstore.DeleteAgentSession(dbSession)
 	} else {
 		log.Debug("agent_session for %s has no db session.", a.Agent.Name)
 	}
@@ -180,7 +212,11 @@ func (a *AgentSession) sendTaskList() {
 		log.Error(3, "failed to get task list. %s", err)
 		return
 	}
-	body, err := json.Marshal(&tasks)
+	var payload interface{} = &tasks
+	if a.AgentVersion >= model.TaskListVersion {
+		payload = model.NewTaskList(tasks)
+	}
+	body, err := json.Marshal(payload)
 	if err != nil {
 		log.Error(3, "failed to Marshal task list to json. %s", err)
 		return
@@ -0,0 +1,253 @@
+// Package agentclient connects an agent to the task-server's websocket API.
+// It handles authentication, reconnecting with backoff when the connection
+// is lost or the server asks the agent to move, tracking the heartbeats sent
+// by the server, and decoding the task events the server sends.
+package agentclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/pkg/message"
+	"github.com/raintank/raintank-apps/pkg/session"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// heartbeats from the server carry the time they were sent, formatted with
+// time.Time.String().
+const heartbeatLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// Client manages the websocket connection to the task-server.  When more
+// than one server is configured they are tried in turn, and failed attempts
+// are retried with exponential backoff and jitter so that a server restart
+// does not cause every agent to reconnect at once.
+//
+// The On* callbacks must be set before calling Start.  They are called from
+// the goroutine reading the socket, so each one completes before the next
+// event is handled.
+type Client struct {
+	sync.RWMutex
+	servers  []*url.URL
+	next     int
+	apiKey   string
+	dialer   *websocket.Dialer
+	minDelay time.Duration
+	maxDelay time.Duration
+	shutdown chan struct{}
+	status   Status
+	sess     *session.Session
+	// conn is the current connection.  It is only read and replaced with
+	// the lock held, as sess.Conn is replaced by onDisconnect while other
+	// goroutines may be closing it.
+	conn *websocket.Conn
+
+	// OnTaskList is called with the complete list of tasks the agent
+	// should be running.  The server sends it on connect and every minute.
+	// The revision is only set for agents that connect with at least
+	// version model.TaskListVersion.
+	OnTaskList func(list *model.TaskList)
+	// OnTaskAdd is called when a task is assigned to the agent.
+	OnTaskAdd func(task *model.TaskDTO)
+	// OnTaskUpdate is called when a task the agent runs has changed.
+	OnTaskUpdate func(task *model.TaskDTO)
+	// OnTaskRemove is called when a task is no longer assigned to the
+	// agent.
+	OnTaskRemove func(task *model.TaskDTO)
+	// OnConnect is called every time a connection has been established,
+	// including reconnects.
+	OnConnect func()
+}
+
+// New creates a client for the given servers, as returned by
+// ParseServerUrls.  minDelay must be positive, or a server that is down is
+// retried in a tight loop.  Closing shutdown stops any connection attempt
+// in progress.
+func New(servers []*url.URL, apiKey string, tlsConfig *tls.Config, minDelay, maxDelay time.Duration, shutdown chan struct{}) *Client {
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	return &Client{
+		servers:  servers,
+		next:     rand.Intn(len(servers)),
+		apiKey:   apiKey,
+		dialer:   &websocket.Dialer{TLSClientConfig: tlsConfig},
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+		shutdown: shutdown,
+		status:   Status{HeartbeatLag: -1},
+	}
+}
+
+// Start blocks until the first connection has been established, or returns
+// ErrShutdown if shutdown is closed first.  From then on the client
+// reconnects whenever the connection is lost, until Close is called.
+func (c *Client) Start() error {
+	conn, err := c.connect(false)
+	if err != nil {
+		return err
+	}
+
+	//allow 1000 events to be queued in the writeQueue before Emit() blocks.
+	sess := session.NewSession(conn, 1000)
+	sess.On("disconnect", c.onDisconnect)
+	sess.On("reconnect", c.onReconnect)
+	sess.On("heartbeat", c.onHeartbeat)
+	sess.On("taskList", c.onTaskList)
+	sess.On("taskAdd", c.taskHandler("taskAdd", c.OnTaskAdd))
+	sess.On("taskUpdate", c.taskHandler("taskUpdate", c.OnTaskUpdate))
+	sess.On("taskRemove", c.taskHandler("taskRemove", c.OnTaskRemove))
+
+	c.Lock()
+	c.sess = sess
+	c.conn = conn
+	c.Unlock()
+	if c.OnConnect != nil {
+		c.OnConnect()
+	}
+	go sess.Start()
+	return nil
+}
+
+// Close sends any queued events and closes the connection without
+// reconnecting.
+func (c *Client) Close() {
+	// hold the lock so onDisconnect can not replace the connection while
+	// the session is closing it.
+	c.RLock()
+	defer c.RUnlock()
+	if c.sess != nil {
+		c.sess.Close()
+	}
+}
+
+// Reconnect closes the current connection so that a new one is made, eg.
+// to pick up a new api key.  It does nothing if the client is not
+// connected.
+func (c *Client) Reconnect() {
+	c.RLock()
+	conn := c.conn
+	connected := c.status.State == ConnStateConnected
+	c.RUnlock()
+	if conn != nil && connected {
+		conn.Close()
+	}
+}
+
+func (c *Client) Status() Status {
+	c.RLock()
+	defer c.RUnlock()
+	return c.status
+}
+
+// Emit queues an event to be sent to the server.  Events queued while the
+// client is reconnecting are sent once the connection is back.
+func (c *Client) Emit(e *message.Event) error {
+	c.RLock()
+	sess := c.sess
+	c.RUnlock()
+	if sess == nil {
+		return ErrNotStarted
+	}
+	return sess.Emit(e)
+}
+
+// SendCatalog tells the server which metrics the agent can collect.  Tasks
+// are only assigned to agents that have their metrics in the catalog.
+func (c *Client) SendCatalog(catalog []*rbody.Metric) error {
+	body, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+	return c.Emit(&message.Event{Event: "catalog", Payload: body})
+}
+
+func (c *Client) onDisconnect() {
+	c.disconnected()
+	conn, err := c.connect(true)
+	if err != nil {
+		return
+	}
+	c.Lock()
+	sess := c.sess
+	sess.Conn = conn
+	c.conn = conn
+	c.Unlock()
+	if c.OnConnect != nil {
+		c.OnConnect()
+	}
+	go sess.Start()
+}
+
+func (c *Client) onReconnect() {
+	// the server is shutting down and wants us to move to another server.
+	log.Info("server requested reconnect.")
+	c.RLock()
+	conn := c.conn
+	c.RUnlock()
+	conn.Close()
+}
+
+func (c *Client) onHeartbeat(body []byte) {
+	log.Debug("recieved heartbeat event. %s", body)
+	ts := string(body)
+	// strip the monotonic clock reading added by newer go versions.
+	if i := strings.Index(ts, " m="); i > 0 {
+		ts = ts[:i]
+	}
+	now := time.Now()
+	lag := time.Duration(-1)
+	if sent, err := time.Parse(heartbeatLayout, ts); err == nil {
+		lag = now.Sub(sent)
+	} else {
+		log.Debug("could not parse heartbeat timestamp %q. %s", body, err)
+	}
+	c.Lock()
+	c.status.LastHeartbeat = now
+	if lag >= 0 {
+		c.status.HeartbeatLag = lag
+	}
+	c.Unlock()
+}
+
+func (c *Client) onTaskList(body []byte) {
+	list := &model.TaskList{Tasks: make([]*model.TaskDTO, 0)}
+	var err error
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '[' {
+		// servers older than model.TaskListVersion send the bare list
+		// of tasks, without a revision.
+		err = json.Unmarshal(body, &list.Tasks)
+	} else {
+		err = json.Unmarshal(body, list)
+	}
+	if err != nil {
+		log.Error(3, "failed to decode taskList payload. %s", err)
+		return
+	}
+	log.Debug("TaskList. %s", body)
+	if c.OnTaskList != nil {
+		c.OnTaskList(list)
+	}
+}
+
+func (c *Client) taskHandler(event string, f func(*model.TaskDTO)) func([]byte) {
+	return func(body []byte) {
+		task := new(model.TaskDTO)
+		if err := json.Unmarshal(body, task); err != nil {
+			log.Error(3, "failed to decode %s payload. %s", event, err)
+			return
+		}
+		log.Debug("%s. %s", event, body)
+		if f != nil {
+			f(task)
+		}
+	}
+}
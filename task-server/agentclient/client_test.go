@@ -0,0 +1,205 @@
+package agentclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/intelsdi-x/snap/mgmt/rest/rbody"
+	"github.com/raintank/raintank-apps/pkg/message"
+	"github.com/raintank/raintank-apps/pkg/session"
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testServer accepts agent connections the same way the task-server does,
+// and exposes each connection's session so tests can send events.
+type testServer struct {
+	*httptest.Server
+	sessions chan *session.Session
+	catalogs chan []*rbody.Metric
+	keys     chan string
+}
+
+func newTestServer() *testServer {
+	s := &testServer{
+		sessions: make(chan *session.Session, 10),
+		catalogs: make(chan []*rbody.Metric, 10),
+		keys:     make(chan string, 10),
+	}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.keys <- strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		conn, err := upgrader.Upgrade(w, r, http.Header{orgIdHeader: {"2"}})
+		if err != nil {
+			return
+		}
+		sess := session.NewSession(conn, 10)
+		sess.On("catalog", func(body []byte) {
+			catalog := make([]*rbody.Metric, 0)
+			json.Unmarshal(body, &catalog)
+			s.catalogs <- catalog
+		})
+		go sess.Start()
+		s.sessions <- sess
+	}))
+	return s
+}
+
+// addr returns the address agents use to connect to s.
+func (s *testServer) addr() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/api/v1"
+}
+
+// nextSession waits for the next agent connection and returns its session.
+func (s *testServer) nextSession() *session.Session {
+	select {
+	case sess := <-s.sessions:
+		return sess
+	case <-time.After(time.Second * 5):
+		So("no connection from the agent", ShouldBeEmpty)
+		return nil
+	}
+}
+
+func emit(sess *session.Session, event string, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	sess.Emit(&message.Event{Event: event, Payload: body})
+}
+
+func TestClient(t *testing.T) {
+	Convey("Given a client connected to a task-server", t, func() {
+		server := newTestServer()
+		Reset(server.Close)
+		servers, err := ParseServerUrls(server.addr(), "test-agent", 1)
+		So(err, ShouldBeNil)
+		So(servers[0].Path, ShouldEqual, "/api/v1/socket/test-agent/1")
+
+		shutdown := make(chan struct{})
+		Reset(func() { close(shutdown) })
+		c := New(servers, "test-key", nil, time.Millisecond, time.Millisecond*10, shutdown)
+
+		taskLists := make(chan *model.TaskList, 10)
+		added := make(chan *model.TaskDTO, 10)
+		removed := make(chan *model.TaskDTO, 10)
+		connects := make(chan struct{}, 10)
+		c.OnTaskList = func(list *model.TaskList) { taskLists <- list }
+		c.OnTaskAdd = func(task *model.TaskDTO) { added <- task }
+		c.OnTaskRemove = func(task *model.TaskDTO) { removed <- task }
+		c.OnConnect = func() { connects <- struct{}{} }
+
+		So(c.Emit(&message.Event{Event: "catalog"}), ShouldEqual, ErrNotStarted)
+		So(c.Start(), ShouldBeNil)
+		Reset(c.Close)
+		sess := server.nextSession()
+		So(<-server.keys, ShouldEqual, "test-key")
+		<-connects
+		So(c.Status().State, ShouldEqual, ConnStateConnected)
+		So(c.Status().HeartbeatLag, ShouldEqual, -1)
+		So(c.Status().OrgId, ShouldEqual, 2)
+
+		Convey("task events are decoded and passed to the callbacks", func() {
+			task := &model.TaskDTO{Id: 1, Name: "task1", Interval: 10, Metrics: map[string]int64{"/testing/demo": 1}}
+			emit(sess, "taskList", model.NewTaskList([]*model.TaskDTO{task}))
+			emit(sess, "taskAdd", task)
+			emit(sess, "taskRemove", task)
+
+			list := <-taskLists
+			So(list.Revision, ShouldEqual, model.NewTaskList([]*model.TaskDTO{task}).Revision)
+			So(list.Tasks, ShouldHaveLength, 1)
+			So(list.Tasks[0].Name, ShouldEqual, "task1")
+			So((<-added).Id, ShouldEqual, 1)
+			So((<-removed).Id, ShouldEqual, 1)
+		})
+
+		Convey("task lists from older servers are decoded without a revision", func() {
+			emit(sess, "taskList", []*model.TaskDTO{{Id: 1, Name: "task1"}})
+			list := <-taskLists
+			So(list.Revision, ShouldEqual, "")
+			So(list.Tasks, ShouldHaveLength, 1)
+		})
+
+		Convey("heartbeats are tracked", func() {
+			sent := time.Now().Add(-time.Second)
+			sess.Emit(&message.Event{Event: "heartbeat", Payload: []byte(sent.String())})
+			// a taskList sent after the heartbeat shows it has been handled.
+			emit(sess, "taskList", []*model.TaskDTO{})
+			<-taskLists
+			status := c.Status()
+			So(status.LastHeartbeat.IsZero(), ShouldBeFalse)
+			So(status.HeartbeatLag, ShouldBeGreaterThanOrEqualTo, time.Second)
+		})
+
+		Convey("the catalog is sent to the server", func() {
+			So(c.SendCatalog([]*rbody.Metric{{Namespace: "/testing/demo", Version: 1}}), ShouldBeNil)
+			catalog := <-server.catalogs
+			So(catalog, ShouldHaveLength, 1)
+			So(catalog[0].Namespace, ShouldEqual, "/testing/demo")
+		})
+
+		Convey("when the server asks the agent to reconnect", func() {
+			sess.Emit(&message.Event{Event: "reconnect", Payload: []byte{}})
+			server.nextSession()
+			<-connects
+			So(c.Status().Reconnects, ShouldEqual, 1)
+
+			Convey("the new connection uses the current api key", func() {
+				c.SetApiKey("new-key")
+				c.Reconnect()
+				server.nextSession()
+				So(<-server.keys, ShouldEqual, "test-key")
+				So(<-server.keys, ShouldEqual, "new-key")
+			})
+		})
+	})
+}
+
+func TestFailover(t *testing.T) {
+	Convey("Given a client with several servers, one of them down", t, func() {
+		a := newTestServer()
+		Reset(a.Close)
+		b := newTestServer()
+		Reset(b.Close)
+		servers, err := ParseServerUrls("ws://127.0.0.1:1/api/v1,"+a.addr()+","+b.addr(), "test-agent", 1)
+		So(err, ShouldBeNil)
+
+		shutdown := make(chan struct{})
+		Reset(func() { close(shutdown) })
+		c := New(servers, "test-key", nil, time.Millisecond, time.Millisecond*10, shutdown)
+		connects := make(chan struct{}, 10)
+		c.OnConnect = func() { connects <- struct{}{} }
+		So(c.Start(), ShouldBeNil)
+		Reset(c.Close)
+		<-connects
+
+		current, other := a, b
+		if strings.HasPrefix(c.Status().Server, b.addr()) {
+			current, other = b, a
+		}
+		sess := current.nextSession()
+
+		Convey("the server that is down is skipped", func() {
+			status := c.Status()
+			So(status.Server, ShouldStartWith, current.addr())
+			So(status.TotalAttempts, ShouldBeBetweenOrEqual, 1, 2)
+		})
+
+		Convey("the client moves to another server when its server goes away", func() {
+			current.Close()
+			sess.Conn.Close()
+			other.nextSession()
+			<-connects
+			status := c.Status()
+			So(status.State, ShouldEqual, ConnStateConnected)
+			So(status.Server, ShouldStartWith, other.addr())
+			So(status.Reconnects, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,226 @@
+package agentclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grafana/grafana/pkg/log"
+)
+
+// orgIdHeader is set by the task-server to the org of the agent when it
+// accepts the connection.
+const orgIdHeader = "X-Org-Id"
+
+var (
+	ErrShutdown   = errors.New("shutdown in progress")
+	ErrNotStarted = errors.New("client has not been started")
+)
+
+type ConnState int
+
+const (
+	ConnStateDisconnected ConnState = iota
+	ConnStateConnecting
+	ConnStateConnected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateDisconnected:
+		return "disconnected"
+	case ConnStateConnecting:
+		return "connecting"
+	case ConnStateConnected:
+		return "connected"
+	}
+	return "unknown"
+}
+
+func (s ConnState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Status is a point in time snapshot of the connection to the task-server.
+type Status struct {
+	State         ConnState `json:"state"`
+	Server        string    `json:"server"`
+	Attempts      int64     `json:"attempts"`
+	TotalAttempts int64     `json:"totalAttempts"`
+	Reconnects    int64     `json:"reconnects"`
+	LastConnected time.Time `json:"lastConnected"`
+	LastError     string    `json:"lastError"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	// HeartbeatLag is how long the last heartbeat took to arrive from the
+	// server, or -1 if no heartbeat has been received.
+	HeartbeatLag time.Duration `json:"heartbeatLag"`
+	// OrgId is the org the agent belongs to, as sent by the last server
+	// that accepted the connection.  It is 0 until then.
+	OrgId int64 `json:"orgId"`
+}
+
+// ParseServerUrls parses a comma separated list of task-server addresses
+// and appends the socket path for this agent to each of them.
+func ParseServerUrls(addrs, agentName string, version int) ([]*url.URL, error) {
+	servers := make([]*url.URL, 0)
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return nil, fmt.Errorf("invalid server address %s. scheme must be ws or wss. was %s", addr, u.Scheme)
+		}
+		u.Path = path.Clean(u.Path + fmt.Sprintf("/socket/%s/%d", agentName, version))
+		servers = append(servers, u)
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no server address configured.")
+	}
+	return servers, nil
+}
+
+// NewTLSConfig builds the TLS configuration used for wss:// connections.  If
+// certFile and keyFile are set the certificate is presented to the server as
+// the agent's identity, and if caFile is set it replaces the system roots
+// for verifying the server.
+func NewTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// connect blocks until a connection to one of the servers has been
+// established, or until shutdown.  If reconnect is true, the first attempt
+// is also delayed so that agents dropped by the same server spread out their
+// reconnects.
+func (c *Client) connect(reconnect bool) (*websocket.Conn, error) {
+	c.Lock()
+	c.status.State = ConnStateConnecting
+	c.status.Attempts = 0
+	if reconnect {
+		c.status.Reconnects++
+	}
+	c.Unlock()
+
+	delay := time.Duration(0)
+	if reconnect {
+		delay = c.backoff(0)
+	}
+	for {
+		if delay > 0 {
+			log.Debug("waiting %s before connecting to server.", delay)
+			select {
+			case <-c.shutdown:
+				c.disconnected()
+				return nil, ErrShutdown
+			case <-time.After(delay):
+			}
+		}
+
+		c.Lock()
+		u := c.servers[c.next]
+		c.next = (c.next + 1) % len(c.servers)
+		c.status.Server = u.String()
+		c.status.Attempts++
+		c.status.TotalAttempts++
+		attempts := c.status.Attempts
+		c.Unlock()
+
+		conn, err := c.dial(u)
+		if err == nil {
+			c.Lock()
+			c.status.State = ConnStateConnected
+			c.status.LastConnected = time.Now()
+			c.status.LastError = ""
+			c.Unlock()
+			log.Info("connected to %s after %d attempts.", u.String(), attempts)
+			return conn, nil
+		}
+		log.Error(3, "unable to connect to server on url %s (attempt %d): %s", u.String(), attempts, err)
+		c.Lock()
+		c.status.LastError = err.Error()
+		c.Unlock()
+		delay = c.backoff(attempts)
+	}
+}
+
+// SetApiKey changes the key used for future connections.
+func (c *Client) SetApiKey(apiKey string) {
+	c.Lock()
+	c.apiKey = apiKey
+	c.Unlock()
+}
+
+// disconnected records that the current connection has been lost.
+func (c *Client) disconnected() {
+	c.Lock()
+	c.status.State = ConnStateDisconnected
+	c.Unlock()
+}
+
+// backoff returns how long to wait before the next attempt.  The delay
+// doubles with every failed attempt up to maxDelay, and a random jitter of
+// up to half the delay is removed from it.
+func (c *Client) backoff(attempts int64) time.Duration {
+	delay := c.minDelay
+	for i := int64(0); i < attempts && delay < c.maxDelay; i++ {
+		delay = delay * 2
+	}
+	if delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	if half := int64(delay / 2); half > 0 {
+		delay = delay - time.Duration(rand.Int63n(half))
+	}
+	return delay
+}
+
+func (c *Client) dial(u *url.URL) (*websocket.Conn, error) {
+	log.Info("connecting to %s", u.String())
+	header := make(http.Header)
+	c.RLock()
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	c.RUnlock()
+	conn, resp, err := c.dialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	if orgId, err := strconv.ParseInt(resp.Header.Get(orgIdHeader), 10, 64); err == nil {
+		c.Lock()
+		c.status.OrgId = orgId
+		c.Unlock()
+	}
+	return conn, nil
+}
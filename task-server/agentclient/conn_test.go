@@ -0,0 +1,36 @@
+package agentclient
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackoff(t *testing.T) {
+	servers, err := ParseServerUrls("ws://localhost/api/v1", "test-agent", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("The delay doubles with each attempt up to the maximum", t, func() {
+		c := New(servers, "test-key", nil, time.Second, time.Second*10, nil)
+		for attempts, max := range []time.Duration{1, 2, 4, 8, 10, 10} {
+			max = max * time.Second
+			for i := 0; i < 20; i++ {
+				delay := c.backoff(int64(attempts))
+				So(delay, ShouldBeGreaterThan, max/2)
+				So(delay, ShouldBeLessThanOrEqualTo, max)
+			}
+		}
+	})
+
+	Convey("The delay is jittered", t, func() {
+		c := New(servers, "test-key", nil, time.Second, time.Second*10, nil)
+		delays := make(map[time.Duration]bool)
+		for i := 0; i < 20; i++ {
+			delays[c.backoff(3)] = true
+		}
+		So(len(delays), ShouldBeGreaterThan, 1)
+	})
+}
@@ -68,7 +68,7 @@ func AddAgent(ctx *Context, agent model.AgentDTO) {
 	agent.Id = 0
 	//need to add suport for middelware context with AUTH/
 	agent.OrgId = ctx.OrgId
-	err := sqlstore.AddAgent(&agent)
+	err := sqlstore.AddAgent(&agent, ctx.Actor())
 	if err != nil {
 		log.Error(3, err.Error())
 		ctx.JSON(200, rbody.ErrResp(500, err))
@@ -88,7 +88,7 @@ func UpdateAgent(ctx *Context, agent model.AgentDTO) {
 	}
 	//need to add suport for middelware context with AUTH/
 	agent.OrgId = ctx.OrgId
-	err := sqlstore.UpdateAgent(&agent)
+	err := sqlstore.UpdateAgent(&agent, ctx.Actor())
 	if err != nil {
 		log.Error(3, err.Error())
 		ctx.JSON(200, rbody.ErrResp(500, err))
@@ -100,7 +100,7 @@ func UpdateAgent(ctx *Context, agent model.AgentDTO) {
 func DeleteAgent(ctx *Context) {
 	id := ctx.ParamsInt64(":id")
 	owner := ctx.OrgId
-	err := sqlstore.DeleteAgent(id, owner)
+	err := sqlstore.DeleteAgent(id, owner, ctx.Actor())
 	if err != nil {
 		if err == model.AgentNotFound {
 			ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("agent not found")))
@@ -115,3 +115,14 @@ func DeleteAgent(ctx *Context) {
 
 	ctx.JSON(200, rbody.OkResp("agent", nil))
 }
+
+func GetAgentSessions(ctx *Context, query model.GetAgentSessionsQuery) {
+	query.OrgId = ctx.OrgId
+	sessions, err := sqlstore.GetAgentSessions(&query)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("sessions", sessions))
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/Unknwon/macaron"
 	"github.com/macaron-contrib/binding"
 	"github.com/raintank/met"
+	"github.com/raintank/raintank-apps/pkg/auth"
 	"github.com/raintank/raintank-apps/task-server/api/rbody"
 	"github.com/raintank/raintank-apps/task-server/model"
 )
@@ -14,11 +15,18 @@ var (
 )
 
 func NewApi(adminKey string, metrics met.Backend) *macaron.Macaron {
+	SetAdminKey(adminKey)
 	m := macaron.Classic()
 	m.Use(macaron.Renderer())
 	m.Use(GetContextHandler())
-	m.Use(Auth(adminKey))
+	m.Use(RateLimits.PreAuth(apiKey, getAdminKey))
+	m.Use(Auth())
 	bind := binding.Bind
+	viewer := auth.RequireRole(signedInUser, auth.ViewerRoles...)
+	editor := auth.RequireRole(signedInUser, auth.EditorRoles...)
+	rateLimit := func(group string) macaron.Handler {
+		return RateLimits.Handler(group, apiKey, signedInUser)
+	}
 
 	m.Get("/", heartbeat)
 	m.Group("/api/v1", func() {
@@ -26,25 +34,49 @@ func NewApi(adminKey string, metrics met.Backend) *macaron.Macaron {
 		m.Group("/agents", func() {
 			m.Combo("/").
 				Get(bind(model.GetAgentsQuery{}), GetAgents).
-				Post(AgentQuota(), bind(model.AgentDTO{}), AddAgent).
-				Put(bind(model.AgentDTO{}), UpdateAgent)
+				Post(editor, AgentQuota(), bind(model.AgentDTO{}), AddAgent).
+				Put(editor, bind(model.AgentDTO{}), UpdateAgent)
 			m.Get("/:id", GetAgentById)
 			m.Get("/:id/metrics", GetAgentMetrics)
-			m.Delete("/:id", DeleteAgent)
-		})
+			m.Delete("/:id", editor, DeleteAgent)
+		}, rateLimit("agents"))
+		m.Get("/sessions", rateLimit("agents"), bind(model.GetAgentSessionsQuery{}), GetAgentSessions)
 
-		m.Get("/metrics", bind(model.GetMetricsQuery{}), GetMetrics)
+		m.Get("/metrics", rateLimit("metrics"), bind(model.GetMetricsQuery{}), GetMetrics)
 
 		m.Group("/tasks", func() {
 			m.Combo("/").
 				Get(bind(model.GetTasksQuery{}), GetTasks).
-				Post(bind(model.TaskDTO{}), TaskQuota(), AddTask).
-				Put(bind(model.TaskDTO{}), UpdateTask)
+				Post(editor, bind(model.TaskDTO{}), TaskQuota(), AddTask).
+				Put(editor, bind(model.TaskDTO{}), UpdateTask)
 			m.Get("/:id", GetTaskById)
-			m.Delete("/:id", DeleteTask)
-		})
-		m.Get("/socket/:agent/:ver", socket)
-	})
+			m.Delete("/:id", editor, DeleteTask)
+		}, rateLimit("tasks"))
+		m.Get("/events", rateLimit("events"), bind(model.GetEventLogsQuery{}), GetEvents)
+		m.Get("/stream", rateLimit("events"), Stream)
+
+		m.Group("/webhooks", func() {
+			m.Combo("/").
+				Get(bind(model.GetWebhooksQuery{}), GetWebhooks).
+				Post(editor, bind(model.Webhook{}), AddWebhook).
+				Put(editor, bind(model.Webhook{}), UpdateWebhook)
+			m.Get("/:id", GetWebhookById)
+			m.Get("/:id/deliveries", bind(model.GetWebhookDeliveriesQuery{}), GetWebhookDeliveries)
+			m.Delete("/:id", editor, DeleteWebhook)
+		}, rateLimit("webhooks"))
+
+		// agents connect with whatever key they were deployed with, so the
+		// socket only needs the viewer role it has always had.
+		m.Get("/socket/:agent/:ver", rateLimit("socket"), socket)
+
+		m.Group("/admin", func() {
+			m.Get("/dead-letters", bind(model.GetDeadLetterEventsQuery{}), GetDeadLetterEvents)
+			m.Post("/dead-letters/:id/replay", ReplayDeadLetterEvent)
+			m.Delete("/dead-letters/:id", DeleteDeadLetterEvent)
+			m.Get("/provisioning", GetProvisioningStatus)
+			m.Post("/provisioning/reload", ReloadProvisioning)
+		}, RequireAdmin())
+	}, viewer)
 
 	taskCreate = metrics.NewCount("api.tasks_create")
 	taskDelete = metrics.NewCount("api.tasks_delete")
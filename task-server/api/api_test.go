@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth/authtest"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+func TestRoles(t *testing.T) {
+	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, 4))
+	stats, err := helper.New(false, "localhost:8125", "standard", "task-server", "default")
+	if err != nil {
+		t.Fatalf("failed to initialize statsd. %s", err)
+	}
+	sqlstore.NewEngine("sqlite3", ":memory:", false)
+	authtest.UseKeys()
+
+	authtest.CheckRoutes(t, NewApi(authtest.AdminKey, stats), []authtest.Route{
+		authtest.Viewer("GET", "/api/v1/agents"),
+		authtest.Viewer("GET", "/api/v1/tasks"),
+		authtest.Viewer("GET", "/api/v1/metrics"),
+		authtest.Viewer("GET", "/api/v1/webhooks"),
+		authtest.Viewer("GET", "/api/v1/events"),
+		authtest.Viewer("GET", "/api/v1/socket/probe1/1"),
+		authtest.Editor("POST", "/api/v1/agents"),
+		authtest.Editor("PUT", "/api/v1/agents"),
+		authtest.Editor("DELETE", "/api/v1/agents/1"),
+		authtest.Editor("POST", "/api/v1/tasks"),
+		authtest.Editor("PUT", "/api/v1/tasks"),
+		authtest.Editor("DELETE", "/api/v1/tasks/1"),
+		authtest.Editor("POST", "/api/v1/webhooks"),
+		authtest.Editor("DELETE", "/api/v1/webhooks/1"),
+		authtest.Admin("GET", "/api/v1/admin/dead-letters"),
+		authtest.Admin("DELETE", "/api/v1/admin/dead-letters/1"),
+	})
+}
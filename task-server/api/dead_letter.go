@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+func GetDeadLetterEvents(ctx *Context, query model.GetDeadLetterEventsQuery) {
+	events, err := sqlstore.GetDeadLetterEvents(&query)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("deadLetterEvents", events))
+}
+
+func ReplayDeadLetterEvent(ctx *Context) {
+	id := ctx.ParamsInt64(":id")
+	e, err := sqlstore.GetDeadLetterEventById(id)
+	if err == model.DeadLetterEventNotFound {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("dead-letter event not found")))
+		return
+	}
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	raw := event.RawEvent{
+		Type:      e.Type,
+		Timestamp: e.Timestamp,
+		Body:      json.RawMessage(e.Payload),
+		Source:    e.Source,
+		Handler:   e.Handler,
+	}
+	if err := event.Replay(raw); err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	// if the replay fails again the event is dead-lettered again.
+	if err := sqlstore.DeleteDeadLetterEvent(id); err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	log.Info("replayed dead-lettered %s event %d for %s", e.Type, e.Id, e.Handler)
+	ctx.JSON(200, rbody.OkResp("deadLetterEvent", e))
+}
+
+func DeleteDeadLetterEvent(ctx *Context) {
+	id := ctx.ParamsInt64(":id")
+	if err := sqlstore.DeleteDeadLetterEvent(id); err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("deadLetterEvent", nil))
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+// GetEvents returns events from the event log.  Only admins can query
+// other orgs, or all orgs by leaving orgId unset, unless they are acting on
+// behalf of an org.
+func GetEvents(ctx *Context, query model.GetEventLogsQuery) {
+	if !ctx.IsAdmin || ctx.OrgOverride {
+		query.OrgId = ctx.OrgId
+	}
+	events, err := sqlstore.GetEventLogs(&query)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("events", events))
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/Unknwon/macaron"
 	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/ratelimit"
+	"github.com/raintank/raintank-apps/task-server/event"
 	"github.com/raintank/raintank-apps/task-server/model"
 )
 
@@ -23,6 +27,22 @@ func GetContextHandler() macaron.Handler {
 	}
 }
 
+// signedInUser returns the user of a request, for the pkg/auth middleware.
+func signedInUser(c *macaron.Context) *auth.SignedInUser {
+	return c.GetVal(reflect.TypeOf(&Context{})).Interface().(*Context).SignedInUser
+}
+
+// Actor identifies the signed in user in events caused by the request.
+func (ctx *Context) Actor() *event.Actor {
+	return &event.Actor{
+		Id:          ctx.Id,
+		Name:        ctx.Name,
+		OrgId:       ctx.OrgId,
+		IsAdmin:     ctx.IsAdmin,
+		OrgOverride: ctx.OrgOverride,
+	}
+}
+
 func RequireAdmin() macaron.Handler {
 	return func(ctx *Context) {
 		if !ctx.IsAdmin {
@@ -31,14 +51,36 @@ func RequireAdmin() macaron.Handler {
 	}
 }
 
-func Auth(adminKey string) macaron.Handler {
+// RateLimits are the request rate limits of route groups.  Rate limiting is
+// disabled while it is nil.
+var RateLimits *ratelimit.Limits
+
+var (
+	adminKeyLock sync.RWMutex
+	adminKey     string
+)
+
+// SetAdminKey changes the key that grants admin access.
+func SetAdminKey(key string) {
+	adminKeyLock.Lock()
+	adminKey = key
+	adminKeyLock.Unlock()
+}
+
+func getAdminKey() string {
+	adminKeyLock.RLock()
+	defer adminKeyLock.RUnlock()
+	return adminKey
+}
+
+func Auth() macaron.Handler {
 	return func(ctx *Context) {
 		key := getApiKey(ctx)
 		if key == "" {
 			ctx.JSON(401, "Unauthorized")
 			return
 		}
-		user, err := auth.Auth(adminKey, key)
+		user, err := auth.Auth(getAdminKey(), key)
 		if err != nil {
 			if err == auth.ErrInvalidApiKey {
 				ctx.JSON(401, "Unauthorized")
@@ -47,10 +89,20 @@ func Auth(adminKey string) macaron.Handler {
 			ctx.JSON(500, err)
 			return
 		}
+		user, status, err := auth.ApplyOrgOverride(user, ctx.Req.Request)
+		if err != nil {
+			ctx.JSON(status, err.Error())
+			return
+		}
 		ctx.SignedInUser = user
 	}
 }
 
+// apiKey returns the API key of a request, for the pkg/ratelimit middleware.
+func apiKey(c *macaron.Context) string {
+	return getApiKey(&Context{Context: c})
+}
+
 func getApiKey(c *Context) string {
 	header := c.Req.Header.Get("Authorization")
 	parts := strings.SplitN(header, " ", 2)
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/provisioning"
+)
+
+func GetProvisioningStatus(ctx *Context) {
+	status := provisioning.GetStatus()
+	if status == nil {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("provisioning is not enabled")))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("provisioning", status))
+}
+
+// ReloadProvisioning re-reads the provisioning files on this server, the
+// same as sending it a SIGHUP.
+func ReloadProvisioning(ctx *Context) {
+	if provisioning.GetStatus() == nil {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("provisioning is not enabled")))
+		return
+	}
+	if err := provisioning.Reload(); err != nil {
+		log.Error(3, "failed to reload provisioning. %s", err)
+		ctx.JSON(200, rbody.ErrResp(400, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("provisioning", provisioning.GetStatus()))
+}
@@ -3,10 +3,16 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/pkg/auth"
 	"github.com/raintank/raintank-apps/pkg/message"
 	"github.com/raintank/raintank-apps/task-server/agent_session"
 	"github.com/raintank/raintank-apps/task-server/model"
@@ -15,9 +21,78 @@ import (
 
 var upgrader = websocket.Upgrader{} // use default options
 
+// RequireAgentCert makes agents present a verified client certificate whose
+// identity matches the agent name before a socket is accepted.
+var RequireAgentCert bool
+
 type socketList struct {
 	sync.RWMutex
-	Sockets map[int64]*agent_session.AgentSession
+	Sockets  map[int64]*agent_session.AgentSession
+	draining bool
+}
+
+func (s *socketList) Draining() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.draining
+}
+
+// Drain stops new agents from connecting and asks all connected agents to
+// reconnect to another task-server.  Local sessions are only removed once
+// the agent has a session on another server, or once timeout has passed, so
+// agents that move successfully are never marked as offline.
+func (s *socketList) Drain(timeout time.Duration) {
+	s.Lock()
+	s.draining = true
+	pending := make(map[int64]*agent_session.AgentSession)
+	for id, sock := range s.Sockets {
+		pending[id] = sock
+	}
+	s.Unlock()
+
+	log.Info("draining %d agent sessions.", len(pending))
+	for id, sock := range pending {
+		if err := sock.Drain(); err != nil {
+			log.Error(3, "failed to send reconnect event to agent %d. %s", id, err)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(time.Millisecond * 500)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		select {
+		case <-deadline:
+			log.Warn("%d agents did not reconnect to another server within %s.", len(pending), timeout)
+			for _, sock := range pending {
+				sock.Close()
+				sock.Cleanup()
+			}
+			pending = nil
+		case <-ticker.C:
+			ids := make([]int64, 0, len(pending))
+			for id := range pending {
+				ids = append(ids, id)
+			}
+			moved, err := sqlstore.GetAgentsConnectedElsewhere(ids, hostname)
+			if err != nil {
+				log.Error(3, "failed to get sessions of draining agents. %s", err)
+				continue
+			}
+			for _, id := range moved {
+				log.Debug("agent %d has connected to another server.", id)
+				pending[id].Close()
+				pending[id].Cleanup()
+				delete(pending, id)
+			}
+		}
+	}
+
+	s.Lock()
+	s.Sockets = make(map[int64]*agent_session.AgentSession)
+	s.Unlock()
+	log.Info("drain complete.")
 }
 
 func (s *socketList) CloseAll() {
@@ -63,8 +138,14 @@ func (s *socketList) EmitTask(task *model.TaskDTO, event string) error {
 	return nil
 }
 
-func (s *socketList) NewSocket(a *agent_session.AgentSession) {
+// NewSocket registers the session, closing any existing session for the same
+// agent.  It returns false if the server is draining.
+func (s *socketList) NewSocket(a *agent_session.AgentSession) bool {
 	s.Lock()
+	defer s.Unlock()
+	if s.draining {
+		return false
+	}
 	existing, ok := s.Sockets[a.Agent.Id]
 	if ok {
 		log.Debug("new connection for agent %d - %s, closing existing session", a.Agent.Id, a.Agent.Name)
@@ -72,7 +153,7 @@ func (s *socketList) NewSocket(a *agent_session.AgentSession) {
 	}
 	log.Debug("Agent %d is connected to this server.", a.Agent.Id)
 	s.Sockets[a.Agent.Id] = a
-	s.Unlock()
+	return true
 }
 
 func (s *socketList) DeleteSocket(a *agent_session.AgentSession) {
@@ -133,10 +214,50 @@ func connectedAgent(agentName string, owner int64) (*model.AgentDTO, error) {
 	return agents[0], nil
 }
 
+// agentCertIdentities returns the identities, the CommonName and any DNS
+// SubjectAltNames, of the verified client certificate used for the request.
+func agentCertIdentities(ctx *Context) []string {
+	state := ctx.Req.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+	identities := make([]string, 0, len(cert.DNSNames)+1)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	return identities
+}
+
+func authorizeAgentCert(ctx *Context, agentName string) error {
+	identities := agentCertIdentities(ctx)
+	if len(identities) == 0 {
+		if RequireAgentCert {
+			return errors.New("client certificate required.")
+		}
+		return nil
+	}
+	for _, id := range identities {
+		if id == agentName {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate is not valid for agent %s.", agentName)
+}
+
 func socket(ctx *Context) {
 	agentName := ctx.Params(":agent")
 	agentVer := ctx.ParamsInt64(":ver")
-	//TODO: add auth
+	if ActiveSockets.Draining() {
+		ctx.JSON(503, "server is shutting down.")
+		return
+	}
+	if err := authorizeAgentCert(ctx, agentName); err != nil {
+		log.Info("agent %s rejected. %s", agentName, err)
+		ctx.JSON(403, err.Error())
+		return
+	}
 	owner := ctx.OrgId
 	agent, err := connectedAgent(agentName, owner)
 	if err != nil {
@@ -145,7 +266,10 @@ func socket(ctx *Context) {
 		return
 	}
 
-	c, err := upgrader.Upgrade(ctx.Resp, ctx.Req.Request, nil)
+	// tell the agent which org it belongs to.
+	header := http.Header{}
+	header.Set(auth.OrgIdHeader, strconv.FormatInt(agent.OrgId, 10))
+	c, err := upgrader.Upgrade(ctx.Resp, ctx.Req.Request, header)
 	if err != nil {
 		log.Error(3, "upgrade:", err)
 		return
@@ -154,7 +278,11 @@ func socket(ctx *Context) {
 	log.Debug("agent %s connected.", agent.Name)
 
 	sess := agent_session.NewSession(agent, agentVer, c)
-	ActiveSockets.NewSocket(sess)
+	if !ActiveSockets.NewSocket(sess) {
+		log.Info("rejecting session for agent %s. server is shutting down.", agent.Name)
+		c.Close()
+		return
+	}
 	sess.Start()
 	//block until connection closes.
 	<-sess.Done
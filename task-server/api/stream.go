@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+// event types sent to stream clients.
+var streamEventTypes = []string{"agent.*", "task.*"}
+
+const (
+	streamBufferSize   = 1000
+	streamClientBuffer = 100
+	streamPingInterval = time.Second * 15
+)
+
+type streamEvent struct {
+	Seq   uint64
+	OrgId int64
+	Type  string
+	Data  []byte
+}
+
+// streamBroker fans events out to the clients of GET /api/v1/stream.  The
+// most recent events are kept so that clients can resume after
+// reconnecting.  Event ids are "<epoch>-<seq>", where epoch identifies this
+// process, so ids from another server or from before a restart are
+// detected and the client is told to reset its state.
+type streamBroker struct {
+	sync.Mutex
+	epoch   string
+	seq     uint64
+	buffer  []*streamEvent
+	clients map[chan *streamEvent]struct{}
+}
+
+var EventStream = &streamBroker{
+	epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+	buffer:  make([]*streamEvent, 0, streamBufferSize),
+	clients: make(map[chan *streamEvent]struct{}),
+}
+
+// Run feeds events from the local event listener to stream clients. It
+// must be called after event.Init().
+func (b *streamBroker) Run() {
+	c := make(chan event.RawEvent, 1000)
+	event.Subscribe("*", c)
+	for e := range c {
+		if !streamable(e.Type) {
+			continue
+		}
+		data, err := json.Marshal(struct {
+			Type      string          `json:"type"`
+			Timestamp time.Time       `json:"timestamp"`
+			Payload   json.RawMessage `json:"payload"`
+			Actor     *event.Actor    `json:"actor,omitempty"`
+		}{e.Type, e.Timestamp, e.Body, e.Actor})
+		if err != nil {
+			log.Error(3, "failed to encode %s event for stream. %s", e.Type, err)
+			continue
+		}
+		orgId, _, _ := sqlstore.EventIds(e)
+		b.publish(&streamEvent{OrgId: orgId, Type: e.Type, Data: data})
+	}
+}
+
+func streamable(t string) bool {
+	for _, pattern := range streamEventTypes {
+		if ok, _ := path.Match(pattern, t); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *streamBroker) publish(e *streamEvent) {
+	b.Lock()
+	defer b.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	if len(b.buffer) == streamBufferSize {
+		b.buffer = append(b.buffer[:0], b.buffer[1:]...)
+	}
+	b.buffer = append(b.buffer, e)
+	for c := range b.clients {
+		select {
+		case c <- e:
+		default:
+			// the client is too slow. disconnect it, it can resume
+			// from the last event it received.
+			delete(b.clients, c)
+			close(c)
+		}
+	}
+}
+
+// subscribe registers a new client.  If lastId is set, the events after it
+// are returned.  reset is true if lastId can not be resumed from.
+func (b *streamBroker) subscribe(lastId string) (c chan *streamEvent, backlog []*streamEvent, reset bool) {
+	b.Lock()
+	defer b.Unlock()
+	c = make(chan *streamEvent, streamClientBuffer)
+	b.clients[c] = struct{}{}
+	if lastId == "" {
+		return c, nil, false
+	}
+	parts := strings.SplitN(lastId, "-", 2)
+	if len(parts) != 2 || parts[0] != b.epoch {
+		return c, nil, true
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return c, nil, true
+	}
+	if len(b.buffer) > 0 && b.buffer[0].Seq > seq+1 {
+		// events have been missed.
+		return c, nil, true
+	}
+	for _, e := range b.buffer {
+		if e.Seq > seq {
+			backlog = append(backlog, e)
+		}
+	}
+	return c, backlog, false
+}
+
+func (b *streamBroker) unsubscribe(c chan *streamEvent) {
+	b.Lock()
+	if _, ok := b.clients[c]; ok {
+		delete(b.clients, c)
+		close(c)
+	}
+	b.Unlock()
+}
+
+func (b *streamBroker) id(e *streamEvent) string {
+	return fmt.Sprintf("%s-%d", b.epoch, e.Seq)
+}
+
+// Stream sends agent and task events for the user's org as Server-Sent
+// Events.  Admins receive the events of all orgs, unless they are acting
+// on behalf of an org.
+func Stream(ctx *Context) {
+	closeNotifier, ok := ctx.Resp.(http.CloseNotifier)
+	if !ok {
+		ctx.JSON(500, "streaming not supported")
+		return
+	}
+	closed := closeNotifier.CloseNotify()
+
+	lastId := ctx.Req.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = ctx.Query("lastEventId")
+	}
+	c, backlog, reset := EventStream.subscribe(lastId)
+	defer EventStream.unsubscribe(c)
+
+	header := ctx.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Resp.WriteHeader(200)
+
+	if reset {
+		// the client has missed events and needs to reload its state.
+		fmt.Fprint(ctx.Resp, "event: reset\ndata: {}\n\n")
+	}
+	send := func(e *streamEvent) {
+		if (!ctx.IsAdmin || ctx.OrgOverride) && e.OrgId != ctx.OrgId {
+			return
+		}
+		fmt.Fprintf(ctx.Resp, "id: %s\nevent: %s\ndata: %s\n\n", EventStream.id(e), e.Type, e.Data)
+	}
+	for _, e := range backlog {
+		send(e)
+	}
+	ctx.Resp.Flush()
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-c:
+			if !ok {
+				return
+			}
+			send(e)
+			ctx.Resp.Flush()
+		case <-ticker.C:
+			fmt.Fprint(ctx.Resp, ": ping\n\n")
+			ctx.Resp.Flush()
+		}
+	}
+}
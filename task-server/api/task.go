@@ -38,6 +38,8 @@ func GetTasks(ctx *Context, query model.GetTasksQuery) {
 
 func AddTask(ctx *Context, task model.TaskDTO) {
 	task.OrgId = ctx.OrgId
+	task.ProvisionedBy = ""
+	task.ExternalName = ""
 
 	ok, err := task.Route.Validate()
 	if err != nil {
@@ -62,7 +64,7 @@ func AddTask(ctx *Context, task model.TaskDTO) {
 		return
 	}
 
-	err = sqlstore.AddTask(&task)
+	err = sqlstore.AddTask(&task, ctx.Actor())
 	if err != nil {
 		log.Error(3, err.Error())
 		ctx.JSON(200, rbody.ErrResp(500, err))
@@ -74,6 +76,11 @@ func AddTask(ctx *Context, task model.TaskDTO) {
 
 func UpdateTask(ctx *Context, task model.TaskDTO) {
 	task.OrgId = ctx.OrgId
+	task.ProvisionedBy = ""
+	task.ExternalName = ""
+	if !checkTaskWritable(ctx, task.Id) {
+		return
+	}
 
 	ok, err := task.Route.Validate()
 	if err != nil {
@@ -98,7 +105,7 @@ func UpdateTask(ctx *Context, task model.TaskDTO) {
 		return
 	}
 
-	err = sqlstore.UpdateTask(&task)
+	err = sqlstore.UpdateTask(&task, ctx.Actor())
 	if err != nil {
 		log.Error(3, err.Error())
 		ctx.JSON(200, rbody.ErrResp(500, err))
@@ -110,7 +117,10 @@ func UpdateTask(ctx *Context, task model.TaskDTO) {
 func DeleteTask(ctx *Context) {
 	id := ctx.ParamsInt64(":id")
 	owner := ctx.OrgId
-	existing, err := sqlstore.DeleteTask(id, owner)
+	if !checkTaskWritable(ctx, id) {
+		return
+	}
+	existing, err := sqlstore.DeleteTask(id, owner, ctx.Actor())
 	if err != nil {
 		log.Error(3, err.Error())
 		ctx.JSON(200, rbody.ErrResp(500, err))
@@ -123,3 +133,20 @@ func DeleteTask(ctx *Context) {
 
 	ctx.JSON(200, rbody.OkResp("task", nil))
 }
+
+// checkTaskWritable responds with an error and returns false if the task is
+// owned by a provisioning source.  Those tasks can only be changed by editing
+// the provisioning files.
+func checkTaskWritable(ctx *Context, id int64) bool {
+	existing, err := sqlstore.GetTaskById(id, ctx.OrgId)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return false
+	}
+	if existing != nil && existing.ProvisionedBy != "" {
+		ctx.JSON(200, rbody.ErrResp(403, model.TaskReadOnly))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/auth/authtest"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// apiRequest sends a request to h as an editor of authtest.OrgId, and
+// returns the decoded response.
+func apiRequest(h http.Handler, method, url string, body interface{}) *rbody.ApiResponse {
+	b, err := json.Marshal(body)
+	So(err, ShouldBeNil)
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(b))
+	So(err, ShouldBeNil)
+	req.Header.Set("Authorization", "Bearer "+authtest.Keys[auth.ROLE_EDITOR])
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	So(resp.Code, ShouldEqual, 200)
+	r := new(rbody.ApiResponse)
+	So(json.Unmarshal(resp.Body.Bytes(), r), ShouldBeNil)
+	return r
+}
+
+func newWritableTestTask(name, provisionedBy string) *model.TaskDTO {
+	return &model.TaskDTO{
+		Name:          name,
+		OrgId:         authtest.OrgId,
+		Interval:      60,
+		Enabled:       true,
+		Metrics:       map[string]int64{"/testing/demo/demo1": 1},
+		Config:        map[string]map[string]interface{}{},
+		Route:         &model.TaskRoute{Type: model.RouteAny},
+		ProvisionedBy: provisionedBy,
+		ExternalName:  name,
+	}
+}
+
+func TestCheckTaskWritable(t *testing.T) {
+	Convey("Given a provisioned and an unprovisioned task", t, func() {
+		stats, err := helper.New(false, "localhost:8125", "standard", "task-server", "default")
+		So(err, ShouldBeNil)
+		sqlstore.NewEngine("sqlite3", ":memory:", false)
+		authtest.UseKeys()
+		m := NewApi(authtest.AdminKey, stats)
+
+		agent := &model.AgentDTO{Name: "agent1", OrgId: authtest.OrgId, Enabled: true}
+		So(sqlstore.AddAgent(agent, nil), ShouldBeNil)
+		So(sqlstore.AddMissingMetricsForAgent(agent, []*model.Metric{
+			{OrgId: authtest.OrgId, Namespace: "/testing/demo/demo1", Version: 1},
+		}), ShouldBeNil)
+		So(sqlstore.AddAgentSession(&model.AgentSession{
+			Id:       "session1",
+			AgentId:  agent.Id,
+			Version:  1,
+			RemoteIp: "127.0.0.1",
+			Server:   "localhost",
+			Created:  time.Now(),
+		}), ShouldBeNil)
+		provisioned := newWritableTestTask("provisioned", "file:/etc/tasks")
+		So(sqlstore.AddTask(provisioned, nil), ShouldBeNil)
+		manual := newWritableTestTask("manual", "")
+		So(sqlstore.AddTask(manual, nil), ShouldBeNil)
+
+		Convey("provisioned tasks can not be updated", func() {
+			update := *provisioned
+			update.Interval = 10
+			resp := apiRequest(m, "PUT", "/api/v1/tasks", &update)
+			So(resp.Meta.Code, ShouldEqual, 403)
+			So(resp.Meta.Message, ShouldEqual, model.TaskReadOnly.Error())
+			task, err := sqlstore.GetTaskById(provisioned.Id, authtest.OrgId)
+			So(err, ShouldBeNil)
+			So(task.Interval, ShouldEqual, 60)
+		})
+
+		Convey("provisioned tasks can not be deleted", func() {
+			resp := apiRequest(m, "DELETE", fmt.Sprintf("/api/v1/tasks/%d", provisioned.Id), nil)
+			So(resp.Meta.Code, ShouldEqual, 403)
+			task, err := sqlstore.GetTaskById(provisioned.Id, authtest.OrgId)
+			So(err, ShouldBeNil)
+			So(task, ShouldNotBeNil)
+		})
+
+		Convey("other tasks can be updated", func() {
+			update := *manual
+			update.Interval = 10
+			resp := apiRequest(m, "PUT", "/api/v1/tasks", &update)
+			So(resp.Meta.Code, ShouldEqual, 200)
+			task, err := sqlstore.GetTaskById(manual.Id, authtest.OrgId)
+			So(err, ShouldBeNil)
+			So(task.Interval, ShouldEqual, 10)
+			So(task.ExternalName, ShouldEqual, "")
+		})
+
+		Convey("other tasks can be deleted", func() {
+			resp := apiRequest(m, "DELETE", fmt.Sprintf("/api/v1/tasks/%d", manual.Id), nil)
+			So(resp.Meta.Code, ShouldEqual, 200)
+			task, err := sqlstore.GetTaskById(manual.Id, authtest.OrgId)
+			So(err, ShouldBeNil)
+			So(task, ShouldBeNil)
+		})
+
+		Convey("unknown tasks are not treated as provisioned", func() {
+			resp := apiRequest(m, "DELETE", fmt.Sprintf("/api/v1/tasks/%d", provisioned.Id+100), nil)
+			So(resp.Meta.Code, ShouldEqual, 200)
+		})
+	})
+}
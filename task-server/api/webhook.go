@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+func GetWebhooks(ctx *Context, query model.GetWebhooksQuery) {
+	query.OrgId = ctx.OrgId
+	hooks, err := sqlstore.GetWebhooks(&query)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	for _, h := range hooks {
+		h.Secret = ""
+	}
+	ctx.JSON(200, rbody.OkResp("webhooks", hooks))
+}
+
+func GetWebhookById(ctx *Context) {
+	id := ctx.ParamsInt64(":id")
+	hook, err := sqlstore.GetWebhookById(id, ctx.OrgId)
+	if err == model.WebhookNotFound {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("webhook not found")))
+		return
+	}
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	hook.Secret = ""
+	ctx.JSON(200, rbody.OkResp("webhook", hook))
+}
+
+func AddWebhook(ctx *Context, hook model.Webhook) {
+	hook.Id = 0
+	hook.OrgId = ctx.OrgId
+	if err := hook.Validate(); err != nil {
+		ctx.JSON(200, rbody.ErrResp(400, err))
+		return
+	}
+	if err := sqlstore.AddWebhook(&hook); err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	hook.Secret = ""
+	ctx.JSON(200, rbody.OkResp("webhook", hook))
+}
+
+func UpdateWebhook(ctx *Context, hook model.Webhook) {
+	hook.OrgId = ctx.OrgId
+	if err := hook.Validate(); err != nil {
+		ctx.JSON(200, rbody.ErrResp(400, err))
+		return
+	}
+	err := sqlstore.UpdateWebhook(&hook)
+	if err == model.WebhookNotFound {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("webhook not found")))
+		return
+	}
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	hook.Secret = ""
+	ctx.JSON(200, rbody.OkResp("webhook", hook))
+}
+
+func DeleteWebhook(ctx *Context) {
+	id := ctx.ParamsInt64(":id")
+	err := sqlstore.DeleteWebhook(id, ctx.OrgId)
+	if err == model.WebhookNotFound {
+		ctx.JSON(200, rbody.ErrResp(404, fmt.Errorf("webhook not found")))
+		return
+	}
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("webhook", nil))
+}
+
+func GetWebhookDeliveries(ctx *Context, query model.GetWebhookDeliveriesQuery) {
+	query.WebhookId = ctx.ParamsInt64(":id")
+	query.OrgId = ctx.OrgId
+	deliveries, err := sqlstore.GetWebhookDeliveries(&query)
+	if err != nil {
+		log.Error(3, err.Error())
+		ctx.JSON(200, rbody.ErrResp(500, err))
+		return
+	}
+	ctx.JSON(200, rbody.OkResp("deliveries", deliveries))
+}
@@ -5,10 +5,15 @@ import (
 	"fmt"
 
 	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
 )
 
 func (c *Client) GetAgents(q *model.GetAgentsQuery) ([]*model.AgentDTO, error) {
-	resp, err := c.get("/agents", q)
+	return c.GetAgentsContext(context.Background(), q)
+}
+
+func (c *Client) GetAgentsContext(ctx context.Context, q *model.GetAgentsQuery) ([]*model.AgentDTO, error) {
+	resp, err := c.get(ctx, "/agents", q)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +28,11 @@ func (c *Client) GetAgents(q *model.GetAgentsQuery) ([]*model.AgentDTO, error) {
 }
 
 func (c *Client) GetAgentById(id int64) (*model.AgentDTO, error) {
-	resp, err := c.get(fmt.Sprintf("/agents/%d", id), nil)
+	return c.GetAgentByIdContext(context.Background(), id)
+}
+
+func (c *Client) GetAgentByIdContext(ctx context.Context, id int64) (*model.AgentDTO, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/agents/%d", id), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +47,11 @@ func (c *Client) GetAgentById(id int64) (*model.AgentDTO, error) {
 }
 
 func (c *Client) GetAgentMetrics(id int64) ([]*model.Metric, error) {
-	resp, err := c.get(fmt.Sprintf("/agents/%d/metrics", id), nil)
+	return c.GetAgentMetricsContext(context.Background(), id)
+}
+
+func (c *Client) GetAgentMetricsContext(ctx context.Context, id int64) ([]*model.Metric, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/agents/%d/metrics", id), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +66,11 @@ func (c *Client) GetAgentMetrics(id int64) ([]*model.Metric, error) {
 }
 
 func (c *Client) AddAgent(a *model.AgentDTO) error {
-	resp, err := c.post("/agents", a)
+	return c.AddAgentContext(context.Background(), a)
+}
+
+func (c *Client) AddAgentContext(ctx context.Context, a *model.AgentDTO) error {
+	resp, err := c.post(ctx, "/agents", a)
 	if err != nil {
 		return err
 	}
@@ -67,7 +84,11 @@ func (c *Client) AddAgent(a *model.AgentDTO) error {
 }
 
 func (c *Client) UpdateAgent(a *model.AgentDTO) error {
-	resp, err := c.put("/agents", a)
+	return c.UpdateAgentContext(context.Background(), a)
+}
+
+func (c *Client) UpdateAgentContext(ctx context.Context, a *model.AgentDTO) error {
+	resp, err := c.put(ctx, "/agents", a)
 	if err != nil {
 		return err
 	}
@@ -82,7 +103,11 @@ func (c *Client) UpdateAgent(a *model.AgentDTO) error {
 }
 
 func (c *Client) DeleteAgent(a *model.AgentDTO) error {
-	resp, err := c.delete(fmt.Sprintf("/agents/%d", a.Id), nil)
+	return c.DeleteAgentContext(context.Background(), a)
+}
+
+func (c *Client) DeleteAgentContext(ctx context.Context, a *model.AgentDTO) error {
+	resp, err := c.delete(ctx, fmt.Sprintf("/agents/%d", a.Id), nil)
 	if err != nil {
 		return err
 	}
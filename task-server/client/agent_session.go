@@ -0,0 +1,27 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+func (c *Client) GetAgentSessions(q *model.GetAgentSessionsQuery) ([]model.AgentSession, error) {
+	return c.GetAgentSessionsContext(context.Background(), q)
+}
+
+func (c *Client) GetAgentSessionsContext(ctx context.Context, q *model.GetAgentSessionsQuery) ([]model.AgentSession, error) {
+	resp, err := c.get(ctx, "/sessions", q)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Error(); err != nil {
+		return nil, err
+	}
+	sessions := make([]model.AgentSession, 0)
+	if err := json.Unmarshal(resp.Body, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,295 @@
+package client_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codeskyblue/go-uuid"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/task-server/api"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/client/clienttest"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+)
+
+// backendAdminKey is the admin key of both backends.
+const backendAdminKey = "changeme"
+
+// backend is a task-server that the shared client tests run against.  The
+// client uses the admin key, and acts in org 1 on both.
+type backend struct {
+	client *client.Client
+	// addAgent adds an online agent to org 1 providing metrics, as if it
+	// had connected and sent its catalog.
+	addAgent func(name string, metrics []*model.Metric) *model.AgentDTO
+	// addProvisionedTask adds a task to org 1 that is owned by a
+	// provisioning source.
+	addProvisionedTask func(t *model.TaskDTO) *model.TaskDTO
+	close              func()
+}
+
+// apiBackend runs the real API on an in-memory sqlite DB.
+func apiBackend() *backend {
+	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, 4))
+	stats, err := helper.New(false, "localhost:8125", "standard", "task-server", "default")
+	So(err, ShouldBeNil)
+	sqlstore.NewEngine("sqlite3", ":memory:", false)
+	server := httptest.NewServer(api.NewApi(backendAdminKey, stats))
+	c, err := client.New(server.URL, backendAdminKey, false)
+	So(err, ShouldBeNil)
+	c.RetryDelay = 0
+
+	return &backend{
+		client: c,
+		addAgent: func(name string, metrics []*model.Metric) *model.AgentDTO {
+			agent := &model.AgentDTO{Name: name, OrgId: 1, Enabled: true}
+			So(sqlstore.AddAgent(agent, nil), ShouldBeNil)
+			for _, m := range metrics {
+				m.OrgId = 1
+			}
+			So(sqlstore.AddMissingMetricsForAgent(agent, metrics), ShouldBeNil)
+			So(sqlstore.AddAgentSession(&model.AgentSession{
+				Id:       uuid.NewUUID().String(),
+				AgentId:  agent.Id,
+				Version:  1,
+				RemoteIp: "127.0.0.1",
+				Server:   "localhost",
+				Created:  time.Now(),
+			}), ShouldBeNil)
+			return agent
+		},
+		addProvisionedTask: func(t *model.TaskDTO) *model.TaskDTO {
+			t.OrgId = 1
+			t.ProvisionedBy = "file:/etc/tasks"
+			t.ExternalName = t.Name
+			So(sqlstore.AddTask(t, nil), ShouldBeNil)
+			return t
+		},
+		close: server.Close,
+	}
+}
+
+// fakeBackend runs clienttest.Server.
+func fakeBackend() *backend {
+	s := clienttest.NewServer()
+	s.AddApiKey(backendAdminKey, clienttest.DefaultOrgId, true)
+	c, err := client.New(s.URL, backendAdminKey, false)
+	So(err, ShouldBeNil)
+	c.RetryDelay = 0
+	return &backend{
+		client: c,
+		addAgent: func(name string, metrics []*model.Metric) *model.AgentDTO {
+			agent := s.AddAgent(clienttest.DefaultOrgId, &model.AgentDTO{Name: name, Enabled: true})
+			So(s.SetAgentMetrics(agent.Id, metrics), ShouldBeNil)
+			So(s.SetAgentOnline(agent.Id, true), ShouldBeNil)
+			return agent
+		},
+		addProvisionedTask: func(t *model.TaskDTO) *model.TaskDTO {
+			t.ProvisionedBy = "file:/etc/tasks"
+			t.ExternalName = t.Name
+			return s.AddTask(clienttest.DefaultOrgId, t)
+		},
+		close: s.Close,
+	}
+}
+
+func newBackendTask(name string) *model.TaskDTO {
+	return &model.TaskDTO{
+		Name:     name,
+		Interval: 60,
+		Config:   map[string]map[string]interface{}{"/": {"user": "test"}},
+		Metrics:  map[string]int64{"/testing/demo/demo1": 0},
+		Route:    &model.TaskRoute{Type: model.RouteAny},
+		Enabled:  true,
+	}
+}
+
+// TestBackends runs the same client tests against the real API and the
+// fake, so the fake can not drift from the behaviour it stands in for.
+func TestBackends(t *testing.T) {
+	for _, b := range []struct {
+		name  string
+		start func() *backend
+	}{
+		{"api", apiBackend},
+		{"clienttest", fakeBackend},
+	} {
+		start := b.start
+		Convey("Given the "+b.name+" task-server", t, func() {
+			b := start()
+			Reset(b.close)
+			c := b.client
+			agent := b.addAgent("probe1", []*model.Metric{
+				{Namespace: "/testing/demo/demo1", Version: 1},
+				{Namespace: "/testing/demo2/demo", Version: 2},
+			})
+
+			Convey("the heartbeat succeeds", func() {
+				ok, err := c.Heartbeat()
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("agents can be added, changed and deleted", func() {
+				a := &model.AgentDTO{Name: "probe2", Enabled: true, Tags: []string{"foo"}}
+				So(c.AddAgent(a), ShouldBeNil)
+				So(a.Id, ShouldNotEqual, 0)
+
+				found, err := c.GetAgentById(a.Id)
+				So(err, ShouldBeNil)
+				So(found.Name, ShouldEqual, "probe2")
+				So(found.Tags, ShouldResemble, []string{"foo"})
+
+				found.Tags = []string{"bar"}
+				So(c.UpdateAgent(found), ShouldBeNil)
+				found, err = c.GetAgentById(a.Id)
+				So(err, ShouldBeNil)
+				So(found.Tags, ShouldResemble, []string{"bar"})
+
+				agents, err := c.GetAgents(&model.GetAgentsQuery{})
+				So(err, ShouldBeNil)
+				So(agents, ShouldHaveLength, 2)
+
+				So(c.DeleteAgent(a), ShouldBeNil)
+				_, err = c.GetAgentById(a.Id)
+				So(err, ShouldResemble, rbody.ApiError{Code: 404, Message: "agent not found"})
+			})
+
+			Convey("the admin key can act on behalf of other orgs", func() {
+				org2, org3 := c.ForOrg(2), c.ForOrg(3)
+				So(org2.AddAgent(&model.AgentDTO{Name: "org2-probe", Enabled: true}), ShouldBeNil)
+				So(org3.AddAgent(&model.AgentDTO{Name: "org3-probe", Enabled: true}), ShouldBeNil)
+
+				for _, org := range []struct {
+					client *client.Client
+					name   string
+				}{{c, "probe1"}, {org2, "org2-probe"}, {org3, "org3-probe"}} {
+					agents, err := org.client.GetAgents(&model.GetAgentsQuery{})
+					So(err, ShouldBeNil)
+					So(agents, ShouldHaveLength, 1)
+					So(agents[0].Name, ShouldEqual, org.name)
+				}
+			})
+
+			Convey("invalid agent names are rejected", func() {
+				So(c.AddAgent(&model.AgentDTO{Name: "probe 2"}), ShouldNotBeNil)
+			})
+
+			Convey("agents are found by metric", func() {
+				agents, err := c.GetAgents(&model.GetAgentsQuery{Metric: "/testing/demo/*"})
+				So(err, ShouldBeNil)
+				So(agents, ShouldHaveLength, 1)
+				So(agents[0].Id, ShouldEqual, agent.Id)
+
+				agents, err = c.GetAgents(&model.GetAgentsQuery{Metric: "/not-found/demo/*"})
+				So(err, ShouldBeNil)
+				So(agents, ShouldHaveLength, 0)
+			})
+
+			Convey("metrics are listed for the org and the agent", func() {
+				metrics, err := c.GetMetrics(&model.GetMetricsQuery{})
+				So(err, ShouldBeNil)
+				So(metrics, ShouldHaveLength, 2)
+				So(metrics[0].Namespace, ShouldEqual, "/testing/demo/demo1")
+
+				metrics, err = c.GetAgentMetrics(agent.Id)
+				So(err, ShouldBeNil)
+				So(metrics, ShouldHaveLength, 2)
+			})
+
+			Convey("tasks can be added, changed and deleted", func() {
+				pre := time.Now().Add(-time.Second)
+				task := newBackendTask("task1")
+				So(c.AddTask(task), ShouldBeNil)
+				So(task.Id, ShouldNotEqual, 0)
+				So(task.OrgId, ShouldEqual, 1)
+				So(task.Metrics, ShouldResemble, map[string]int64{"/testing/demo/demo1": 1})
+				So(task.Created, ShouldHappenAfter, pre)
+				So(task.Created.Unix(), ShouldEqual, task.Updated.Unix())
+
+				found, err := c.GetTaskById(task.Id)
+				So(err, ShouldBeNil)
+				So(found.Name, ShouldEqual, "task1")
+				So(found.ConfigHash, ShouldEqual, task.ConfigHash)
+
+				found.Name = "renamed"
+				So(c.UpdateTask(found), ShouldBeNil)
+				tasks, err := c.GetTasks(&model.GetTasksQuery{})
+				So(err, ShouldBeNil)
+				So(tasks, ShouldHaveLength, 1)
+				So(tasks[0].Name, ShouldEqual, "renamed")
+
+				So(c.DeleteTask(found), ShouldBeNil)
+				_, err = c.GetTaskById(task.Id)
+				So(err, ShouldEqual, client.ErrNotFound)
+			})
+
+			Convey("tasks for unknown metrics are rejected", func() {
+				task := newBackendTask("task1")
+				task.Metrics = map[string]int64{"/not-found/demo": 0}
+				So(c.AddTask(task), ShouldResemble, rbody.ApiError{Code: 400, Message: "no matching metric found."})
+			})
+
+			Convey("task names are unique", func() {
+				So(c.AddTask(newBackendTask("task1")), ShouldBeNil)
+				err := c.AddTask(newBackendTask("task1"))
+				So(err, ShouldHaveSameTypeAs, rbody.ApiError{})
+				So(err.(rbody.ApiError).Code, ShouldEqual, 500)
+			})
+
+			Convey("all pages of tasks can be fetched", func() {
+				for i := 0; i < 3; i++ {
+					So(c.AddTask(newBackendTask(fmt.Sprintf("task%d", i))), ShouldBeNil)
+				}
+				tasks, err := c.GetAllTasks(context.Background(), model.GetTasksQuery{Limit: 2})
+				So(err, ShouldBeNil)
+				So(tasks, ShouldHaveLength, 3)
+				So(tasks[2].Name, ShouldEqual, "task2")
+			})
+
+			Convey("all pages of tasks with several metrics can be fetched", func() {
+				for i := 0; i < 3; i++ {
+					task := newBackendTask(fmt.Sprintf("task%d", i))
+					task.Metrics["/testing/demo2/demo"] = 0
+					So(c.AddTask(task), ShouldBeNil)
+				}
+				tasks, err := c.GetAllTasks(context.Background(), model.GetTasksQuery{Limit: 2})
+				So(err, ShouldBeNil)
+				So(tasks, ShouldHaveLength, 3)
+				for i, task := range tasks {
+					So(task.Name, ShouldEqual, fmt.Sprintf("task%d", i))
+					So(task.Metrics, ShouldHaveLength, 2)
+				}
+
+				page, err := c.GetTasks(&model.GetTasksQuery{Limit: 2, Page: 2})
+				So(err, ShouldBeNil)
+				So(page, ShouldHaveLength, 1)
+				So(page[0].Name, ShouldEqual, "task2")
+			})
+
+			Convey("tasks can only be ordered by task columns", func() {
+				_, err := c.GetTasks(&model.GetTasksQuery{OrderBy: "namespace"})
+				So(err, ShouldResemble, rbody.ApiError{Code: 500, Message: `invalid orderBy "namespace"`})
+			})
+
+			Convey("provisioned tasks are read-only", func() {
+				task := b.addProvisionedTask(newBackendTask("provisioned"))
+				readOnly := rbody.ApiError{Code: 403, Message: model.TaskReadOnly.Error()}
+				task.Interval = 10
+				So(c.UpdateTask(task), ShouldResemble, readOnly)
+				So(c.DeleteTask(task), ShouldResemble, readOnly)
+				found, err := c.GetTaskById(task.Id)
+				So(err, ShouldBeNil)
+				So(found.Interval, ShouldEqual, 60)
+				So(found.ProvisionedBy, ShouldEqual, "file:/etc/tasks")
+			})
+		})
+	}
+}
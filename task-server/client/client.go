@@ -6,13 +6,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/google/go-querystring/query"
 	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
 const Version = "v1"
@@ -24,11 +29,31 @@ var (
 	ErrNilResponse  = errors.New("Nil response")
 )
 
+const (
+	DefaultTimeout    = time.Second * 30
+	DefaultRetries    = 3
+	DefaultRetryDelay = time.Millisecond * 200
+	// PageSize is the number of items fetched per request when walking
+	// all pages of a query.
+	PageSize = 100
+
+	orgIdHeader = "X-Org-Id"
+)
+
 type Client struct {
 	URL    *url.URL
 	http   *http.Client
 	ApiKey string
 	prefix string
+	// Retries is how many times GET, PUT and DELETE requests are retried
+	// after a connection error or server error.
+	Retries int
+	// RetryDelay is the delay before the first retry. It doubles with
+	// each retry.
+	RetryDelay time.Duration
+	// OrgId, if set, is sent in the X-Org-Id header so that requests made
+	// with an admin key act on behalf of that org.
+	OrgId int64
 }
 
 func New(serverUrl, apiKey string, insecure bool) (*Client, error) {
@@ -49,13 +74,31 @@ func New(serverUrl, apiKey string, insecure bool) (*Client, error) {
 					InsecureSkipVerify: insecure,
 				},
 			},
+			Timeout: DefaultTimeout,
 		},
-		prefix: u.String(),
+		prefix:     u.String(),
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
 	}
 	return c, nil
 }
 
-func (c *Client) get(path string, query interface{}) (*rbody.ApiResponse, error) {
+// ForOrg returns a copy of the client that acts on behalf of orgId.  The
+// copy shares the connections of c, and is safe to use concurrently with
+// it.
+func (c *Client) ForOrg(orgId int64) *Client {
+	orgClient := *c
+	orgClient.OrgId = orgId
+	return &orgClient
+}
+
+// SetTimeout sets the time limit for each request made by the client,
+// including reading the response. 0 means no timeout.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.http.Timeout = timeout
+}
+
+func (c *Client) get(ctx context.Context, path string, query interface{}) (*rbody.ApiResponse, error) {
 	if query != nil {
 		qstr, err := ToQueryString(query)
 		if err != nil {
@@ -63,35 +106,39 @@ func (c *Client) get(path string, query interface{}) (*rbody.ApiResponse, error)
 		}
 		path = path + "?" + qstr
 	}
-	return c.do("GET", path, nil)
+	return c.do(ctx, "GET", path, nil)
 }
 
-func (c *Client) put(path string, body interface{}) (*rbody.ApiResponse, error) {
+func (c *Client) put(ctx context.Context, path string, body interface{}) (*rbody.ApiResponse, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	return c.do("PUT", path, b)
+	return c.do(ctx, "PUT", path, b)
 }
 
-func (c *Client) post(path string, body interface{}) (*rbody.ApiResponse, error) {
+func (c *Client) post(ctx context.Context, path string, body interface{}) (*rbody.ApiResponse, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	return c.do("POST", path, b)
+	return c.do(ctx, "POST", path, b)
 }
 
-func (c *Client) delete(path string, body interface{}) (*rbody.ApiResponse, error) {
+func (c *Client) delete(ctx context.Context, path string, body interface{}) (*rbody.ApiResponse, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
-	return c.do("DELETE", path, b)
+	return c.do(ctx, "DELETE", path, b)
 }
 
 func (c *Client) Heartbeat() (bool, error) {
-	resp, err := c.do("GET", "/", nil)
+	return c.HeartbeatContext(context.Background())
+}
+
+func (c *Client) HeartbeatContext(ctx context.Context) (bool, error) {
+	resp, err := c.do(ctx, "GET", "/", nil)
 	if err != nil {
 		return false, err
 	}
@@ -104,69 +151,81 @@ func (c *Client) Heartbeat() (bool, error) {
 	return true, nil
 }
 
-func (c *Client) do(method, path string, body []byte) (*rbody.ApiResponse, error) {
-	var (
-		rsp *http.Response
-		err error
-		req *http.Request
-	)
-	switch method {
-	case "GET":
-		req, err = http.NewRequest(method, c.prefix+path, nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Authorization", "Bearer "+c.ApiKey)
-		rsp, err = c.http.Do(req)
-		if err != nil {
-			return nil, err
-		}
-	case "PUT":
-		var b *bytes.Reader
-		b = bytes.NewReader(body)
+// retryError is returned by doOnce for failures that can be retried.
+type retryError struct {
+	err        error
+	retryAfter time.Duration
+}
 
-		req, err = http.NewRequest(method, c.prefix+path, b)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Authorization", "Bearer "+c.ApiKey)
-		req.Header.Add("Content-Type", "application/json")
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
 
-		rsp, err = c.http.Do(req)
-		if err != nil {
-			return nil, err
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*rbody.ApiResponse, error) {
+	retries := 0
+	if method != "POST" {
+		retries = c.Retries
+	}
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := c.doOnce(ctx, method, path, body)
+		rerr, ok := err.(*retryError)
+		if !ok {
+			return resp, err
 		}
-	case "DELETE":
-		var b *bytes.Reader
-		b = bytes.NewReader(body)
-
-		req, err = http.NewRequest(method, c.prefix+path, b)
-		if err != nil {
-			return nil, err
+		if attempt >= retries || ctx.Err() != nil {
+			return resp, rerr.err
 		}
-		req.Header.Set("Authorization", "Bearer "+c.ApiKey)
-		req.Header.Add("Content-Type", "application/json")
-		rsp, err = c.http.Do(req)
-		if err != nil {
-			return nil, err
+		wait := delay
+		if rerr.retryAfter > wait {
+			wait = rerr.retryAfter
 		}
-	case "POST":
-		var b *bytes.Reader
-		b = bytes.NewReader(body)
-
-		req, err = http.NewRequest(method, c.prefix+path, b)
-		if err != nil {
-			return nil, err
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
 		}
-		req.Header.Set("Authorization", "Bearer "+c.ApiKey)
+		delay *= 2
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, method, path string, body []byte) (*rbody.ApiResponse, error) {
+	var b io.Reader
+	if body != nil {
+		b = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.prefix+path, b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.ApiKey)
+	if c.OrgId != 0 {
+		req.Header.Set(orgIdHeader, strconv.FormatInt(c.OrgId, 10))
+	}
+	if body != nil {
 		req.Header.Add("Content-Type", "application/json")
-		rsp, err = c.http.Do(req)
-		if err != nil {
-			return nil, err
+	}
+	rsp, err := ctxhttp.Do(ctx, c.http, req)
+	if err != nil {
+		return nil, &retryError{err: err}
+	}
+	if rsp.StatusCode == 429 || rsp.StatusCode >= 500 {
+		rsp.Body.Close()
+		rerr := &retryError{err: fmt.Errorf("Unknown error encountered. %s", rsp.Status)}
+		if seconds, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil {
+			rerr.retryAfter = time.Duration(seconds) * time.Second
 		}
+		return nil, rerr
 	}
-
-	return handleResp(rsp)
+	resp, err := handleResp(rsp)
+	if err != nil {
+		return nil, err
+	}
+	// the API reports most errors in the response body.
+	if resp.Meta != nil && resp.Meta.Code >= 500 {
+		return resp, &retryError{err: resp.Error()}
+	}
+	return resp, nil
 }
 
 func handleResp(rsp *http.Response) (*rbody.ApiResponse, error) {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/raintank/raintank-apps/task-server/model"
 	"github.com/raintank/raintank-apps/task-server/sqlstore"
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -181,6 +184,13 @@ func TestApiClient(t *testing.T) {
 				query := model.GetAgentsQuery{}
 				agents, err := c.GetAgents(&query)
 
+				So(err, ShouldBeNil)
+				So(len(agents), ShouldEqual, agentCount)
+			})
+			Convey("When walking all pages of Agents", func() {
+				query := model.GetAgentsQuery{Limit: 1}
+				agents, err := c.GetAllAgents(context.Background(), query)
+
 				So(err, ShouldBeNil)
 				So(len(agents), ShouldEqual, agentCount)
 			})
@@ -316,3 +326,49 @@ func TestApiClient(t *testing.T) {
 		})
 	})
 }
+
+func TestClientRetries(t *testing.T) {
+	var calls, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= atomic.LoadInt32(&failures) {
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprint(w, `{"meta":{"code":200,"message":"success","type":"heartbeat"},"body":null}`)
+	}))
+	defer server.Close()
+
+	Convey("Given a server that fails requests", t, func() {
+		c, err := New(server.URL, adminKey, false)
+		So(err, ShouldBeNil)
+		c.RetryDelay = time.Millisecond
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&failures, 2)
+
+		Convey("GET requests are retried", func() {
+			ok, err := c.Heartbeat()
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 3)
+		})
+		Convey("POST requests are not retried", func() {
+			err := c.AddAgent(&model.AgentDTO{Name: "demo"})
+			So(err, ShouldNotBeNil)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+		})
+		Convey("requests fail once the retries are used up", func() {
+			c.Retries = 1
+			_, err := c.Heartbeat()
+			So(err, ShouldNotBeNil)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+		})
+		Convey("retries stop when the context is done", func() {
+			c.RetryDelay = time.Minute
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+			defer cancel()
+			_, err := c.HeartbeatContext(ctx)
+			So(err, ShouldEqual, context.DeadlineExceeded)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,327 @@
+package clienttest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// AddAgent stores a copy of a for orgId, without any validation, and
+// returns the stored agent with its Id set.
+func (s *Server) AddAgent(orgId int64, a *model.AgentDTO) *model.AgentDTO {
+	s.Lock()
+	defer s.Unlock()
+	agent := *a
+	s.nextAgentId++
+	agent.Id = s.nextAgentId
+	agent.OrgId = orgId
+	if agent.Tags == nil {
+		agent.Tags = make([]string, 0)
+	}
+	now := time.Now()
+	agent.EnabledChange = now
+	agent.OnlineChange = now
+	agent.Created = now
+	agent.Updated = now
+	s.agents[agent.Id] = &agent
+	return copyAgent(&agent)
+}
+
+// SetAgentOnline changes whether an agent is connected.  The fake never
+// changes it by itself.
+func (s *Server) SetAgentOnline(id int64, online bool) error {
+	s.Lock()
+	defer s.Unlock()
+	a, ok := s.agents[id]
+	if !ok {
+		return model.AgentNotFound
+	}
+	if a.Online != online {
+		a.Online = online
+		a.OnlineChange = time.Now()
+	}
+	return nil
+}
+
+// SetAgentMetrics sets the metric catalog of an agent, as if the agent had
+// sent it.  Metrics that are not yet known are added for the agent's org,
+// and are public if the agent is.
+func (s *Server) SetAgentMetrics(id int64, metrics []*model.Metric) error {
+	s.Lock()
+	defer s.Unlock()
+	a, ok := s.agents[id]
+	if !ok {
+		return model.AgentNotFound
+	}
+	catalog := make([]*model.Metric, len(metrics))
+	for i, m := range metrics {
+		metric := *m
+		metric.OrgId = a.OrgId
+		metric.Public = a.Public
+		catalog[i] = &metric
+		if !s.hasMetric(&metric) {
+			s.addMetric(&metric)
+		}
+	}
+	s.agentMetrics[id] = catalog
+	return nil
+}
+
+// Agents returns a copy of every agent, sorted by id.
+func (s *Server) Agents() []*model.AgentDTO {
+	s.Lock()
+	defer s.Unlock()
+	agents := make([]*model.AgentDTO, 0, len(s.agents))
+	for _, a := range s.agents {
+		agents = append(agents, copyAgent(a))
+	}
+	sort.Sort(agentsById(agents))
+	return agents
+}
+
+func copyAgent(a *model.AgentDTO) *model.AgentDTO {
+	agent := *a
+	agent.Tags = append(make([]string, 0, len(a.Tags)), a.Tags...)
+	return &agent
+}
+
+type agentsById []*model.AgentDTO
+
+func (a agentsById) Len() int           { return len(a) }
+func (a agentsById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a agentsById) Less(i, j int) bool { return a[i].Id < a[j].Id }
+
+// agentsBy sorts agents by one of the columns of the agent table.
+type agentsBy struct {
+	agentsById
+	less func(a, b *model.AgentDTO) bool
+}
+
+func (a agentsBy) Less(i, j int) bool {
+	return a.less(a.agentsById[i], a.agentsById[j])
+}
+
+var agentOrder = map[string]func(a, b *model.AgentDTO) bool{
+	"id":      func(a, b *model.AgentDTO) bool { return a.Id < b.Id },
+	"name":    func(a, b *model.AgentDTO) bool { return a.Name < b.Name },
+	"enabled": func(a, b *model.AgentDTO) bool { return !a.Enabled && b.Enabled },
+	"public":  func(a, b *model.AgentDTO) bool { return !a.Public && b.Public },
+	"online":  func(a, b *model.AgentDTO) bool { return !a.Online && b.Online },
+	"created": func(a, b *model.AgentDTO) bool { return a.Created.Before(b.Created) },
+	"updated": func(a, b *model.AgentDTO) bool { return a.Updated.Before(b.Updated) },
+}
+
+func (s *Server) getAgents(w http.ResponseWriter, orgId int64, r *http.Request) {
+	params := r.URL.Query()
+	query := model.GetAgentsQuery{
+		Name:    params.Get("name"),
+		Metric:  params.Get("metric"),
+		Enabled: params.Get("enabled"),
+		Public:  params.Get("public"),
+		Tag:     params["tag"],
+		OrderBy: params.Get("orderBy"),
+		OrgId:   orgId,
+	}
+	var err error
+	if query.Limit, err = intParam(params.Get("limit")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	if query.Page, err = intParam(params.Get("page")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	enabled, err := parseBool(query.Enabled)
+	if err != nil {
+		writeJSON(w, 200, rbody.ErrResp(500, err))
+		return
+	}
+	public, err := parseBool(query.Public)
+	if err != nil {
+		writeJSON(w, 200, rbody.ErrResp(500, err))
+		return
+	}
+	if query.OrderBy == "" {
+		query.OrderBy = "name"
+	}
+	less, ok := agentOrder[query.OrderBy]
+	if !ok {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("no such column: %s", query.OrderBy)))
+		return
+	}
+
+	agents := make([]*model.AgentDTO, 0)
+	for _, a := range s.agents {
+		switch {
+		case public == nil && a.OrgId != orgId && !a.Public:
+			continue
+		case public != nil && *public && !a.Public:
+			continue
+		case public != nil && !*public && (a.Public || a.OrgId != orgId):
+			continue
+		case query.Name != "" && a.Name != query.Name:
+			continue
+		case enabled != nil && a.Enabled != *enabled:
+			continue
+		case len(query.Tag) > 0 && !hasAnyTag(a, query.Tag):
+			continue
+		case query.Metric != "" && !s.agentHasMetric(a.Id, query.Metric):
+			continue
+		}
+		agents = append(agents, copyAgent(a))
+	}
+	sort.Sort(agentsById(agents))
+	sort.Stable(agentsBy{agentsById(agents), less})
+	start, end := page(len(agents), query.Limit, query.Page)
+	writeJSON(w, 200, rbody.OkResp("agents", agents[start:end]))
+}
+
+func hasAnyTag(a *model.AgentDTO, tags []string) bool {
+	for _, t := range a.Tags {
+		for _, tag := range tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) agentHasMetric(id int64, namespace string) bool {
+	for _, m := range s.agentMetrics[id] {
+		if like(namespace, m.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAgent returns the agent with id if it is owned by orgId.
+func (s *Server) getAgent(orgId, id int64) *model.AgentDTO {
+	a, ok := s.agents[id]
+	if !ok || a.OrgId != orgId {
+		return nil
+	}
+	return a
+}
+
+func (s *Server) getAgentById(w http.ResponseWriter, orgId, id int64) {
+	a := s.getAgent(orgId, id)
+	if a == nil {
+		writeJSON(w, 200, rbody.ErrResp(404, fmt.Errorf("agent not found")))
+		return
+	}
+	writeJSON(w, 200, rbody.OkResp("agent", copyAgent(a)))
+}
+
+func (s *Server) getAgentMetrics(w http.ResponseWriter, orgId, id int64) {
+	if s.getAgent(orgId, id) == nil {
+		writeJSON(w, 200, rbody.ErrResp(404, fmt.Errorf("agent not found")))
+		return
+	}
+	metrics := make([]*model.Metric, 0)
+	for _, m := range s.agentMetrics[id] {
+		metric := *m
+		metrics = append(metrics, &metric)
+	}
+	writeJSON(w, 200, rbody.OkResp("metrics", metrics))
+}
+
+func (s *Server) addAgent(w http.ResponseWriter, orgId int64, r *http.Request) {
+	agent := new(model.AgentDTO)
+	if !decodeAgent(w, r, agent) {
+		return
+	}
+	if !agent.ValidName() {
+		writeJSON(w, 400, "invalde agent Name. must match /^[0-9a-Z_-]+$/")
+		return
+	}
+	if s.agentNameTaken(orgId, agent.Name, 0) {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("UNIQUE constraint failed: agent.name, agent.org_id")))
+		return
+	}
+	agent.Id = 0
+	agent.OrgId = orgId
+	agent.Online = false
+	if agent.Tags == nil {
+		agent.Tags = make([]string, 0)
+	}
+	now := time.Now()
+	agent.EnabledChange = now
+	agent.OnlineChange = now
+	agent.Created = now
+	agent.Updated = now
+	s.nextAgentId++
+	agent.Id = s.nextAgentId
+	s.agents[agent.Id] = agent
+	writeJSON(w, 200, rbody.OkResp("agent", copyAgent(agent)))
+}
+
+func (s *Server) updateAgent(w http.ResponseWriter, orgId int64, r *http.Request) {
+	agent := new(model.AgentDTO)
+	if !decodeAgent(w, r, agent) {
+		return
+	}
+	if !agent.ValidName() {
+		writeJSON(w, 200, rbody.ErrResp(400, fmt.Errorf("invalid agent Name. must match /^[0-9a-Z_-]+$/")))
+		return
+	}
+	if agent.Id == 0 {
+		writeJSON(w, 200, rbody.ErrResp(400, fmt.Errorf("agent ID not set.")))
+		return
+	}
+	existing := s.getAgent(orgId, agent.Id)
+	if existing == nil {
+		writeJSON(w, 200, rbody.ErrResp(500, model.AgentNotFound))
+		return
+	}
+	if s.agentNameTaken(orgId, agent.Name, agent.Id) {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("UNIQUE constraint failed: agent.name, agent.org_id")))
+		return
+	}
+	if existing.Enabled != agent.Enabled {
+		existing.EnabledChange = time.Now()
+	}
+	existing.Name = agent.Name
+	existing.Enabled = agent.Enabled
+	existing.Public = agent.Public
+	existing.Tags = append(make([]string, 0, len(agent.Tags)), agent.Tags...)
+	existing.Updated = time.Now()
+	writeJSON(w, 200, rbody.OkResp("agent", copyAgent(existing)))
+}
+
+// decodeAgent reads an agent from the request and checks the fields the
+// API's request binding requires.
+func decodeAgent(w http.ResponseWriter, r *http.Request, agent *model.AgentDTO) bool {
+	if !decode(w, r, agent) {
+		return false
+	}
+	if agent.Name == "" {
+		requiredError(w, "Name")
+		return false
+	}
+	return true
+}
+
+func (s *Server) agentNameTaken(orgId int64, name string, id int64) bool {
+	for _, a := range s.agents {
+		if a.OrgId == orgId && a.Name == name && a.Id != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) deleteAgent(w http.ResponseWriter, orgId, id int64) {
+	if s.getAgent(orgId, id) == nil {
+		writeJSON(w, 200, rbody.ErrResp(404, fmt.Errorf("agent not found")))
+		return
+	}
+	delete(s.agents, id)
+	delete(s.agentMetrics, id)
+	writeJSON(w, 200, rbody.OkResp("agent", nil))
+}
@@ -0,0 +1,110 @@
+package clienttest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// AddMetric adds a copy of m to the metrics known to orgId.  Public metrics
+// are visible to every org.
+func (s *Server) AddMetric(orgId int64, m *model.Metric) {
+	s.Lock()
+	defer s.Unlock()
+	metric := *m
+	metric.OrgId = orgId
+	if !s.hasMetric(&metric) {
+		s.addMetric(&metric)
+	}
+}
+
+// Metrics returns a copy of every metric, sorted by namespace.
+func (s *Server) Metrics() []*model.Metric {
+	s.Lock()
+	defer s.Unlock()
+	metrics := make([]*model.Metric, len(s.metrics))
+	for i, m := range s.metrics {
+		metric := *m
+		metrics[i] = &metric
+	}
+	sort.Stable(metricsByNamespace(metrics))
+	return metrics
+}
+
+type metricsByNamespace []*model.Metric
+
+func (m metricsByNamespace) Len() int           { return len(m) }
+func (m metricsByNamespace) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m metricsByNamespace) Less(i, j int) bool { return m[i].Namespace < m[j].Namespace }
+
+func (s *Server) hasMetric(m *model.Metric) bool {
+	for _, existing := range s.metrics {
+		if existing.OrgId == m.OrgId && existing.Public == m.Public &&
+			existing.Namespace == m.Namespace && existing.Version == m.Version {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) addMetric(m *model.Metric) {
+	m.Id = int64(len(s.metrics) + 1)
+	if m.Created.IsZero() {
+		m.Created = time.Now()
+	}
+	s.metrics = append(s.metrics, m)
+}
+
+// findMetrics returns the metrics visible to query.OrgId that match the
+// namespace and version of the query.
+func (s *Server) findMetrics(query *model.GetMetricsQuery) []*model.Metric {
+	metrics := make([]*model.Metric, 0)
+	for _, m := range s.metrics {
+		switch {
+		case !m.Public && m.OrgId != query.OrgId:
+			continue
+		case query.Namespace != "" && !like(query.Namespace, m.Namespace):
+			continue
+		case query.Version != 0 && m.Version != query.Version:
+			continue
+		}
+		metric := *m
+		metrics = append(metrics, &metric)
+	}
+	sort.Stable(metricsByNamespace(metrics))
+	return metrics
+}
+
+func (s *Server) getMetrics(w http.ResponseWriter, orgId int64, r *http.Request) {
+	params := r.URL.Query()
+	query := model.GetMetricsQuery{
+		Namespace: params.Get("namespace"),
+		OrderBy:   params.Get("orderBy"),
+		OrgId:     orgId,
+	}
+	version, err := intParam(params.Get("version"))
+	if err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	query.Version = int64(version)
+	if query.Limit, err = intParam(params.Get("limit")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	if query.Page, err = intParam(params.Get("page")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	if query.OrderBy != "" && query.OrderBy != "namespace" {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("no such column: %s", query.OrderBy)))
+		return
+	}
+	metrics := s.findMetrics(&query)
+	start, end := page(len(metrics), query.Limit, query.Page)
+	writeJSON(w, 200, rbody.OkResp("metrics", metrics[start:end]))
+}
@@ -0,0 +1,362 @@
+// Package clienttest provides an in-memory stand-in for the task-server REST
+// API, so that code using task-server/client can be tested without a
+// database.  It implements the agents, tasks and metrics endpoints, wraps
+// every response in the same rbody.ApiResponse envelope as the real API,
+// and can be told to fail requests or delay responses.
+package clienttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+const (
+	// DefaultApiKey is accepted by every new Server, for DefaultOrgId.
+	DefaultApiKey = "test-key"
+	DefaultOrgId  = 1
+)
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	// Path is relative to /api/v1, eg. "/agents/1".
+	Path  string
+	Query string
+	OrgId int64
+}
+
+// Failure describes requests the server should fail instead of handling.
+type Failure struct {
+	// Method and Path select the requests to fail.  An empty Method
+	// matches every method.  Path is matched against the request path
+	// relative to /api/v1 using path.Match, so "/agents/*" matches
+	// "/agents/1".  An empty Path matches every request.
+	Method string
+	Path   string
+	// Status is the HTTP status code to respond with.  If it is 0 the
+	// response is HTTP 200 with Code and Message in the envelope, which
+	// is how the API reports most errors.
+	Status  int
+	Code    int
+	Message string
+	// RetryAfter sets the Retry-After header of the response.
+	RetryAfter time.Duration
+	// Count is the number of requests to fail.  If it is 0, every
+	// matching request fails until ClearFailures is called.
+	Count int
+}
+
+func (f *Failure) matches(method, p string) bool {
+	if f.Method != "" && f.Method != method {
+		return false
+	}
+	if f.Path == "" {
+		return true
+	}
+	ok, err := path.Match(f.Path, p)
+	return err == nil && ok
+}
+
+// Server is a fake task-server.  All state is held in memory and can be
+// inspected and changed by tests.
+//
+// Validation follows the real API closely enough for consumers: agent names
+// must be valid and unique within an org, tasks need a valid route and
+// metrics that exist, and provisioned tasks are read-only.  Tasks are not
+// routed to agents.
+type Server struct {
+	sync.Mutex
+	*httptest.Server
+	keys         map[string]*auth.SignedInUser
+	agents       map[int64]*model.AgentDTO
+	agentMetrics map[int64][]*model.Metric
+	tasks        map[int64]*model.TaskDTO
+	metrics      []*model.Metric
+	nextAgentId  int64
+	nextTaskId   int64
+	failures     []*Failure
+	latency      time.Duration
+	requests     []Request
+}
+
+// NewServer starts a fake task-server.  The caller should Close it when
+// finished.
+func NewServer() *Server {
+	s := &Server{
+		keys:         map[string]*auth.SignedInUser{DefaultApiKey: {OrgId: DefaultOrgId, Role: auth.ROLE_ADMIN}},
+		agents:       make(map[int64]*model.AgentDTO),
+		agentMetrics: make(map[int64][]*model.Metric),
+		tasks:        make(map[int64]*model.TaskDTO),
+		metrics:      make([]*model.Metric, 0),
+		requests:     make([]Request, 0),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// NewClient returns a client for the server using DefaultApiKey.  Retries
+// are made without delay.
+func (s *Server) NewClient() *client.Client {
+	c, err := client.New(s.URL, DefaultApiKey, false)
+	if err != nil {
+		// only possible if the httptest URL can not be parsed.
+		panic(err)
+	}
+	c.RetryDelay = 0
+	return c
+}
+
+// AddApiKey makes the server accept key for orgId.  Admin keys can act on
+// behalf of another org by setting the X-Org-Id header.
+func (s *Server) AddApiKey(key string, orgId int64, isAdmin bool) {
+	s.Lock()
+	s.keys[key] = &auth.SignedInUser{OrgId: orgId, Role: auth.ROLE_ADMIN, IsAdmin: isAdmin}
+	s.Unlock()
+}
+
+// Fail adds a failure.  Failures are checked in the order they were added
+// and the first that matches a request is used.
+func (s *Server) Fail(f Failure) {
+	s.Lock()
+	s.failures = append(s.failures, &f)
+	s.Unlock()
+}
+
+// ClearFailures removes all failures.
+func (s *Server) ClearFailures() {
+	s.Lock()
+	s.failures = nil
+	s.Unlock()
+}
+
+// SetLatency delays every response by d, eg. to test timeouts.  A delayed
+// request is dropped as soon as the client gives up on it.
+func (s *Server) SetLatency(d time.Duration) {
+	s.Lock()
+	s.latency = d
+	s.Unlock()
+}
+
+// Requests returns the requests received so far, including retries and
+// failed requests.
+func (s *Server) Requests() []Request {
+	s.Lock()
+	defer s.Unlock()
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	latency := s.latency
+	s.Unlock()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	p := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/"+client.Version), "/")
+	if p == r.URL.Path {
+		writeJSON(w, 404, "Not found")
+		return
+	}
+	if p == "" {
+		p = "/"
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	orgId, status, msg := s.authenticate(r)
+	s.requests = append(s.requests, Request{Method: r.Method, Path: p, Query: r.URL.RawQuery, OrgId: orgId})
+	if status != 200 {
+		writeJSON(w, status, msg)
+		return
+	}
+	if f := s.failure(r.Method, p); f != nil {
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter/time.Second)))
+		}
+		if f.Status != 0 {
+			writeJSON(w, f.Status, f.Message)
+			return
+		}
+		writeJSON(w, 200, rbody.ErrResp(f.Code, fmt.Errorf("%s", f.Message)))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	var id int64
+	if len(parts) > 1 {
+		var err error
+		if id, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			writeJSON(w, 404, "Not found")
+			return
+		}
+	}
+	switch {
+	case p == "/" && r.Method == "GET":
+		writeJSON(w, 200, rbody.OkResp("heartbeat", nil))
+	case p == "/agents" && r.Method == "GET":
+		s.getAgents(w, orgId, r)
+	case p == "/agents" && r.Method == "POST":
+		s.addAgent(w, orgId, r)
+	case p == "/agents" && r.Method == "PUT":
+		s.updateAgent(w, orgId, r)
+	case len(parts) == 2 && parts[0] == "agents" && r.Method == "GET":
+		s.getAgentById(w, orgId, id)
+	case len(parts) == 2 && parts[0] == "agents" && r.Method == "DELETE":
+		s.deleteAgent(w, orgId, id)
+	case len(parts) == 3 && parts[0] == "agents" && parts[2] == "metrics" && r.Method == "GET":
+		s.getAgentMetrics(w, orgId, id)
+	case p == "/tasks" && r.Method == "GET":
+		s.getTasks(w, orgId, r)
+	case p == "/tasks" && r.Method == "POST":
+		s.addTask(w, orgId, r)
+	case p == "/tasks" && r.Method == "PUT":
+		s.updateTask(w, orgId, r)
+	case len(parts) == 2 && parts[0] == "tasks" && r.Method == "GET":
+		s.getTaskById(w, orgId, id)
+	case len(parts) == 2 && parts[0] == "tasks" && r.Method == "DELETE":
+		s.deleteTask(w, orgId, id)
+	case p == "/metrics" && r.Method == "GET":
+		s.getMetrics(w, orgId, r)
+	default:
+		writeJSON(w, 404, "Not found")
+	}
+}
+
+// authenticate returns the org of the request, or the HTTP status and
+// message the API responds with when authentication fails.
+func (s *Server) authenticate(r *http.Request) (int64, int, string) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return 0, 401, "Unauthorized"
+	}
+	user, ok := s.keys[parts[1]]
+	if !ok {
+		return 0, 401, "Unauthorized"
+	}
+	user, status, err := auth.ApplyOrgOverride(user, r)
+	if err != nil {
+		return 0, status, err.Error()
+	}
+	return user.OrgId, 200, ""
+}
+
+// failure returns the first failure matching the request, and uses it up.
+func (s *Server) failure(method, p string) *Failure {
+	for i, f := range s.failures {
+		if !f.matches(method, p) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decode reads a JSON request body into v.  If it can not be decoded the
+// error is sent and false returned.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, 400, err.Error())
+		return false
+	}
+	return true
+}
+
+// requiredError responds the way the API's request binding does when a
+// required field is missing.
+func requiredError(w http.ResponseWriter, field string) {
+	writeJSON(w, 422, []map[string]interface{}{{
+		"fieldNames":     []string{field},
+		"classification": "RequiredError",
+		"message":        "Required",
+	}})
+}
+
+func intParam(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// parseBool parses the enabled and public query parameters.  The result is
+// nil if the parameter was not set.
+func parseBool(s string) (*bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// like matches s against a SQL "like" pattern.  "*" is also treated as a
+// wildcard, as the stores replace it with "%" for some queries.
+func like(pattern, s string) bool {
+	expr := "(?i)^"
+	for _, c := range pattern {
+		switch c {
+		case '%', '*':
+			expr += ".*"
+		case '_':
+			expr += "."
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	re, err := regexp.Compile(expr + "$")
+	return err == nil && re.MatchString(s)
+}
+
+// page returns the start and end indexes of a page of n items, applying
+// the API's defaults of 50 items per page and the first page.
+func page(n, limit, page int) (int, int) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * limit
+	if start > n {
+		start = n
+	}
+	end := start + limit
+	if end > n {
+		end = n
+	}
+	return start, end
+}
@@ -0,0 +1,191 @@
+package clienttest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+)
+
+func TestAgents(t *testing.T) {
+	Convey("Given a fake task-server", t, func() {
+		s := NewServer()
+		Reset(s.Close)
+		c := s.NewClient()
+
+		Convey("agents can be added, changed and deleted", func() {
+			agent := &model.AgentDTO{Name: "probe1", Enabled: true, Tags: []string{"foo"}}
+			So(c.AddAgent(agent), ShouldBeNil)
+			So(agent.Id, ShouldEqual, 1)
+			So(s.Agents()[0].OrgId, ShouldEqual, DefaultOrgId)
+
+			agent.Tags = []string{"bar"}
+			So(c.UpdateAgent(agent), ShouldBeNil)
+			found, err := c.GetAgentById(agent.Id)
+			So(err, ShouldBeNil)
+			So(found.Tags, ShouldResemble, []string{"bar"})
+
+			So(c.DeleteAgent(agent), ShouldBeNil)
+			_, err = c.GetAgentById(agent.Id)
+			So(err, ShouldResemble, rbody.ApiError{Code: 404, Message: "agent not found"})
+		})
+
+		Convey("invalid and duplicate names are rejected", func() {
+			So(c.AddAgent(&model.AgentDTO{Name: "probe 1"}), ShouldNotBeNil)
+			So(c.AddAgent(&model.AgentDTO{Name: "probe1"}), ShouldBeNil)
+			err := c.AddAgent(&model.AgentDTO{Name: "probe1"})
+			So(err, ShouldHaveSameTypeAs, rbody.ApiError{})
+			So(err.(rbody.ApiError).Code, ShouldEqual, 500)
+		})
+
+		Convey("agents are filtered by org, tag and metric", func() {
+			a := s.AddAgent(DefaultOrgId, &model.AgentDTO{Name: "a", Tags: []string{"foo"}})
+			s.AddAgent(DefaultOrgId, &model.AgentDTO{Name: "b", Tags: []string{"bar"}})
+			s.AddAgent(2, &model.AgentDTO{Name: "c", Public: true})
+			s.AddAgent(2, &model.AgentDTO{Name: "d"})
+			So(s.SetAgentMetrics(a.Id, []*model.Metric{{Namespace: "/worldping/a/b/ping/avg", Version: 1}}), ShouldBeNil)
+
+			agents, err := c.GetAgents(&model.GetAgentsQuery{})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 3)
+			So(agents[2].Name, ShouldEqual, "c")
+
+			agents, err = c.GetAgents(&model.GetAgentsQuery{Tag: []string{"foo", "baz"}})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 1)
+			So(agents[0].Name, ShouldEqual, "a")
+
+			agents, err = c.GetAgents(&model.GetAgentsQuery{Metric: "/worldping/*/*/ping/*"})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 1)
+			So(agents[0].Id, ShouldEqual, a.Id)
+
+			agents, err = c.GetAgents(&model.GetAgentsQuery{Public: "false"})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 2)
+		})
+
+		Convey("all pages of agents can be fetched", func() {
+			for i := 0; i < 120; i++ {
+				s.AddAgent(DefaultOrgId, &model.AgentDTO{Name: fmt.Sprintf("probe%03d", i)})
+			}
+			agents, err := c.GetAllAgents(context.Background(), model.GetAgentsQuery{})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 120)
+			So(agents[119].Name, ShouldEqual, "probe119")
+			So(s.Requests(), ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestTasks(t *testing.T) {
+	Convey("Given a fake task-server with some metrics", t, func() {
+		s := NewServer()
+		Reset(s.Close)
+		c := s.NewClient()
+		s.AddMetric(DefaultOrgId, &model.Metric{Namespace: "/testing/demo/demo1", Version: 1})
+		s.AddMetric(DefaultOrgId, &model.Metric{Namespace: "/testing/demo/demo1", Version: 2})
+
+		Convey("tasks are validated and stored", func() {
+			task := &model.TaskDTO{
+				Name:     "task1",
+				Interval: 60,
+				Metrics:  map[string]int64{"/testing/demo/*": 0},
+				Route:    &model.TaskRoute{Type: model.RouteAny},
+				Enabled:  true,
+			}
+			So(c.AddTask(task), ShouldBeNil)
+			So(task.Id, ShouldEqual, 1)
+			So(task.Metrics["/testing/demo/*"], ShouldEqual, 2)
+			So(task.ConfigHash, ShouldNotEqual, "")
+
+			tasks, err := c.GetTasks(&model.GetTasksQuery{Metric: "/testing/demo/*"})
+			So(err, ShouldBeNil)
+			So(tasks, ShouldHaveLength, 1)
+
+			task.Metrics = map[string]int64{"/testing/other": 0}
+			err = c.UpdateTask(task)
+			So(err, ShouldResemble, rbody.ApiError{Code: 400, Message: "no matching metric found."})
+
+			So(c.DeleteTask(task), ShouldBeNil)
+			_, err = c.GetTaskById(task.Id)
+			So(err, ShouldEqual, client.ErrNotFound)
+		})
+
+		Convey("provisioned tasks are read-only", func() {
+			task := s.AddTask(DefaultOrgId, &model.TaskDTO{
+				Name:          "provisioned",
+				Interval:      60,
+				Metrics:       map[string]int64{"/testing/demo/demo1": 1},
+				Route:         &model.TaskRoute{Type: model.RouteAny},
+				ProvisionedBy: "file:/etc/tasks",
+			})
+			err := c.DeleteTask(task)
+			So(err, ShouldResemble, rbody.ApiError{Code: 403, Message: model.TaskReadOnly.Error()})
+			So(s.Tasks(), ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestFailures(t *testing.T) {
+	Convey("Given a fake task-server", t, func() {
+		s := NewServer()
+		Reset(s.Close)
+		c := s.NewClient()
+
+		Convey("unknown api keys are rejected", func() {
+			c.ApiKey = "bad-key"
+			_, err := c.GetAgents(&model.GetAgentsQuery{})
+			So(err, ShouldEqual, client.ErrAuthFailure)
+		})
+
+		Convey("api keys only see their own org", func() {
+			s.AddApiKey("org5-key", 5, false)
+			s.AddAgent(5, &model.AgentDTO{Name: "probe1"})
+			agents, err := c.GetAgents(&model.GetAgentsQuery{})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 0)
+
+			c.ApiKey = "org5-key"
+			agents, err = c.GetAgents(&model.GetAgentsQuery{})
+			So(err, ShouldBeNil)
+			So(agents, ShouldHaveLength, 1)
+		})
+
+		Convey("failed requests are retried", func() {
+			s.Fail(Failure{Method: "GET", Path: "/agents", Status: 503, Count: 2})
+			_, err := c.GetAgents(&model.GetAgentsQuery{})
+			So(err, ShouldBeNil)
+			So(s.Requests(), ShouldHaveLength, 3)
+		})
+
+		Convey("errors in the envelope are returned once retries are used up", func() {
+			s.Fail(Failure{Path: "/agents/*", Code: 500, Message: "database is locked"})
+			_, err := c.GetAgentById(1)
+			So(err, ShouldResemble, rbody.ApiError{Code: 500, Message: "database is locked"})
+			So(s.Requests(), ShouldHaveLength, client.DefaultRetries+1)
+
+			s.ClearFailures()
+			_, err = c.GetAgentById(1)
+			So(err, ShouldResemble, rbody.ApiError{Code: 404, Message: "agent not found"})
+		})
+
+		Convey("slow responses time out", func() {
+			s.SetLatency(time.Millisecond * 200)
+			c.SetTimeout(time.Millisecond * 20)
+			c.Retries = 0
+			_, err := c.Heartbeat()
+			So(err, ShouldNotBeNil)
+
+			c.SetTimeout(time.Second)
+			ok, err := c.Heartbeat()
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
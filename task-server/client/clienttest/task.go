@@ -0,0 +1,288 @@
+package clienttest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/api/rbody"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// AddTask stores a copy of t for orgId, without any validation, and
+// returns the stored task with its Id set.  Use it to add provisioned
+// tasks, which can not be created through the API.
+func (s *Server) AddTask(orgId int64, t *model.TaskDTO) *model.TaskDTO {
+	s.Lock()
+	defer s.Unlock()
+	task := copyTask(t)
+	s.nextTaskId++
+	task.Id = s.nextTaskId
+	task.OrgId = orgId
+	task.Created = time.Now()
+	task.Updated = task.Created
+	task.UpdateConfigHash()
+	s.tasks[task.Id] = task
+	return copyTask(task)
+}
+
+// Tasks returns a copy of every task, sorted by id.
+func (s *Server) Tasks() []*model.TaskDTO {
+	s.Lock()
+	defer s.Unlock()
+	tasks := make([]*model.TaskDTO, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, copyTask(t))
+	}
+	sort.Sort(tasksById(tasks))
+	return tasks
+}
+
+// copyTask copies t and its metrics.  The config and route are shared, as
+// they are replaced rather than changed.
+func copyTask(t *model.TaskDTO) *model.TaskDTO {
+	task := *t
+	task.Metrics = make(map[string]int64, len(t.Metrics))
+	for ns, v := range t.Metrics {
+		task.Metrics[ns] = v
+	}
+	return &task
+}
+
+type tasksById []*model.TaskDTO
+
+func (t tasksById) Len() int           { return len(t) }
+func (t tasksById) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t tasksById) Less(i, j int) bool { return t[i].Id < t[j].Id }
+
+// tasksBy sorts tasks by one of the columns of the task table.
+type tasksBy struct {
+	tasksById
+	less func(a, b *model.TaskDTO) bool
+}
+
+func (t tasksBy) Less(i, j int) bool {
+	return t.less(t.tasksById[i], t.tasksById[j])
+}
+
+var taskOrder = map[string]func(a, b *model.TaskDTO) bool{
+	"id":       func(a, b *model.TaskDTO) bool { return a.Id < b.Id },
+	"name":     func(a, b *model.TaskDTO) bool { return a.Name < b.Name },
+	"org_id":   func(a, b *model.TaskDTO) bool { return a.OrgId < b.OrgId },
+	"interval": func(a, b *model.TaskDTO) bool { return a.Interval < b.Interval },
+	"enabled":  func(a, b *model.TaskDTO) bool { return !a.Enabled && b.Enabled },
+	"created":  func(a, b *model.TaskDTO) bool { return a.Created.Before(b.Created) },
+	"updated":  func(a, b *model.TaskDTO) bool { return a.Updated.Before(b.Updated) },
+}
+
+func (s *Server) getTasks(w http.ResponseWriter, orgId int64, r *http.Request) {
+	params := r.URL.Query()
+	query := model.GetTasksQuery{
+		Name:    params.Get("name"),
+		Metric:  params.Get("metric"),
+		Enabled: params.Get("enabled"),
+		OrderBy: params.Get("orderBy"),
+		OrgId:   orgId,
+	}
+	var err error
+	if query.Limit, err = intParam(params.Get("limit")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	if query.Page, err = intParam(params.Get("page")); err != nil {
+		writeJSON(w, 400, err.Error())
+		return
+	}
+	enabled, err := parseBool(query.Enabled)
+	if err != nil {
+		writeJSON(w, 200, rbody.ErrResp(500, err))
+		return
+	}
+	if query.OrderBy == "" {
+		query.OrderBy = "name"
+	}
+	less, ok := taskOrder[query.OrderBy]
+	if !ok {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("invalid orderBy %q", query.OrderBy)))
+		return
+	}
+
+	tasks := make([]*model.TaskDTO, 0)
+	for _, t := range s.tasks {
+		switch {
+		case t.OrgId != orgId:
+			continue
+		case enabled != nil && t.Enabled != *enabled:
+			continue
+		case query.Name != "" && !like(query.Name, t.Name):
+			continue
+		}
+		if _, ok := t.Metrics[query.Metric]; query.Metric != "" && !ok {
+			continue
+		}
+		tasks = append(tasks, copyTask(t))
+	}
+	// like the API, tasks are ordered by id within the requested order,
+	// and pages count tasks, however many metrics they have.
+	sort.Sort(tasksById(tasks))
+	sort.Stable(tasksBy{tasksById(tasks), less})
+	start, end := page(len(tasks), query.Limit, query.Page)
+	writeJSON(w, 200, rbody.OkResp("tasks", tasks[start:end]))
+}
+
+// getTask returns the task with id if it is owned by orgId.
+func (s *Server) getTask(orgId, id int64) *model.TaskDTO {
+	t, ok := s.tasks[id]
+	if !ok || t.OrgId != orgId {
+		return nil
+	}
+	return t
+}
+
+func (s *Server) getTaskById(w http.ResponseWriter, orgId, id int64) {
+	t := s.getTask(orgId, id)
+	if t == nil {
+		writeJSON(w, 404, "task not found")
+		return
+	}
+	writeJSON(w, 200, rbody.OkResp("task", copyTask(t)))
+}
+
+func (s *Server) addTask(w http.ResponseWriter, orgId int64, r *http.Request) {
+	task := new(model.TaskDTO)
+	if !decodeTask(w, r, task) {
+		return
+	}
+	if !s.validateTask(w, orgId, task) {
+		return
+	}
+	if s.taskNameTaken(orgId, task.Name, 0) {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("UNIQUE constraint failed: task.org_id, task.name")))
+		return
+	}
+	s.nextTaskId++
+	task.Id = s.nextTaskId
+	task.Created = time.Now()
+	task.Updated = task.Created
+	task.UpdateConfigHash()
+	s.tasks[task.Id] = task
+	writeJSON(w, 200, rbody.OkResp("task", copyTask(task)))
+}
+
+func (s *Server) updateTask(w http.ResponseWriter, orgId int64, r *http.Request) {
+	task := new(model.TaskDTO)
+	if !decodeTask(w, r, task) {
+		return
+	}
+	if !s.checkTaskWritable(w, orgId, task.Id) {
+		return
+	}
+	if !s.validateTask(w, orgId, task) {
+		return
+	}
+	existing := s.getTask(orgId, task.Id)
+	if existing == nil {
+		writeJSON(w, 200, rbody.ErrResp(500, model.TaskNotFound))
+		return
+	}
+	if s.taskNameTaken(orgId, task.Name, task.Id) {
+		writeJSON(w, 200, rbody.ErrResp(500, fmt.Errorf("UNIQUE constraint failed: task.org_id, task.name")))
+		return
+	}
+	task.Created = existing.Created
+	task.Updated = time.Now()
+	task.UpdateConfigHash()
+	s.tasks[task.Id] = task
+	writeJSON(w, 200, rbody.OkResp("task", copyTask(task)))
+}
+
+func (s *Server) deleteTask(w http.ResponseWriter, orgId, id int64) {
+	if !s.checkTaskWritable(w, orgId, id) {
+		return
+	}
+	if s.getTask(orgId, id) != nil {
+		delete(s.tasks, id)
+	}
+	writeJSON(w, 200, rbody.OkResp("task", nil))
+}
+
+// checkTaskWritable responds with an error and returns false if the task is
+// provisioned.
+func (s *Server) checkTaskWritable(w http.ResponseWriter, orgId, id int64) bool {
+	if t := s.getTask(orgId, id); t != nil && t.ProvisionedBy != "" {
+		writeJSON(w, 200, rbody.ErrResp(403, model.TaskReadOnly))
+		return false
+	}
+	return true
+}
+
+// decodeTask reads a task from the request and checks the fields the API's
+// request binding requires.
+func decodeTask(w http.ResponseWriter, r *http.Request, task *model.TaskDTO) bool {
+	if !decode(w, r, task) {
+		return false
+	}
+	switch {
+	case task.Name == "":
+		requiredError(w, "Name")
+	case task.Interval == 0:
+		requiredError(w, "Interval")
+	case task.Route == nil:
+		requiredError(w, "Route")
+	case len(task.Metrics) == 0:
+		requiredError(w, "Metrics")
+	default:
+		return true
+	}
+	return false
+}
+
+// validateTask checks the route and metrics of a task the same way the API
+// does, and sets the fields owned by the server.
+func (s *Server) validateTask(w http.ResponseWriter, orgId int64, task *model.TaskDTO) bool {
+	task.OrgId = orgId
+	task.ProvisionedBy = ""
+	task.ExternalName = ""
+
+	ok, err := task.Route.Validate()
+	if err != nil {
+		writeJSON(w, 200, rbody.ErrResp(500, err))
+		return false
+	}
+	if !ok {
+		writeJSON(w, 200, rbody.ErrResp(400, fmt.Errorf("invalid route config")))
+		return false
+	}
+	for namespace, ver := range task.Metrics {
+		matches := s.findMetrics(&model.GetMetricsQuery{
+			Namespace: strings.Replace(namespace, "*", "%", -1),
+			Version:   ver,
+			OrgId:     orgId,
+		})
+		if len(matches) == 0 {
+			writeJSON(w, 200, rbody.ErrResp(400, fmt.Errorf("no matching metric found.")))
+			return false
+		}
+		//Use the latest version available.
+		if ver == 0 {
+			for _, m := range matches {
+				if m.Version > ver {
+					ver = m.Version
+				}
+			}
+			task.Metrics[namespace] = ver
+		}
+	}
+	return true
+}
+
+func (s *Server) taskNameTaken(orgId int64, name string, id int64) bool {
+	for _, t := range s.tasks {
+		if t.OrgId == orgId && t.Name == name && t.Id != id {
+			return true
+		}
+	}
+	return false
+}
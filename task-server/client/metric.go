@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 
 	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
 )
 
 func (c *Client) GetMetrics(q *model.GetMetricsQuery) ([]*model.Metric, error) {
-	resp, err := c.get("/metrics", q)
+	return c.GetMetricsContext(context.Background(), q)
+}
+
+func (c *Client) GetMetricsContext(ctx context.Context, q *model.GetMetricsQuery) ([]*model.Metric, error) {
+	resp, err := c.get(ctx, "/metrics", q)
 	if err != nil {
 		return nil, err
 	}
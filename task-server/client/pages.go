@@ -0,0 +1,111 @@
+package client
+
+import (
+	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
+)
+
+// walkPages calls fetch for each page of a query, starting at *page, until
+// fetch returns fewer than *limit items.  *limit defaults to PageSize.
+func walkPages(limit, page *int, fetch func() (int, error)) error {
+	if *limit == 0 {
+		*limit = PageSize
+	}
+	if *page == 0 {
+		*page = 1
+	}
+	for {
+		n, err := fetch()
+		if err != nil {
+			return err
+		}
+		if n < *limit {
+			return nil
+		}
+		*page++
+	}
+}
+
+// ForEachAgent calls fn for every agent matching q, fetching all pages of
+// results.  If fn returns an error, it is returned and no more agents are
+// fetched.
+func (c *Client) ForEachAgent(ctx context.Context, q model.GetAgentsQuery, fn func(*model.AgentDTO) error) error {
+	return walkPages(&q.Limit, &q.Page, func() (int, error) {
+		agents, err := c.GetAgentsContext(ctx, &q)
+		if err != nil {
+			return 0, err
+		}
+		for _, a := range agents {
+			if err := fn(a); err != nil {
+				return 0, err
+			}
+		}
+		return len(agents), nil
+	})
+}
+
+// GetAllAgents returns every agent matching q.
+func (c *Client) GetAllAgents(ctx context.Context, q model.GetAgentsQuery) ([]*model.AgentDTO, error) {
+	agents := make([]*model.AgentDTO, 0)
+	err := c.ForEachAgent(ctx, q, func(a *model.AgentDTO) error {
+		agents = append(agents, a)
+		return nil
+	})
+	return agents, err
+}
+
+// ForEachTask calls fn for every task matching q, fetching all pages of
+// results.  If fn returns an error, it is returned and no more tasks are
+// fetched.
+func (c *Client) ForEachTask(ctx context.Context, q model.GetTasksQuery, fn func(*model.TaskDTO) error) error {
+	return walkPages(&q.Limit, &q.Page, func() (int, error) {
+		tasks, err := c.GetTasksContext(ctx, &q)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range tasks {
+			if err := fn(t); err != nil {
+				return 0, err
+			}
+		}
+		return len(tasks), nil
+	})
+}
+
+// GetAllTasks returns every task matching q.
+func (c *Client) GetAllTasks(ctx context.Context, q model.GetTasksQuery) ([]*model.TaskDTO, error) {
+	tasks := make([]*model.TaskDTO, 0)
+	err := c.ForEachTask(ctx, q, func(t *model.TaskDTO) error {
+		tasks = append(tasks, t)
+		return nil
+	})
+	return tasks, err
+}
+
+// ForEachMetric calls fn for every metric matching q, fetching all pages
+// of results.  If fn returns an error, it is returned and no more metrics
+// are fetched.
+func (c *Client) ForEachMetric(ctx context.Context, q model.GetMetricsQuery, fn func(*model.Metric) error) error {
+	return walkPages(&q.Limit, &q.Page, func() (int, error) {
+		metrics, err := c.GetMetricsContext(ctx, &q)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range metrics {
+			if err := fn(m); err != nil {
+				return 0, err
+			}
+		}
+		return len(metrics), nil
+	})
+}
+
+// GetAllMetrics returns every metric matching q.
+func (c *Client) GetAllMetrics(ctx context.Context, q model.GetMetricsQuery) ([]*model.Metric, error) {
+	metrics := make([]*model.Metric, 0)
+	err := c.ForEachMetric(ctx, q, func(m *model.Metric) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	return metrics, err
+}
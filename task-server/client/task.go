@@ -5,10 +5,15 @@ import (
 	"fmt"
 
 	"github.com/raintank/raintank-apps/task-server/model"
+	"golang.org/x/net/context"
 )
 
 func (c *Client) GetTasks(q *model.GetTasksQuery) ([]*model.TaskDTO, error) {
-	resp, err := c.get("/tasks", q)
+	return c.GetTasksContext(context.Background(), q)
+}
+
+func (c *Client) GetTasksContext(ctx context.Context, q *model.GetTasksQuery) ([]*model.TaskDTO, error) {
+	resp, err := c.get(ctx, "/tasks", q)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +28,11 @@ func (c *Client) GetTasks(q *model.GetTasksQuery) ([]*model.TaskDTO, error) {
 }
 
 func (c *Client) GetTaskById(id int64) (*model.TaskDTO, error) {
-	resp, err := c.get(fmt.Sprintf("/tasks/%d", id), nil)
+	return c.GetTaskByIdContext(context.Background(), id)
+}
+
+func (c *Client) GetTaskByIdContext(ctx context.Context, id int64) (*model.TaskDTO, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/tasks/%d", id), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +47,11 @@ func (c *Client) GetTaskById(id int64) (*model.TaskDTO, error) {
 }
 
 func (c *Client) AddTask(t *model.TaskDTO) error {
-	resp, err := c.post("/tasks", t)
+	return c.AddTaskContext(context.Background(), t)
+}
+
+func (c *Client) AddTaskContext(ctx context.Context, t *model.TaskDTO) error {
+	resp, err := c.post(ctx, "/tasks", t)
 	if err != nil {
 		return err
 	}
@@ -52,7 +65,11 @@ func (c *Client) AddTask(t *model.TaskDTO) error {
 }
 
 func (c *Client) UpdateTask(t *model.TaskDTO) error {
-	resp, err := c.put("/tasks", t)
+	return c.UpdateTaskContext(context.Background(), t)
+}
+
+func (c *Client) UpdateTaskContext(ctx context.Context, t *model.TaskDTO) error {
+	resp, err := c.put(ctx, "/tasks", t)
 	if err != nil {
 		return err
 	}
@@ -67,7 +84,11 @@ func (c *Client) UpdateTask(t *model.TaskDTO) error {
 }
 
 func (c *Client) DeleteTask(t *model.TaskDTO) error {
-	resp, err := c.delete(fmt.Sprintf("/tasks/%d", t.Id), nil)
+	return c.DeleteTaskContext(context.Background(), t)
+}
+
+func (c *Client) DeleteTaskContext(ctx context.Context, t *model.TaskDTO) error {
+	resp, err := c.delete(ctx, fmt.Sprintf("/tasks/%d", t.Id), nil)
 	if err != nil {
 		return err
 	}
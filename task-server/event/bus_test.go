@@ -0,0 +1,248 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testEvent struct {
+	ts      time.Time
+	Payload string
+}
+
+func (e *testEvent) Type() string {
+	return "test.event"
+}
+
+func (e *testEvent) Timestamp() time.Time {
+	return e.ts
+}
+
+func (e *testEvent) Body() ([]byte, error) {
+	return json.Marshal(e.Payload)
+}
+
+// recorder is a Handler that fails the first failures calls and records the
+// events it is run with.
+type recorder struct {
+	sync.Mutex
+	failures int
+	events   []RawEvent
+	done     chan struct{}
+}
+
+func newRecorder(failures int) *recorder {
+	return &recorder{failures: failures, done: make(chan struct{}, 10)}
+}
+
+func (r *recorder) handle(e RawEvent) error {
+	r.Lock()
+	defer func() {
+		r.Unlock()
+		r.done <- struct{}{}
+	}()
+	r.events = append(r.events, e)
+	if len(r.events) <= r.failures {
+		return fmt.Errorf("attempt %d failed", len(r.events))
+	}
+	return nil
+}
+
+// wait waits for the handler to be run n times, and returns the attempts of
+// each run.
+func (r *recorder) wait(n int) []int {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(time.Second):
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	attempts := make([]int, len(r.events))
+	for i, e := range r.events {
+		attempts[i] = e.Attempts
+	}
+	return attempts
+}
+
+// testMessage returns a message carrying a test.event, as received from a
+// bus that calls ack.
+func testMessage(ack func()) Message {
+	body, _ := json.Marshal(&RawEvent{Type: "test.event", Timestamp: time.Now(), Attempts: 1})
+	return Message{RoutingKey: "test.event", Payload: body, Ack: ack}
+}
+
+// isClosed waits up to timeout for c to be closed.
+func isClosed(c chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	Convey("Given a memory bus", t, func() {
+		pub := make(chan Message)
+		sub := make(chan Message, 1)
+		stopped := make(chan struct{})
+		go func() {
+			NewMemoryBus().Run(pub, sub)
+			close(stopped)
+		}()
+
+		Convey("published messages are received", func() {
+			pub <- Message{RoutingKey: "test.event", Payload: []byte("{}")}
+			So(<-sub, ShouldResemble, Message{RoutingKey: "test.event", Payload: []byte("{}")})
+			close(pub)
+			<-stopped
+		})
+	})
+}
+
+func TestNsqBus(t *testing.T) {
+	Convey("Given an nsq bus", t, func() {
+		Convey("the channel is unique to this process", func() {
+			channel := NewNsqBus("localhost:4150", "events").Channel
+			So(channel, ShouldEndWith, fmt.Sprintf("-%d#ephemeral", os.Getpid()))
+			So(len(channel), ShouldBeLessThanOrEqualTo, 64)
+			So(invalidChannelChars.MatchString(strings.TrimSuffix(channel, "#ephemeral")), ShouldBeFalse)
+		})
+
+		Convey("an unreachable nsqd is not fatal", func() {
+			pub := make(chan Message)
+			stopped := make(chan struct{})
+			go func() {
+				NewNsqBus("127.0.0.1:1", "events").Run(pub, make(chan Message))
+				close(stopped)
+			}()
+			time.Sleep(time.Millisecond * 100)
+			close(pub)
+			select {
+			case <-stopped:
+			case <-time.After(time.Second * 5):
+				So("bus still running", ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+func TestHandle(t *testing.T) {
+	Convey("Given events on a memory bus", t, func() {
+		So(Init(NewMemoryBus()), ShouldBeNil)
+		delay, attempts, deadLetter := RetryDelay, MaxAttempts, DeadLetter
+		RetryDelay = time.Millisecond
+		Reset(func() { RetryDelay, MaxAttempts, DeadLetter = delay, attempts, deadLetter })
+
+		Convey("handlers receive published events", func() {
+			r := newRecorder(0)
+			Handle("test.event", "test-ok", r.handle)
+			So(Publish(&testEvent{ts: time.Now(), Payload: "foo"}, 0), ShouldBeNil)
+			So(r.wait(1), ShouldResemble, []int{1})
+			So(string(r.events[0].Body), ShouldEqual, `"foo"`)
+		})
+
+		Convey("failed events are retried by the same handler", func() {
+			r := newRecorder(2)
+			Handle("test.event", "test-retry", r.handle)
+			So(Publish(&testEvent{ts: time.Now()}, 0), ShouldBeNil)
+			So(r.wait(3), ShouldResemble, []int{1, 2, 3})
+			So(r.events[2].Handler, ShouldEqual, "test-retry")
+		})
+
+		Convey("retries keep the source of the event", func() {
+			r := newRecorder(1)
+			Handle("test.event", "test-source", r.handle)
+			hostname, _ := os.Hostname()
+			body, _ := json.Marshal(&RawEvent{Type: "test.event", Timestamp: time.Now(), Source: "other-server", Attempts: 1})
+			subChan <- Message{RoutingKey: "test.event", Payload: body}
+			So(r.wait(2), ShouldResemble, []int{1, 2})
+			So(r.events[1].Source, ShouldEqual, "other-server")
+			So(r.events[1].RetryBy, ShouldEqual, hostname)
+		})
+
+		Convey("retries by other servers are ignored", func() {
+			r := newRecorder(0)
+			Handle("test.event", "test-other", r.handle)
+			body, _ := json.Marshal(&RawEvent{Type: "test.event", Timestamp: time.Now(), Attempts: 2, Handler: "test-other", RetryBy: "other-server"})
+			acked := make(chan struct{})
+			subChan <- Message{RoutingKey: "test.event", Payload: body, Ack: func() { close(acked) }}
+			So(isClosed(acked, time.Second), ShouldBeTrue)
+			So(r.wait(0), ShouldBeEmpty)
+		})
+
+		Convey("messages are acked once handled", func() {
+			release := make(chan struct{})
+			Handle("test.event", "test-ack", func(e RawEvent) error {
+				<-release
+				return nil
+			})
+			acked := make(chan struct{})
+			subChan <- testMessage(func() { close(acked) })
+			So(isClosed(acked, time.Millisecond*50), ShouldBeFalse)
+			close(release)
+			So(isClosed(acked, time.Second), ShouldBeTrue)
+		})
+
+		Convey("failed messages are acked once the retry is republished", func() {
+			RetryDelay = time.Millisecond * 100
+			r := newRecorder(1)
+			Handle("test.event", "test-ack-retry", r.handle)
+			acked := make(chan struct{})
+			subChan <- testMessage(func() { close(acked) })
+			So(r.wait(1), ShouldResemble, []int{1})
+			So(isClosed(acked, time.Millisecond*50), ShouldBeFalse)
+			So(isClosed(acked, time.Second), ShouldBeTrue)
+			So(r.wait(1), ShouldResemble, []int{1, 2})
+		})
+
+		Convey("events are dead-lettered through the bus after MaxAttempts", func() {
+			MaxAttempts = 2
+			dead := make(chan RawEvent, 1)
+			DeadLetter = func(e RawEvent) error {
+				dead <- e
+				return nil
+			}
+			r := newRecorder(MaxAttempts)
+			Handle("test.event", "test-dead", r.handle)
+			So(Publish(&testEvent{ts: time.Now()}, 0), ShouldBeNil)
+			So(r.wait(2), ShouldResemble, []int{1, 2})
+			select {
+			case e := <-dead:
+				So(e.Handler, ShouldEqual, "test-dead")
+				So(e.Attempts, ShouldEqual, 2)
+				So(e.Error, ShouldEqual, "attempt 2 failed")
+			case <-time.After(time.Second):
+				So("event not dead-lettered", ShouldBeEmpty)
+			}
+		})
+
+		Convey("dead letters are only acked once processed", func() {
+			var calls int32
+			DeadLetter = func(e RawEvent) error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return fmt.Errorf("db unavailable")
+				}
+				return nil
+			}
+			body, _ := json.Marshal(&RawEvent{Type: "test.event", Timestamp: time.Now(), Attempts: 5, Handler: "test"})
+			acked := make(chan struct{})
+			subChan <- Message{Payload: body, DeadLetter: true, Ack: func() { close(acked) }}
+			So(isClosed(acked, time.Millisecond*50), ShouldBeFalse)
+
+			// the bus delivers it again.
+			subChan <- Message{Payload: body, DeadLetter: true, Ack: func() { close(acked) }}
+			So(isClosed(acked, time.Second), ShouldBeTrue)
+		})
+	})
+}
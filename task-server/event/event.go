@@ -2,7 +2,6 @@ package event
 
 import (
 	"encoding/json"
-	"os"
 	"sync"
 	"time"
 
@@ -15,12 +14,32 @@ type Event interface {
 	Body() ([]byte, error)
 }
 
+// Actor is the API user responsible for an event.
+type Actor struct {
+	Id      int64  `json:"id"`
+	Name    string `json:"name"`
+	OrgId   int64  `json:"orgId"`
+	IsAdmin bool   `json:"isAdmin"`
+	// OrgOverride is set when an admin acted on behalf of OrgId.
+	OrgOverride bool `json:"orgOverride,omitempty"`
+}
+
 type RawEvent struct {
 	Type      string          `json:"type"`
 	Timestamp time.Time       `json:"timestamp"`
 	Body      json.RawMessage `json:"payload"`
 	Source    string
 	Attempts  int `json:"attempts"`
+	// Handler is set when an event is republished to be retried, and
+	// names the only Handler that should process it.
+	Handler string `json:"handler,omitempty"`
+	// RetryBy is the task-server that republished the event to be
+	// retried, and the only one that processes the retry.
+	RetryBy string `json:"retryBy,omitempty"`
+	// Error is why the Handler failed, for dead-lettered events.
+	Error string `json:"error,omitempty"`
+	// Actor is set for events caused by an API request.
+	Actor *Actor `json:"actor,omitempty"`
 }
 
 type Handlers struct {
@@ -57,14 +76,24 @@ var (
 	enabled  bool
 )
 
-func Init(rabbitmqUrl, exchange string) error {
+// Bus carries events between task-servers.
+type Bus interface {
+	// Run publishes the messages read from pub and sends every message
+	// received from the bus, including our own, to sub.  Messages with
+	// DeadLetter set are instead kept in a durable dead-letter queue, and
+	// each is sent to sub on only one task-server.
+	Run(pub <-chan Message, sub chan<- Message)
+}
+
+func Init(bus Bus) error {
 	enabled = true
 	handlers = &Handlers{
 		Listeners: make(map[string][]chan<- RawEvent),
 	}
+	retryHandlers = newNamedHandlers()
 	pubChan = make(chan Message, 100)
 	subChan = make(chan Message, 10)
-	go Run(rabbitmqUrl, exchange, pubChan, subChan)
+	go bus.Run(pubChan, subChan)
 	go handleMessages(subChan)
 	return nil
 }
@@ -74,6 +103,15 @@ func Subscribe(t string, channel chan<- RawEvent) {
 }
 
 func Publish(e Event, attempts int) error {
+	return publishEvent(e, attempts, nil)
+}
+
+// PublishAs publishes an event caused by actor.
+func PublishAs(e Event, actor *Actor) error {
+	return publishEvent(e, 0, actor)
+}
+
+func publishEvent(e Event, attempts int, actor *Actor) error {
 	if !enabled {
 		return nil
 	}
@@ -81,40 +119,44 @@ func Publish(e Event, attempts int) error {
 	if err != nil {
 		return err
 	}
-	hostname, _ := os.Hostname()
 	raw := &RawEvent{
 		Type:      e.Type(),
 		Timestamp: e.Timestamp(),
-		Source:    hostname,
 		Body:      payload,
 		Attempts:  attempts + 1,
+		Actor:     actor,
 	}
-	body, err := json.Marshal(raw)
-	if err != nil {
-		return err
-	}
-	msg := Message{
-		RoutingKey: e.Type(),
-		Payload:    body,
-	}
-	pubChan <- msg
-	return nil
+	return publishRaw(raw)
 }
 
 func handleMessages(c chan Message) {
 	for m := range c {
 		go func(msg Message) {
+			ack := msg.Ack
+			if ack == nil {
+				ack = func() {}
+			}
 			e := RawEvent{}
 			err := json.Unmarshal(msg.Payload, &e)
 			if err != nil {
 				log.Error(3, "unable to unmarshal event Message. %s", err)
+				ack()
 				return
 			}
 			log.Debug("processing event of type %s", e.Type)
+			if msg.DeadLetter {
+				handleDeadLetter(e, ack)
+				return
+			}
+			if e.Handler != "" {
+				handleRetry(e, ack)
+				return
+			}
 			//broadcast the event to listeners.
 			for _, ch := range handlers.GetListeners(e.Type) {
 				ch <- e
 			}
+			runHandlers(e, ack)
 		}(m)
 	}
 }
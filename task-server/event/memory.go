@@ -0,0 +1,16 @@
+package event
+
+// MemoryBus delivers events only to listeners in this process.  It is
+// intended for single node deployments and tests, where no broker is
+// available.
+type MemoryBus struct{}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Run(pub <-chan Message, sub chan<- Message) {
+	for msg := range pub {
+		sub <- msg
+	}
+}
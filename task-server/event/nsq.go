@@ -0,0 +1,118 @@
+package event
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/nsqio/go-nsq"
+)
+
+var invalidChannelChars = regexp.MustCompile("[^.a-zA-Z0-9_-]")
+
+// deadLetterChannel is the channel that all task-servers consume dead
+// letters from.  It is not ephemeral, so nsqd keeps dead letters until one
+// of them has processed it.
+const deadLetterChannel = "task-server"
+
+// NsqBus shares events between task-servers through an NSQ topic.  Every
+// task-server consumes from its own ephemeral channel, so that all
+// servers see every event, as with the exclusive queues used by AmqpBus.
+// As with AmqpBus, nsqd being unreachable is retried rather than fatal.
+// Dead letters are published to a separate topic and consumed from a
+// channel shared by all task-servers, so each is processed once.
+type NsqBus struct {
+	NsqdAddr string
+	Topic    string
+	Channel  string
+}
+
+func NewNsqBus(nsqdAddr, topic string) *NsqBus {
+	return &NsqBus{
+		NsqdAddr: nsqdAddr,
+		Topic:    topic,
+		Channel:  nsqChannel(),
+	}
+}
+
+// nsqChannel returns the channel name for this process.  The pid is
+// included so that task-servers sharing a host do not share a channel.
+// Channel names are limited to 64 characters, including the "#ephemeral"
+// suffix, so the hostname is truncated if needed.
+func nsqChannel() string {
+	hostname, _ := os.Hostname()
+	channel := invalidChannelChars.ReplaceAllString(hostname, "_")
+	pid := fmt.Sprintf("-%d", os.Getpid())
+	if len(channel)+len(pid) > 54 {
+		channel = channel[:54-len(pid)]
+	}
+	return channel + pid + "#ephemeral"
+}
+
+func (b *NsqBus) Run(pub <-chan Message, sub chan<- Message) {
+	cfg := nsq.NewConfig()
+	cfg.UserAgent = "raintank-apps-task-server"
+	// messages are only finished once processed, so allow as many in
+	// flight as the event channels hold.
+	cfg.MaxInFlight = 100
+	producer, err := nsq.NewProducer(b.NsqdAddr, cfg)
+	if err != nil {
+		log.Fatal(4, "failed to initialize nsq producer. %s", err)
+	}
+	defer producer.Stop()
+
+	consumer := b.consume(b.Topic, b.Channel, cfg, sub, false)
+	defer consumer.Stop()
+	deadLetters := b.consume(b.deadLetterTopic(), deadLetterChannel, cfg, sub, true)
+	defer deadLetters.Stop()
+
+	for msg := range pub {
+		topic := b.Topic
+		if msg.DeadLetter {
+			topic = b.deadLetterTopic()
+		}
+		// the producer redials nsqd on every publish until it succeeds.
+		for {
+			err := producer.Publish(topic, msg.Payload)
+			if err == nil {
+				break
+			}
+			log.Error(3, "failed to publish event to nsq, retrying. %s", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (b *NsqBus) deadLetterTopic() string {
+	return b.Topic + ".dead-letter"
+}
+
+// consume starts consuming topic on channel and sends the messages to sub.
+func (b *NsqBus) consume(topic, channel string, cfg *nsq.Config, sub chan<- Message, deadLetter bool) *nsq.Consumer {
+	consumer, err := nsq.NewConsumer(topic, channel, cfg)
+	if err != nil {
+		log.Fatal(4, "failed to initialize nsq consumer. %s", err)
+	}
+	consumer.AddHandler(nsq.HandlerFunc(func(m *nsq.Message) error {
+		log.Debug("new message received from nsq topic %s", topic)
+		m.DisableAutoResponse()
+		// the event type is in the payload, nsq has no routing keys.
+		sub <- Message{Payload: m.Body, Ack: m.Finish, DeadLetter: deadLetter}
+		return nil
+	}))
+	// once connected, the consumer reconnects to nsqd by itself.
+	go func() {
+		for {
+			err := consumer.ConnectToNSQD(b.NsqdAddr)
+			if err == nil {
+				break
+			}
+			log.Error(3, "cannot connect to nsqd: %v: %q", err, b.NsqdAddr)
+			time.Sleep(time.Second)
+		}
+		log.Info("subscribed to nsq topic %s on channel %s", topic, channel)
+	}()
+	return consumer
+}
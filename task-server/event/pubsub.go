@@ -13,6 +13,13 @@ import (
 type Message struct {
 	RoutingKey string
 	Payload    []byte
+	// Ack is called once a received message has been processed by every
+	// Handler, so that it is not lost if the task-server stops first.  It
+	// is nil for buses that do not acknowledge messages.
+	Ack func()
+	// DeadLetter is set for messages published to, or received from, the
+	// dead-letter queue.
+	DeadLetter bool
 }
 
 // session composes an amqp.Connection with an amqp.Channel
@@ -73,6 +80,13 @@ func redial(ctx context.Context, url, exchange string) chan chan session {
 					conn.Close()
 					time.Sleep(time.Second)
 				}
+				log.Debug("Ensuring that %s dead-letter queue exists on AMQP server.", deadLetterName(exchange))
+				if err := declareDeadLetter(ch, exchange); err != nil {
+					log.Error(3, "cannot declare dead-letter queue: %v", err)
+					conn.Close()
+					time.Sleep(time.Second)
+					continue
+				}
 				log.Debug("Successfully connected to RabbitMQ.")
 				connected = true
 			}
@@ -89,6 +103,26 @@ func redial(ctx context.Context, url, exchange string) chan chan session {
 	return sessions
 }
 
+// deadLetterName is the name of the exchange that dead-lettered events are
+// published to, and of the durable queue bound to it.
+func deadLetterName(exchange string) string {
+	return exchange + ".dead-letter"
+}
+
+// declareDeadLetter declares the dead-letter exchange and queue.  The queue
+// is durable and shared by all task-servers, so dead letters are kept until
+// one of them has processed it.
+func declareDeadLetter(ch *amqp.Channel, exchange string) error {
+	name := deadLetterName(exchange)
+	if err := ch.ExchangeDeclare(name, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(name, "", name, false, nil)
+}
+
 // publish publishes messages to a reconnecting session to a topic exchange.
 // It receives from the application specific source of messages.
 func publish(sessions chan chan session, exchange string, messages <-chan Message) {
@@ -123,9 +157,12 @@ func publish(sessions chan chan session, exchange string, messages <-chan Messag
 				reading = messages
 
 			case body = <-pending:
-				err := pub.Publish(exchange, body.RoutingKey, false, false, amqp.Publishing{
-					Body: body.Payload,
-				})
+				target, publishing := exchange, amqp.Publishing{Body: body.Payload}
+				if body.DeadLetter {
+					target = deadLetterName(exchange)
+					publishing.DeliveryMode = amqp.Persistent
+				}
+				err := pub.Publish(target, body.RoutingKey, false, false, publishing)
 				// Retry failed delivery on the next session
 				if err != nil {
 					pending <- body
@@ -175,25 +212,59 @@ func subscribe(sessions chan chan session, exchange string, messages chan<- Mess
 			continue
 		}
 
+		deadLetters, err := sub.Consume(deadLetterName(exchange), "", false, false, false, false, nil)
+		if err != nil {
+			log.Error(3, "cannot consume from queue: %q, %v", deadLetterName(exchange), err)
+			sub.Close()
+			continue
+		}
+
 		log.Info("subscribed to rabbitmq %s exchange...", exchange)
 
+		// both delivery channels are closed when the session is lost.
+		go func() {
+			for msg := range deadLetters {
+				log.Debug("new dead letter received from rabbitmq")
+				messages <- amqpMessage(sub, msg, true)
+			}
+		}()
 		for msg := range deliveries {
 			log.Debug("new message received from rabbitmq")
-			messages <- Message{RoutingKey: msg.RoutingKey, Payload: msg.Body}
-			sub.Ack(msg.DeliveryTag, false)
+			messages <- amqpMessage(sub, msg, false)
 		}
 	}
 }
 
-func Run(rabbitmqUrl, exchange string, pub, sub chan Message) {
+// amqpMessage returns the Message for a delivery, to be acked on sub.
+func amqpMessage(sub session, msg amqp.Delivery, deadLetter bool) Message {
+	tag := msg.DeliveryTag
+	return Message{RoutingKey: msg.RoutingKey, Payload: msg.Body, DeadLetter: deadLetter, Ack: func() {
+		if err := sub.Ack(tag, false); err != nil {
+			log.Error(3, "failed to ack message %d. %s", tag, err)
+		}
+	}}
+}
+
+// AmqpBus shares events between task-servers through a RabbitMQ topic
+// exchange.
+type AmqpBus struct {
+	Url      string
+	Exchange string
+}
+
+func NewAmqpBus(rabbitmqUrl, exchange string) *AmqpBus {
+	return &AmqpBus{Url: rabbitmqUrl, Exchange: exchange}
+}
+
+func (b *AmqpBus) Run(pub <-chan Message, sub chan<- Message) {
 	ctx, done := context.WithCancel(context.Background())
 	go func() {
-		publish(redial(ctx, rabbitmqUrl, exchange), exchange, pub)
+		publish(redial(ctx, b.Url, b.Exchange), b.Exchange, pub)
 		done()
 	}()
 
 	go func() {
-		subscribe(redial(ctx, rabbitmqUrl, exchange), exchange, sub)
+		subscribe(redial(ctx, b.Url, b.Exchange), b.Exchange, sub)
 		done()
 	}()
 
@@ -0,0 +1,207 @@
+package event
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+)
+
+var (
+	// MaxAttempts is how many times a Handler is run for an event before
+	// the event is dead-lettered.
+	MaxAttempts = 5
+	// RetryDelay is how long to wait before the first retry.  The delay
+	// doubles with every attempt.
+	RetryDelay = time.Second
+	// DeadLetter is called with events received from the bus's
+	// dead-letter queue, where events that have failed MaxAttempts times
+	// are published.  Each dead letter is received by only one
+	// task-server.  If DeadLetter returns an error the event is not acked,
+	// so that the bus delivers it again.  If nil, dead letters are dropped.
+	DeadLetter func(e RawEvent) error
+)
+
+// Handler processes an event.  Returning an error causes the event to be
+// retried.
+type Handler func(e RawEvent) error
+
+type namedHandlers struct {
+	sync.RWMutex
+	handlers map[string]Handler
+	// names holds the names of the handlers for each event type.
+	names map[string][]string
+}
+
+func (n *namedHandlers) Add(t, name string, h Handler) {
+	n.Lock()
+	n.handlers[name] = h
+	n.names[t] = append(n.names[t], name)
+	n.Unlock()
+}
+
+func (n *namedHandlers) Get(name string) (Handler, bool) {
+	n.RLock()
+	defer n.RUnlock()
+	h, ok := n.handlers[name]
+	return h, ok
+}
+
+// ForType returns the handlers for events of type t, by name.
+func (n *namedHandlers) ForType(t string) map[string]Handler {
+	n.RLock()
+	defer n.RUnlock()
+	handlers := make(map[string]Handler)
+	for key, names := range n.names {
+		if key != "*" && key != t {
+			continue
+		}
+		for _, name := range names {
+			handlers[name] = n.handlers[name]
+		}
+	}
+	return handlers
+}
+
+func newNamedHandlers() *namedHandlers {
+	return &namedHandlers{
+		handlers: make(map[string]Handler),
+		names:    make(map[string][]string),
+	}
+}
+
+var retryHandlers = newNamedHandlers()
+
+// Handle runs h for every event of type t.  Failed events are republished
+// to the bus so that they are retried by the same handler on this server,
+// and after MaxAttempts are published to the bus's dead-letter queue.
+// name must be unique.
+func Handle(t, name string, h Handler) {
+	retryHandlers.Add(t, name, h)
+}
+
+// runHandlers runs every handler for e, and calls done once each has
+// succeeded, had its retry republished or been dead-lettered.
+func runHandlers(e RawEvent, done func()) {
+	handlers := retryHandlers.ForType(e.Type)
+	if len(handlers) == 0 {
+		done()
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(handlers))
+	for name, h := range handlers {
+		go runHandler(name, h, e, wg.Done)
+	}
+	go func() {
+		wg.Wait()
+		done()
+	}()
+}
+
+// runHandler runs h for e and calls done once the event no longer needs
+// the message it was received in.
+func runHandler(name string, h Handler, e RawEvent, done func()) {
+	err := h(e)
+	if err == nil {
+		done()
+		return
+	}
+	if e.Attempts >= MaxAttempts {
+		defer done()
+		log.Error(3, "%s failed to process %s event after %d attempts. %s", name, e.Type, e.Attempts, err)
+		e.Handler = name
+		e.Error = err.Error()
+		if err := publishDeadLetter(&e); err != nil {
+			log.Error(3, "failed to dead-letter %s event. %s", e.Type, err)
+		}
+		return
+	}
+	delay := RetryDelay << uint(e.Attempts-1)
+	log.Warn("%s failed to process %s event (attempt %d). retrying in %s. %s", name, e.Type, e.Attempts, delay, err)
+	time.AfterFunc(delay, func() {
+		defer done()
+		e.Handler = name
+		e.RetryBy, _ = os.Hostname()
+		e.Attempts++
+		if err := publishRaw(&e); err != nil {
+			log.Error(3, "failed to republish %s event. %s", e.Type, err)
+		}
+	})
+}
+
+// handleRetry runs an event that was republished for a specific handler.
+// Retries are only processed by the server that republished them.
+func handleRetry(e RawEvent, done func()) {
+	hostname, _ := os.Hostname()
+	if e.RetryBy != hostname {
+		done()
+		return
+	}
+	h, ok := retryHandlers.Get(e.Handler)
+	if !ok {
+		log.Error(3, "no handler named %s for %s event.", e.Handler, e.Type)
+		done()
+		return
+	}
+	runHandler(e.Handler, h, e, done)
+}
+
+// Replay publishes a dead-lettered event again, with its attempts reset.
+// It is processed by the event's handler on this server.
+func Replay(e RawEvent) error {
+	if !enabled {
+		return nil
+	}
+	e.Attempts = 1
+	e.RetryBy, _ = os.Hostname()
+	e.Error = ""
+	return publishRaw(&e)
+}
+
+// publishRaw publishes raw to every task-server.  Source is only set for
+// new events, so that retries keep the server the event came from.
+func publishRaw(raw *RawEvent) error {
+	if raw.Source == "" {
+		raw.Source, _ = os.Hostname()
+	}
+	body, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	pubChan <- Message{
+		RoutingKey: raw.Type,
+		Payload:    body,
+	}
+	return nil
+}
+
+// publishDeadLetter publishes raw to the bus's dead-letter queue.
+func publishDeadLetter(raw *RawEvent) error {
+	body, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	pubChan <- Message{
+		RoutingKey: raw.Type,
+		Payload:    body,
+		DeadLetter: true,
+	}
+	return nil
+}
+
+// handleDeadLetter passes a message received from the dead-letter queue to
+// DeadLetter.
+func handleDeadLetter(e RawEvent, ack func()) {
+	if DeadLetter == nil {
+		ack()
+		return
+	}
+	if err := DeadLetter(e); err != nil {
+		log.Error(3, "failed to process dead-lettered %s event. It will be delivered again. %s", e.Type, err)
+		return
+	}
+	ack()
+}
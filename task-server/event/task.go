@@ -60,3 +60,26 @@ func (a *TaskUpdated) Timestamp() time.Time {
 func (a *TaskUpdated) Body() ([]byte, error) {
 	return json.Marshal(a.Payload)
 }
+
+// TaskPlacementFailed is published when a task could not be assigned to
+// an agent.
+type TaskPlacementFailed struct {
+	Ts      time.Time
+	Payload struct {
+		Task    *model.TaskDTO `json:"task"`
+		AgentId int64          `json:"agentId"`
+		Reason  string         `json:"reason"`
+	}
+}
+
+func (a *TaskPlacementFailed) Type() string {
+	return "task.placement_failed"
+}
+
+func (a *TaskPlacementFailed) Timestamp() time.Time {
+	return a.Ts
+}
+
+func (a *TaskPlacementFailed) Body() ([]byte, error) {
+	return json.Marshal(a.Payload)
+}
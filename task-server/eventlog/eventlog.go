@@ -0,0 +1,48 @@
+package eventlog
+
+import (
+	"os"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+// Init starts persisting events to the event_log table.  Every task-server
+// receives every event, so each server only saves the events it published.
+// Events older than retention are removed every hour, unless retention
+// is 0.
+func Init(retention time.Duration) {
+	c := make(chan event.RawEvent, 1000)
+	event.Subscribe("*", c)
+	go persist(c)
+	if retention > 0 {
+		go expire(retention)
+	}
+}
+
+func persist(c chan event.RawEvent) {
+	hostname, _ := os.Hostname()
+	for e := range c {
+		if e.Source != hostname {
+			continue
+		}
+		if err := sqlstore.AddEventLog(e); err != nil {
+			log.Error(3, "failed to save %s event to event log. %s", e.Type, err)
+		}
+	}
+}
+
+func expire(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	for {
+		deleted, err := sqlstore.DeleteEventLogsBefore(time.Now().Add(-retention))
+		if err != nil {
+			log.Error(3, "failed to remove expired events from event log. %s", err)
+		} else if deleted > 0 {
+			log.Info("removed %d expired events from event log.", deleted)
+		}
+		<-ticker.C
+	}
+}
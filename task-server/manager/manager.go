@@ -14,29 +14,23 @@ import (
 )
 
 func Init() {
-	agentOfflineChan := make(chan event.RawEvent, 100)
-	event.Subscribe("agent.offline", agentOfflineChan)
-	go HandleAgentOfflineEvents(agentOfflineChan)
-
-	taskCreatedChan := make(chan event.RawEvent, 100)
-	event.Subscribe("task.created", taskCreatedChan)
-	go HandleTaskCreatedEvent(taskCreatedChan)
+	event.Handle("agent.offline", "relocate-agent-tasks", HandleAgentOfflineEvent)
+	event.Handle("task.created", "emit-created-task", HandleTaskCreatedEvent)
 }
 
-func HandleAgentOfflineEvents(c chan event.RawEvent) {
-	for event := range c {
-		agent := new(model.AgentDTO)
-		err := json.Unmarshal(event.Body, agent)
-		if err != nil {
-			log.Error(3, "Unable to unmarshal agentOffline event. %s", err)
-			continue
-		}
-		log.Debug("Processing agentOffline event for %s", agent.Name)
-		go handleAgentOffline(event.Source, agent)
+func HandleAgentOfflineEvent(e event.RawEvent) error {
+	agent := new(model.AgentDTO)
+	err := json.Unmarshal(e.Body, agent)
+	if err != nil {
+		// retrying will not help.
+		log.Error(3, "Unable to unmarshal agentOffline event. %s", err)
+		return nil
 	}
+	log.Debug("Processing agentOffline event for %s", agent.Name)
+	return handleAgentOffline(e.Source, agent)
 }
 
-func handleAgentOffline(source string, a *model.AgentDTO) {
+func handleAgentOffline(source string, a *model.AgentDTO) error {
 	// sleep 1 second before checking if agent is still offline.
 	hostname, _ := os.Hostname()
 	delay := time.Second
@@ -47,32 +41,34 @@ func handleAgentOffline(source string, a *model.AgentDTO) {
 	time.Sleep(delay)
 	//check if agent is still offline.
 	currentState, err := sqlstore.GetAgentById(a.Id, 0)
+	if err == model.AgentNotFound {
+		// agent has been deleted. Nothing further to do.
+		return nil
+	}
 	if err != nil {
 		log.Error(3, "Failed to get current agent state from DB. %s", err)
-		return
+		return err
 	}
 	if currentState.Online {
 		// agent is online again. Nothing further to do.
-		return
+		return nil
 	}
 
 	// need to move any routeByAny tasks that are running on this agent to another one.
 	err = sqlstore.RelocateRouteAnyTasks(a)
 	if err != nil {
 		log.Error(3, "Failed to relocated agents Tasks. %s", err)
+		return err
 	}
-
+	return nil
 }
 
-func HandleTaskCreatedEvent(c chan event.RawEvent) {
-	for event := range c {
-		task := new(model.TaskDTO)
-		err := json.Unmarshal(event.Body, task)
-		if err != nil {
-			log.Error(3, "Unable to unmarshal agentOffline event. %s", err)
-			continue
-		}
-
-		go api.ActiveSockets.EmitTask(task, "taskAdd")
+func HandleTaskCreatedEvent(e event.RawEvent) error {
+	task := new(model.TaskDTO)
+	err := json.Unmarshal(e.Body, task)
+	if err != nil {
+		log.Error(3, "Unable to unmarshal taskCreated event. %s", err)
+		return nil
 	}
+	return api.ActiveSockets.EmitTask(task, "taskAdd")
 }
@@ -12,3 +12,9 @@ type AgentSession struct {
 	Server   string
 	Created  time.Time
 }
+
+type GetAgentSessionsQuery struct {
+	AgentId int64  `form:"agentId" url:"agentId,omitempty"`
+	Server  string `form:"server" url:"server,omitempty"`
+	OrgId   int64  `form:"-" url:"-"`
+}
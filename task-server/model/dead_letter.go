@@ -0,0 +1,31 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	DeadLetterEventNotFound = errors.New("Dead-letter Event Not Found.")
+)
+
+// DeadLetterEvent is an event that a handler failed to process after the
+// maximum number of attempts.
+type DeadLetterEvent struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Handler   string    `json:"handler"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	Attempts  int       `json:"attempts"`
+	Payload   string    `json:"payload"`
+	Error     string    `json:"error"`
+	Created   time.Time `json:"created"`
+}
+
+type GetDeadLetterEventsQuery struct {
+	Type    string `form:"type" url:"type,omitempty"`
+	Handler string `form:"handler" url:"handler,omitempty"`
+	Limit   int    `form:"limit" url:"limit,omitempty"`
+	Page    int    `form:"page" url:"page,omitempty"`
+}
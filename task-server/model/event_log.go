@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// EventLog is an event persisted for auditing.
+type EventLog struct {
+	Id        int64  `json:"id"`
+	Type      string `json:"type"`
+	OrgId     int64  `json:"orgId"`
+	AgentId   int64  `json:"agentId"`
+	TaskId    int64  `json:"taskId"`
+	ActorId   int64  `json:"actorId"`
+	ActorName string `json:"actorName"`
+	// ActorOrgOverride is set when an admin acted on behalf of OrgId.
+	ActorOrgOverride bool      `json:"actorOrgOverride"`
+	Source           string    `json:"source"`
+	Timestamp        time.Time `json:"timestamp"`
+	Payload          string    `json:"payload"`
+	Created          time.Time `json:"created"`
+}
+
+// GetEventLogsQuery filters the event log.  Type may end in "*" to match
+// a prefix, eg. "task.*".  From and To are unix timestamps in seconds.
+type GetEventLogsQuery struct {
+	Type    string `form:"type" url:"type,omitempty"`
+	OrgId   int64  `form:"orgId" url:"orgId,omitempty"`
+	AgentId int64  `form:"agentId" url:"agentId,omitempty"`
+	TaskId  int64  `form:"taskId" url:"taskId,omitempty"`
+	From    int64  `form:"from" url:"from,omitempty"`
+	To      int64  `form:"to" url:"to,omitempty"`
+	Limit   int    `form:"limit" url:"limit,omitempty"`
+	Page    int    `form:"page" url:"page,omitempty"`
+}
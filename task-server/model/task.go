@@ -1,13 +1,17 @@
 package model
 
 import (
+	"crypto/sha1"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 )
 
 var (
 	TaskNotFound = errors.New("Task Not Found.")
+	TaskReadOnly = errors.New("Task is provisioned from files and can not be changed through the API.")
 )
 
 type Task struct {
@@ -20,6 +24,10 @@ type Task struct {
 	Enabled  bool
 	Created  time.Time
 	Updated  time.Time
+	// ProvisionedBy is the provisioning source that owns the task, and
+	// ExternalName the task's stable name within that source.
+	ProvisionedBy string
+	ExternalName  string
 }
 
 type TaskMetric struct {
@@ -41,6 +49,65 @@ type TaskDTO struct {
 	Enabled  bool                              `json:"enabled"`
 	Created  time.Time                         `json:"created"`
 	Updated  time.Time                         `json:"updated"`
+	// ConfigHash is set by the server. See UpdateConfigHash().
+	ConfigHash string `json:"configHash"`
+	// ProvisionedBy is set by the server for tasks that are managed by a
+	// provisioning source.  These tasks are read-only in the API.
+	ProvisionedBy string `json:"provisionedBy,omitempty"`
+	ExternalName  string `json:"externalName,omitempty"`
+}
+
+// UpdateConfigHash sets ConfigHash to a hash of the fields that determine
+// how an agent runs the task.  The route is not included, so the hash does
+// not change when a task is moved between agents.  json.Marshal sorts map
+// keys, so the hash is deterministic.
+func (t *TaskDTO) UpdateConfigHash() {
+	body, err := json.Marshal(struct {
+		OrgId    int64                             `json:"orgId"`
+		Interval int64                             `json:"interval"`
+		Metrics  map[string]int64                  `json:"metrics"`
+		Config   map[string]map[string]interface{} `json:"config"`
+	}{
+		OrgId:    t.OrgId,
+		Interval: t.Interval,
+		Metrics:  t.Metrics,
+		Config:   t.Config,
+	})
+	if err != nil {
+		// only possible if the config contains values that can not be
+		// encoded, which the API would not have accepted.
+		t.ConfigHash = ""
+		return
+	}
+	t.ConfigHash = fmt.Sprintf("%x", sha1.Sum(body))
+}
+
+// TaskList is the payload of the taskList event, the complete list of
+// tasks an agent should run.
+type TaskList struct {
+	// Revision identifies the content of the list.  It only changes when
+	// tasks are added to or removed from the list or their config changes,
+	// and every task-server sends the same revision for the same list.
+	Revision string     `json:"revision"`
+	Tasks    []*TaskDTO `json:"tasks"`
+}
+
+// TaskListVersion is the first agent version that is sent a TaskList in
+// the taskList event.  Older agents are sent the bare list of tasks.
+const TaskListVersion = 2
+
+// NewTaskList returns the list of tasks with its revision.
+func NewTaskList(tasks []*TaskDTO) *TaskList {
+	keys := make([]string, len(tasks))
+	for i, t := range tasks {
+		keys[i] = fmt.Sprintf("%d:%s", t.Id, t.ConfigHash)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	for _, k := range keys {
+		fmt.Fprintln(h, k)
+	}
+	return &TaskList{Revision: fmt.Sprintf("%x", h.Sum(nil)), Tasks: tasks}
 }
 
 type RouteType string
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// TaskChange is a field that differs between two versions of a task.  Old
+// and New are the JSON encoded values.
+type TaskChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Diff returns the user settable fields of t that differ in desired.  The
+// Id, OrgId and timestamps are ignored.
+func (t *TaskDTO) Diff(desired *TaskDTO) []TaskChange {
+	changes := make([]TaskChange, 0)
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"name", t.Name, desired.Name},
+		{"interval", t.Interval, desired.Interval},
+		{"enabled", t.Enabled, desired.Enabled},
+		{"metrics", t.Metrics, desired.Metrics},
+		{"config", t.Config, desired.Config},
+		{"route", t.Route, desired.Route},
+	}
+	for _, f := range fields {
+		// compare the encoded values, as decoded JSON and values built in
+		// code use different types for the same data.
+		old, _ := json.Marshal(f.old)
+		new, _ := json.Marshal(f.new)
+		if !bytes.Equal(old, new) {
+			changes = append(changes, TaskChange{Field: f.name, Old: string(old), New: string(new)})
+		}
+	}
+	return changes
+}
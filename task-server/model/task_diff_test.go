@@ -0,0 +1,82 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func diffTestTask() *TaskDTO {
+	return &TaskDTO{
+		Id:       1,
+		Name:     "task1",
+		OrgId:    3,
+		Interval: 60,
+		Enabled:  true,
+		Metrics:  map[string]int64{"/raintank/ping": 0},
+		Config: map[string]map[string]interface{}{
+			"/raintank": {"hostname": "example.com", "timeout": 5},
+		},
+		Route: &TaskRoute{Type: RouteAny, Config: map[string]interface{}{}},
+	}
+}
+
+func TestTaskDiff(t *testing.T) {
+	Convey("When diffing tasks", t, func() {
+		cases := []struct {
+			name   string
+			change func(t *TaskDTO)
+			fields []string
+		}{
+			{"identical tasks have no changes", func(t *TaskDTO) {}, nil},
+			{"ids, orgs and timestamps are ignored", func(t *TaskDTO) {
+				t.Id = 2
+				t.OrgId = 4
+				t.Created = time.Now()
+				t.Updated = time.Now()
+				t.ConfigHash = "hash"
+			}, nil},
+			{"the interval is compared", func(t *TaskDTO) { t.Interval = 30 }, []string{"interval"}},
+			{"enabled is compared", func(t *TaskDTO) { t.Enabled = false }, []string{"enabled"}},
+			{"metrics are compared", func(t *TaskDTO) { t.Metrics["/raintank/dns"] = 0 }, []string{"metrics"}},
+			{"config values are compared", func(t *TaskDTO) { t.Config["/raintank"]["timeout"] = 10 }, []string{"config"}},
+			{"routes are compared", func(t *TaskDTO) {
+				t.Route = &TaskRoute{Type: RouteByIds, Config: map[string]interface{}{"ids": []int64{1}}}
+			}, []string{"route"}},
+			{"each changed field is listed", func(t *TaskDTO) {
+				t.Name = "task2"
+				t.Interval = 30
+			}, []string{"name", "interval"}},
+		}
+		for _, c := range cases {
+			Convey(c.name, func() {
+				desired := diffTestTask()
+				c.change(desired)
+				fields := make([]string, 0)
+				for _, change := range diffTestTask().Diff(desired) {
+					fields = append(fields, change.Field)
+				}
+				if c.fields == nil {
+					c.fields = []string{}
+				}
+				So(fields, ShouldResemble, c.fields)
+			})
+		}
+
+		Convey("decoded JSON matches the same values built in code", func() {
+			body, err := json.Marshal(diffTestTask())
+			So(err, ShouldBeNil)
+			decoded := new(TaskDTO)
+			So(json.Unmarshal(body, decoded), ShouldBeNil)
+			So(diffTestTask().Diff(decoded), ShouldBeEmpty)
+		})
+
+		Convey("changes hold the old and new values as JSON", func() {
+			desired := diffTestTask()
+			desired.Interval = 30
+			So(diffTestTask().Diff(desired), ShouldResemble, []TaskChange{{Field: "interval", Old: "60", New: "30"}})
+		})
+	})
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"time"
+)
+
+var (
+	WebhookNotFound = errors.New("Webhook Not Found.")
+)
+
+// AllowPrivateWebhooks permits webhooks to loopback, link-local and private
+// addresses.  It is off by default, as any editor could otherwise make the
+// task-server send requests to internal services, such as cloud metadata
+// endpoints.
+var AllowPrivateWebhooks = false
+
+// privateNets are the networks webhooks are not sent to, unless
+// AllowPrivateWebhooks is set.
+var privateNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// lookupIP resolves webhook hosts.  It is replaced in tests.
+var lookupIP = net.LookupIP
+
+// CheckWebhookIP returns an error if webhooks may not be sent to ip.
+func CheckWebhookIP(ip net.IP) error {
+	if AllowPrivateWebhooks {
+		return nil
+	}
+	if ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("webhooks can not be sent to %s.", ip)
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("webhooks can not be sent to the private address %s.", ip)
+		}
+	}
+	return nil
+}
+
+// Webhook is an org's subscription to events.  Events are matched against
+// each pattern in Events using path.Match, so "task.*" matches all task
+// events and "*" matches everything.
+type Webhook struct {
+	Id      int64     `json:"id"`
+	OrgId   int64     `json:"orgId"`
+	Url     string    `json:"url" binding:"Required"`
+	Secret  string    `json:"secret,omitempty"`
+	Events  []string  `json:"events" binding:"Required" xorm:"JSON"`
+	Enabled bool      `json:"enabled"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.Url)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook url must be an absolute http or https url.")
+	}
+	if err := checkWebhookHost(u.Hostname()); err != nil {
+		return err
+	}
+	if len(w.Events) == 0 {
+		return errors.New("at least one event type is required.")
+	}
+	for _, pattern := range w.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWebhookHost returns an error if host is, or resolves to, an address
+// that webhooks may not be sent to.  Deliveries check the address again
+// when they connect, as DNS can change after the webhook is saved.
+func checkWebhookHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return CheckWebhookIP(ip)
+	}
+	if AllowPrivateWebhooks {
+		return nil
+	}
+	ips, err := lookupIP(host)
+	if err != nil {
+		return fmt.Errorf("could not resolve webhook host %s. %s", host, err)
+	}
+	for _, ip := range ips {
+		if err := CheckWebhookIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the webhook is subscribed to eventType.
+func (w *Webhook) Matches(eventType string) bool {
+	for _, pattern := range w.Events {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery records a single attempt to deliver an event to a
+// webhook.
+type WebhookDelivery struct {
+	Id         int64     `json:"id"`
+	WebhookId  int64     `json:"webhookId"`
+	OrgId      int64     `json:"orgId"`
+	DeliveryId string    `json:"deliveryId"`
+	EventType  string    `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error"`
+	Duration   int64     `json:"duration"`
+	Created    time.Time `json:"created"`
+}
+
+type GetWebhooksQuery struct {
+	OrgId int64 `form:"-" url:"-"`
+	Limit int   `form:"limit" url:"limit,omitempty"`
+	Page  int   `form:"page" url:"page,omitempty"`
+}
+
+type GetWebhookDeliveriesQuery struct {
+	WebhookId int64 `form:"-" url:"-"`
+	OrgId     int64 `form:"-" url:"-"`
+	Limit     int   `form:"limit" url:"limit,omitempty"`
+	Page      int   `form:"page" url:"page,omitempty"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebhookValidate(t *testing.T) {
+	Convey("When validating webhooks", t, func() {
+		lookup := lookupIP
+		lookupIP = func(host string) ([]net.IP, error) {
+			switch host {
+			case "hooks.example.com":
+				return []net.IP{net.ParseIP("93.184.216.34")}, nil
+			case "internal.example.com":
+				return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.5")}, nil
+			}
+			return nil, errors.New("no such host")
+		}
+		Reset(func() {
+			lookupIP = lookup
+			AllowPrivateWebhooks = false
+		})
+
+		hook := func(url string) *Webhook {
+			return &Webhook{Url: url, Events: []string{"task.*"}}
+		}
+
+		Convey("public addresses are allowed", func() {
+			So(hook("https://hooks.example.com/events").Validate(), ShouldBeNil)
+			So(hook("http://93.184.216.34:8080/").Validate(), ShouldBeNil)
+		})
+
+		Convey("loopback, link-local and private addresses are rejected", func() {
+			for _, url := range []string{
+				"http://127.0.0.1/",
+				"http://169.254.169.254/latest/meta-data/",
+				"http://10.1.2.3/",
+				"http://172.16.0.1/",
+				"http://192.168.1.1/",
+				"http://100.64.0.1/",
+				"http://0.0.0.0/",
+				"http://[::1]/",
+				"http://[fe80::1]/",
+				"http://[fd00::1]/",
+				"http://internal.example.com/",
+			} {
+				So(hook(url).Validate(), ShouldNotBeNil)
+			}
+		})
+
+		Convey("hosts that can not be resolved are rejected", func() {
+			So(hook("http://unknown.example.com/").Validate(), ShouldNotBeNil)
+		})
+
+		Convey("private addresses are allowed when enabled", func() {
+			AllowPrivateWebhooks = true
+			So(hook("http://127.0.0.1/").Validate(), ShouldBeNil)
+			So(hook("http://internal.example.com/").Validate(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package provisioning
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// LoadDir reads the task definitions from the .yaml, .yml and .json files
+// in dir.  Each file holds a single task or a list of tasks.  Every task
+// must have an orgId and an externalName that is unique within its org.
+// The task name defaults to the externalName.
+func LoadDir(dir string) ([]*model.TaskDTO, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]*model.TaskDTO, 0)
+	seen := make(map[string]string)
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		tasks, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			k := key(t.OrgId, t.ExternalName)
+			if other, ok := seen[k]; ok {
+				return nil, fmt.Errorf("%s: task %s for org %d is already defined in %s", path, t.ExternalName, t.OrgId, other)
+			}
+			seen[k] = path
+			defs = append(defs, t)
+		}
+	}
+	return defs, nil
+}
+
+// LoadFile reads and validates the task definitions in a single file.
+func LoadFile(path string) ([]*model.TaskDTO, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so every file goes through the YAML decoder.
+	body, err = yaml.YAMLToJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	tasks := make([]*model.TaskDTO, 0)
+	body = bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(body, []byte("[")):
+		err = json.Unmarshal(body, &tasks)
+	case bytes.HasPrefix(body, []byte("{")):
+		t := new(model.TaskDTO)
+		err = json.Unmarshal(body, t)
+		tasks = append(tasks, t)
+	case len(body) == 0 || bytes.Equal(body, []byte("null")):
+		// an empty file defines no tasks.
+	default:
+		err = fmt.Errorf("expected a task or a list of tasks")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for i, t := range tasks {
+		if err := validate(t); err != nil {
+			return nil, fmt.Errorf("%s: task %d: %s", path, i, err)
+		}
+	}
+	return tasks, nil
+}
+
+// validate checks the fields the API would require and clears the ones
+// that are set by the server.
+func validate(t *model.TaskDTO) error {
+	if t == nil {
+		return fmt.Errorf("task is empty")
+	}
+	if t.ExternalName == "" {
+		return fmt.Errorf("externalName is required")
+	}
+	if t.OrgId == 0 {
+		return fmt.Errorf("orgId is required for %s", t.ExternalName)
+	}
+	if t.Name == "" {
+		t.Name = t.ExternalName
+	}
+	if t.Interval <= 0 {
+		return fmt.Errorf("interval is required for %s", t.ExternalName)
+	}
+	if len(t.Metrics) == 0 {
+		return fmt.Errorf("metrics are required for %s", t.ExternalName)
+	}
+	if t.Route == nil {
+		return fmt.Errorf("route is required for %s", t.ExternalName)
+	}
+	if ok, err := t.Route.Validate(); err != nil {
+		return fmt.Errorf("invalid route config for %s. %s", t.ExternalName, err)
+	} else if !ok {
+		return fmt.Errorf("invalid route config for %s", t.ExternalName)
+	}
+	if t.Config == nil {
+		// stored as {}, so a missing config would always show as a change.
+		t.Config = make(map[string]map[string]interface{})
+	}
+	t.Id = 0
+	t.ProvisionedBy = ""
+	t.ConfigHash = ""
+	return nil
+}
@@ -0,0 +1,114 @@
+package provisioning
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const yamlTasks = `
+- externalName: ping-google
+  orgId: 1
+  interval: 60
+  enabled: true
+  metrics:
+    /raintank/apps/ping/*: 1
+  config:
+    /raintank/apps/ping:
+      hostname: google.com
+  route:
+    type: any
+- externalName: ping-grafana
+  name: ping grafana.com
+  orgId: 2
+  interval: 10
+  metrics:
+    /raintank/apps/ping/*: 1
+  route:
+    type: byIds
+    config:
+      ids: [1, 2]
+`
+
+const jsonTask = `{
+  "externalName": "ping-google",
+  "orgId": 2,
+  "interval": 60,
+  "metrics": {"/raintank/apps/ping/*": 1},
+  "route": {"type": "any"}
+}`
+
+func writeFiles(files map[string]string) string {
+	dir, err := ioutil.TempDir("", "provisioning")
+	if err != nil {
+		panic(err)
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			panic(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	Convey("When loading a directory of task definitions", t, func() {
+		dir := writeFiles(map[string]string{
+			"ping.yaml":   yamlTasks,
+			"google.json": jsonTask,
+			"empty.yml":   "",
+			"README.md":   "not a task",
+		})
+		defer os.RemoveAll(dir)
+
+		tasks, err := LoadDir(dir)
+		So(err, ShouldBeNil)
+		So(tasks, ShouldHaveLength, 3)
+		byKey := make(map[string]*model.TaskDTO)
+		for _, t := range tasks {
+			byKey[key(t.OrgId, t.ExternalName)] = t
+		}
+		So(byKey, ShouldContainKey, "1/ping-google")
+		So(byKey, ShouldContainKey, "2/ping-google")
+		So(byKey["1/ping-google"].Name, ShouldEqual, "ping-google")
+		So(byKey["1/ping-google"].Enabled, ShouldBeTrue)
+		So(byKey["1/ping-google"].Config["/raintank/apps/ping"]["hostname"], ShouldEqual, "google.com")
+		So(byKey["2/ping-grafana"].Name, ShouldEqual, "ping grafana.com")
+		So(byKey["2/ping-grafana"].Route.Type, ShouldEqual, model.RouteByIds)
+	})
+
+	Convey("When an externalName is defined twice in an org", t, func() {
+		dir := writeFiles(map[string]string{
+			"a.yaml":    yamlTasks,
+			"b.yaml":    yamlTasks,
+			"good.json": jsonTask,
+		})
+		defer os.RemoveAll(dir)
+
+		_, err := LoadDir(dir)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "already defined")
+	})
+
+	Convey("When a definition is invalid", t, func() {
+		invalid := []string{
+			`{"orgId": 1, "interval": 60, "metrics": {"a": 1}, "route": {"type": "any"}}`,
+			`{"externalName": "a", "interval": 60, "metrics": {"a": 1}, "route": {"type": "any"}}`,
+			`{"externalName": "a", "orgId": 1, "interval": 60, "route": {"type": "any"}}`,
+			`{"externalName": "a", "orgId": 1, "interval": 60, "metrics": {"a": 1}}`,
+			`{"externalName": "a", "orgId": 1, "interval": 60, "metrics": {"a": 1}, "route": {"type": "byIds"}}`,
+			`"ping"`,
+			"- externalName: [",
+		}
+		for _, body := range invalid {
+			dir := writeFiles(map[string]string{"task.yaml": body})
+			_, err := LoadDir(dir)
+			os.RemoveAll(dir)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package provisioning
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/met"
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+var (
+	// TaskRemoved is called for every task deleted by provisioning, so
+	// agents running the task can be told to stop it.
+	TaskRemoved func(*model.TaskDTO)
+
+	actor = &event.Actor{Name: "provisioning", IsAdmin: true}
+
+	// provisioner is nil when provisioning is disabled.
+	provisioner *Provisioner
+)
+
+// Status is the outcome of the last sync and drift check.
+type Status struct {
+	Source    string       `json:"source"`
+	Tasks     int          `json:"tasks"`
+	LastSync  time.Time    `json:"lastSync"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Deleted   int          `json:"deleted"`
+	Failed    []*TaskError `json:"failed"`
+	LastCheck time.Time    `json:"lastCheck"`
+	Drift     []*Drift     `json:"drift"`
+	// Error is set when the definitions could not be loaded.  The last
+	// good definitions are still used.
+	Error string `json:"error,omitempty"`
+}
+
+// TaskError is a definition that could not be applied.
+type TaskError struct {
+	OrgId        int64  `json:"orgId"`
+	ExternalName string `json:"externalName"`
+	Error        string `json:"error"`
+}
+
+// Drift is a provisioned task whose state in the DB does not match its
+// definition.  Missing is set if the task no longer exists and Extra if
+// it exists but is not defined.
+type Drift struct {
+	OrgId        int64              `json:"orgId"`
+	ExternalName string             `json:"externalName"`
+	TaskId       int64              `json:"taskId,omitempty"`
+	Missing      bool               `json:"missing,omitempty"`
+	Extra        bool               `json:"extra,omitempty"`
+	Changes      []model.TaskChange `json:"changes,omitempty"`
+}
+
+// Provisioner keeps the tasks owned by a provisioning source in line with
+// the definitions in a directory.
+type Provisioner struct {
+	Dir    string
+	Source string
+
+	sync.Mutex
+	definitions []*model.TaskDTO
+	status      Status
+
+	driftGauge met.Gauge
+}
+
+// Init loads and applies the task definitions in dir.  If interval is not
+// 0, the tasks are checked for drift from their definitions at that
+// interval.
+func Init(dir string, interval time.Duration, metrics met.Backend) error {
+	p := NewProvisioner(dir)
+	p.driftGauge = metrics.NewGauge("provisioning.drift", 0)
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	provisioner = p
+	if interval > 0 {
+		go p.checkLoop(interval)
+	}
+	return nil
+}
+
+// NewProvisioner creates a Provisioner for dir.  Tasks are owned by the
+// source "file:<dir>", so moving the directory hands its tasks over to a
+// new source.
+func NewProvisioner(dir string) *Provisioner {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &Provisioner{
+		Dir:    dir,
+		Source: "file:" + dir,
+		status: Status{Source: "file:" + dir},
+	}
+}
+
+// Reload re-reads the definitions and applies them.  Called on SIGHUP.
+// If provisioning is disabled, Reload does nothing.
+func Reload() error {
+	if provisioner == nil {
+		return nil
+	}
+	return provisioner.Reload()
+}
+
+// GetStatus returns the status of provisioning, or nil if it is disabled.
+func GetStatus() *Status {
+	if provisioner == nil {
+		return nil
+	}
+	return provisioner.Status()
+}
+
+// Reload re-reads the definitions from p.Dir and applies them.  If any
+// file can not be loaded nothing is changed, so a bad edit never deletes
+// tasks.
+func (p *Provisioner) Reload() error {
+	p.Lock()
+	defer p.Unlock()
+	defs, err := LoadDir(p.Dir)
+	if err != nil {
+		p.status.Error = err.Error()
+		return err
+	}
+	p.status.Error = ""
+	p.definitions = defs
+	return p.sync()
+}
+
+// Status returns a copy of the current status.
+func (p *Provisioner) Status() *Status {
+	p.Lock()
+	defer p.Unlock()
+	s := p.status
+	return &s
+}
+
+// Check compares the provisioned tasks with their definitions and reports
+// any drift, without changing anything.  Drift is only expected if the DB
+// is changed directly, or another task-server provisions the same source
+// from different files.
+func (p *Provisioner) Check() error {
+	p.Lock()
+	defer p.Unlock()
+	return p.check()
+}
+
+func (p *Provisioner) checkLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		if err := p.Check(); err != nil {
+			log.Error(3, "provisioning: failed to check %s for drift. %s", p.Source, err)
+		}
+	}
+}
+
+func (p *Provisioner) sync() error {
+	existing, err := p.existing()
+	if err != nil {
+		return err
+	}
+	p.status.LastSync = time.Now()
+	p.status.Tasks = len(p.definitions)
+	p.status.Created = 0
+	p.status.Updated = 0
+	p.status.Deleted = 0
+	p.status.Failed = make([]*TaskError, 0)
+
+	for _, def := range p.definitions {
+		// work on a copy, as the stores fill in the Id and timestamps.
+		t := *def
+		t.ProvisionedBy = p.Source
+		k := key(t.OrgId, t.ExternalName)
+		current, ok := existing[k]
+		delete(existing, k)
+		if ok {
+			changes := current.Diff(&t)
+			if len(changes) == 0 {
+				continue
+			}
+			t.Id = current.Id
+			if err := apply(&t, sqlstore.UpdateTask); err != nil {
+				p.failed(&t, err)
+				continue
+			}
+			log.Info("provisioning: updated task %s for org %d. %s", t.ExternalName, t.OrgId, formatChanges(changes))
+			p.status.Updated++
+		} else {
+			if err := apply(&t, sqlstore.AddTask); err != nil {
+				p.failed(&t, err)
+				continue
+			}
+			log.Info("provisioning: created task %s for org %d.", t.ExternalName, t.OrgId)
+			p.status.Created++
+		}
+	}
+
+	for _, t := range existing {
+		deleted, err := sqlstore.DeleteTask(t.Id, t.OrgId, actor)
+		if err != nil {
+			p.failed(t, err)
+			continue
+		}
+		if deleted != nil && TaskRemoved != nil {
+			TaskRemoved(deleted)
+		}
+		log.Info("provisioning: deleted task %s for org %d.", t.ExternalName, t.OrgId)
+		p.status.Deleted++
+	}
+
+	log.Info("provisioning: synced %d tasks from %s. %d created, %d updated, %d deleted, %d failed.",
+		p.status.Tasks, p.Dir, p.status.Created, p.status.Updated, p.status.Deleted, len(p.status.Failed))
+	return p.check()
+}
+
+func (p *Provisioner) check() error {
+	existing, err := p.existing()
+	if err != nil {
+		return err
+	}
+	drift := make([]*Drift, 0)
+	for _, def := range p.definitions {
+		k := key(def.OrgId, def.ExternalName)
+		current, ok := existing[k]
+		delete(existing, k)
+		if !ok {
+			drift = append(drift, &Drift{OrgId: def.OrgId, ExternalName: def.ExternalName, Missing: true})
+			continue
+		}
+		if changes := current.Diff(def); len(changes) > 0 {
+			drift = append(drift, &Drift{OrgId: def.OrgId, ExternalName: def.ExternalName, TaskId: current.Id, Changes: changes})
+		}
+	}
+	for _, t := range existing {
+		drift = append(drift, &Drift{OrgId: t.OrgId, ExternalName: t.ExternalName, TaskId: t.Id, Extra: true})
+	}
+
+	for _, d := range drift {
+		switch {
+		case d.Missing:
+			log.Warn("provisioning: task %s for org %d is missing.", d.ExternalName, d.OrgId)
+		case d.Extra:
+			log.Warn("provisioning: task %s for org %d (id %d) is not defined in %s.", d.ExternalName, d.OrgId, d.TaskId, p.Dir)
+		default:
+			log.Warn("provisioning: task %s for org %d (id %d) has drifted. %s", d.ExternalName, d.OrgId, d.TaskId, formatChanges(d.Changes))
+		}
+	}
+	p.status.LastCheck = time.Now()
+	p.status.Drift = drift
+	if p.driftGauge != nil {
+		p.driftGauge.Value(int64(len(drift)))
+	}
+	return nil
+}
+
+// existing returns the tasks owned by p, keyed by org and external name.
+func (p *Provisioner) existing() (map[string]*model.TaskDTO, error) {
+	tasks, err := sqlstore.GetProvisionedTasks(p.Source)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*model.TaskDTO)
+	for _, t := range tasks {
+		byKey[key(t.OrgId, t.ExternalName)] = t
+	}
+	return byKey, nil
+}
+
+func (p *Provisioner) failed(t *model.TaskDTO, err error) {
+	log.Error(3, "provisioning: failed to apply task %s for org %d. %s", t.ExternalName, t.OrgId, err)
+	p.status.Failed = append(p.status.Failed, &TaskError{
+		OrgId:        t.OrgId,
+		ExternalName: t.ExternalName,
+		Error:        err.Error(),
+	})
+}
+
+// apply validates t the same way the API does before saving it.
+func apply(t *model.TaskDTO, save func(*model.TaskDTO, *event.Actor) error) error {
+	if err := sqlstore.ValidateMetrics(t.OrgId, t.Metrics); err != nil {
+		return err
+	}
+	if err := sqlstore.ValidateTaskRouteConfig(t); err != nil {
+		return err
+	}
+	return save(t, actor)
+}
+
+func key(orgId int64, externalName string) string {
+	return fmt.Sprintf("%d/%s", orgId, externalName)
+}
+
+func formatChanges(changes []model.TaskChange) string {
+	s := ""
+	for i, c := range changes {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s: %s => %s", c.Field, c.Old, c.New)
+	}
+	return s
+}
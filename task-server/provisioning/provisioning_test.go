@@ -0,0 +1,173 @@
+package provisioning
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestDefinition(orgId int64, externalName string, interval int64) *model.TaskDTO {
+	return &model.TaskDTO{
+		Name:         externalName,
+		ExternalName: externalName,
+		OrgId:        orgId,
+		Interval:     interval,
+		Enabled:      true,
+		Metrics:      map[string]int64{"/testing/demo/demo1": 1},
+		Config:       map[string]map[string]interface{}{},
+		Route:        &model.TaskRoute{Type: model.RouteAny, Config: map[string]interface{}{}},
+	}
+}
+
+// provisionedNames returns the sorted external names of the tasks owned by
+// p.
+func provisionedNames(p *Provisioner) []string {
+	tasks, err := sqlstore.GetProvisionedTasks(p.Source)
+	So(err, ShouldBeNil)
+	names := make([]string, len(tasks))
+	for i, t := range tasks {
+		So(t.ProvisionedBy, ShouldEqual, p.Source)
+		names[i] = t.ExternalName
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestProvisioner(t *testing.T) {
+	Convey("Given a provisioner with task definitions", t, func() {
+		sqlstore.NewEngine("sqlite3", ":memory:", false)
+		agent := &model.AgentDTO{Name: "agent1", OrgId: 1, Public: true, Enabled: true}
+		So(sqlstore.AddAgent(agent, nil), ShouldBeNil)
+		So(sqlstore.AddMissingMetricsForAgent(agent, []*model.Metric{
+			{OrgId: 1, Public: true, Namespace: "/testing/demo/demo1", Version: 1},
+		}), ShouldBeNil)
+		So(sqlstore.AddAgentSession(&model.AgentSession{
+			Id:       "session1",
+			AgentId:  agent.Id,
+			Version:  1,
+			RemoteIp: "127.0.0.1",
+			Server:   "localhost",
+			Created:  time.Now(),
+		}), ShouldBeNil)
+
+		removed := make([]string, 0)
+		TaskRemoved = func(t *model.TaskDTO) { removed = append(removed, t.ExternalName) }
+		Reset(func() { TaskRemoved = nil })
+
+		p := NewProvisioner("/etc/tasks")
+		p.definitions = []*model.TaskDTO{
+			newTestDefinition(1, "a", 60),
+			newTestDefinition(1, "b", 60),
+			newTestDefinition(2, "a", 60),
+		}
+		So(p.sync(), ShouldBeNil)
+
+		Convey("sync creates the defined tasks", func() {
+			s := p.Status()
+			So(s.Created, ShouldEqual, 3)
+			So(s.Failed, ShouldBeEmpty)
+			So(s.Drift, ShouldBeEmpty)
+			So(provisionedNames(p), ShouldResemble, []string{"a", "a", "b"})
+		})
+
+		Convey("sync leaves matching tasks alone", func() {
+			So(p.sync(), ShouldBeNil)
+			s := p.Status()
+			So([]int{s.Created, s.Updated, s.Deleted}, ShouldResemble, []int{0, 0, 0})
+		})
+
+		Convey("sync updates changed definitions", func() {
+			p.definitions[1] = newTestDefinition(1, "b", 10)
+			So(p.sync(), ShouldBeNil)
+			So(p.Status().Updated, ShouldEqual, 1)
+			tasks, err := sqlstore.GetProvisionedTasks(p.Source)
+			So(err, ShouldBeNil)
+			for _, t := range tasks {
+				if t.OrgId == 1 && t.ExternalName == "b" {
+					So(t.Interval, ShouldEqual, 10)
+				}
+			}
+		})
+
+		Convey("sync deletes tasks that are no longer defined", func() {
+			p.definitions = p.definitions[1:]
+			So(p.sync(), ShouldBeNil)
+			So(p.Status().Deleted, ShouldEqual, 1)
+			So(removed, ShouldResemble, []string{"a"})
+			So(provisionedNames(p), ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("sync records definitions that can not be applied", func() {
+			bad := newTestDefinition(1, "c", 60)
+			bad.Metrics = map[string]int64{"/testing/unknown": 1}
+			p.definitions = append(p.definitions, bad)
+			So(p.sync(), ShouldBeNil)
+			s := p.Status()
+			So(s.Failed, ShouldHaveLength, 1)
+			So(s.Failed[0].ExternalName, ShouldEqual, "c")
+			So(s.Drift, ShouldHaveLength, 1)
+			So(s.Drift[0].Missing, ShouldBeTrue)
+		})
+
+		Convey("tasks that are not provisioned are left alone", func() {
+			manual := newTestDefinition(1, "manual", 60)
+			manual.ExternalName = ""
+			So(sqlstore.AddTask(manual, nil), ShouldBeNil)
+			p.definitions = nil
+			So(p.sync(), ShouldBeNil)
+			task, err := sqlstore.GetTaskById(manual.Id, 1)
+			So(err, ShouldBeNil)
+			So(task, ShouldNotBeNil)
+			So(task.ExternalName, ShouldEqual, "")
+		})
+
+		Convey("a source can not own two tasks with the same external name", func() {
+			dup := newTestDefinition(1, "a", 60)
+			dup.Name = "a copy"
+			dup.ProvisionedBy = p.Source
+			So(sqlstore.AddTask(dup, nil), ShouldNotBeNil)
+		})
+
+		Convey("check finds no drift after a sync", func() {
+			So(p.Check(), ShouldBeNil)
+			So(p.Status().Drift, ShouldBeEmpty)
+		})
+
+		Convey("check reports drift without changing anything", func() {
+			tasks, err := sqlstore.GetProvisionedTasks(p.Source)
+			So(err, ShouldBeNil)
+			var changed, deleted *model.TaskDTO
+			for _, t := range tasks {
+				switch {
+				case t.OrgId == 1 && t.ExternalName == "a":
+					changed = t
+				case t.OrgId == 2:
+					deleted = t
+				}
+			}
+			changed.Interval = 10
+			So(sqlstore.UpdateTask(changed, nil), ShouldBeNil)
+			_, err = sqlstore.DeleteTask(deleted.Id, deleted.OrgId, nil)
+			So(err, ShouldBeNil)
+			p.definitions = []*model.TaskDTO{p.definitions[0], p.definitions[2]}
+
+			So(p.Check(), ShouldBeNil)
+			drift := make(map[string]*Drift)
+			for _, d := range p.Status().Drift {
+				drift[key(d.OrgId, d.ExternalName)] = d
+			}
+			So(drift, ShouldHaveLength, 3)
+			So(drift["1/a"].Changes, ShouldResemble, []model.TaskChange{{Field: "interval", Old: "10", New: "60"}})
+			So(drift["1/b"].Extra, ShouldBeTrue)
+			So(drift["2/a"].Missing, ShouldBeTrue)
+
+			tasks, err = sqlstore.GetProvisionedTasks(p.Source)
+			So(err, ShouldBeNil)
+			So(tasks, ShouldHaveLength, 2)
+		})
+	})
+}
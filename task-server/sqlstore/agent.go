@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/raintank/raintank-apps/task-server/event"
 	"github.com/raintank/raintank-apps/task-server/model"
 )
 
@@ -188,7 +189,7 @@ func getAgentById(sess *session, id int64, orgId int64) (*model.AgentDTO, error)
 	return a.ToAgentDTO()[0], nil
 }
 
-func AddAgent(a *model.AgentDTO) error {
+func AddAgent(a *model.AgentDTO, actor *event.Actor) error {
 	sess, err := newSession(true, "agent")
 	if err != nil {
 		return err
@@ -198,6 +199,7 @@ func AddAgent(a *model.AgentDTO) error {
 		return err
 	}
 	sess.Complete()
+	event.PublishAs(&event.AgentCreated{Ts: time.Now(), Payload: a}, actor)
 	return nil
 
 }
@@ -243,18 +245,27 @@ func addAgent(sess *session, a *model.AgentDTO) error {
 	return nil
 }
 
-func UpdateAgent(a *model.AgentDTO) error {
+func UpdateAgent(a *model.AgentDTO, actor *event.Actor) error {
 	sess, err := newSession(true, "agent")
 	if err != nil {
 		return err
 	}
 	defer sess.Cleanup()
 
+	existing, err := getAgentById(sess, a.Id, a.OrgId)
+	if err != nil {
+		return err
+	}
 	err = updateAgent(sess, a)
 	if err != nil {
 		return err
 	}
 	sess.Complete()
+	e := new(event.AgentUpdated)
+	e.Ts = time.Now()
+	e.Payload.Old = existing
+	e.Payload.New = a
+	event.PublishAs(e, actor)
 	return err
 }
 
@@ -403,17 +414,22 @@ func getAgentsForTask(sess *session, t *model.TaskDTO) ([]int64, error) {
 	return agentIds, nil
 }
 
-func DeleteAgent(id int64, orgId int64) error {
+func DeleteAgent(id int64, orgId int64, actor *event.Actor) error {
 	sess, err := newSession(true, "agent")
 	if err != nil {
 		return err
 	}
 	defer sess.Cleanup()
+	existing, err := getAgentById(sess, id, orgId)
+	if err != nil {
+		return err
+	}
 	err = deleteAgent(sess, id, orgId)
 	if err != nil {
 		return err
 	}
 	sess.Complete()
+	event.PublishAs(&event.AgentDeleted{Ts: time.Now(), Payload: existing}, actor)
 	return nil
 }
 
@@ -15,24 +15,39 @@ func AddAgentSession(a *model.AgentSession) error {
 	}
 	defer sess.Cleanup()
 
-	if err := addAgentSession(sess, a); err != nil {
+	events, err := addAgentSession(sess, a)
+	if err != nil {
 		return err
 	}
 	sess.Complete()
-	return err
+	for _, e := range events {
+		event.Publish(e, 0)
+	}
+	return nil
 }
 
-func addAgentSession(sess *session, a *model.AgentSession) error {
+func addAgentSession(sess *session, a *model.AgentSession) ([]event.Event, error) {
+	events := make([]event.Event, 0)
+	agent, err := getAgentById(sess, a.AgentId, 0)
+	if err != nil {
+		return nil, err
+	}
 	if _, err := sess.Insert(a); err != nil {
-		return err
+		return nil, err
 	}
 	// set Agent state to online.
 	rawSql := "UPDATE agent set online=1, online_change=? where id=?"
-	_, err := sess.Exec(rawSql, time.Now(), a.AgentId)
+	now := time.Now()
+	_, err = sess.Exec(rawSql, now, a.AgentId)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if !agent.Online {
+		agent.Online = true
+		agent.OnlineChange = now
+		events = append(events, &event.AgentOnline{Ts: now, Payload: agent})
+	}
+	return events, nil
 }
 
 func DeleteAgentSession(a *model.AgentSession) error {
@@ -168,3 +183,58 @@ func getAgentSessionsByAgentId(sess *session, agentId int64) ([]model.AgentSessi
 	}
 	return agentSessions, nil
 }
+
+// GetAgentsConnectedElsewhere returns which of agentIds have a session on a
+// server other than server.
+func GetAgentsConnectedElsewhere(agentIds []int64, server string) ([]int64, error) {
+	sess, err := newSession(false, "agent_session")
+	if err != nil {
+		return nil, err
+	}
+	return getAgentsConnectedElsewhere(sess, agentIds, server)
+}
+
+func getAgentsConnectedElsewhere(sess *session, agentIds []int64, server string) ([]int64, error) {
+	if len(agentIds) == 0 {
+		return nil, nil
+	}
+	agentSessions := make([]model.AgentSession, 0)
+	err := sess.In("agent_id", agentIds).And("server != ?", server).Find(&agentSessions)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	ids := make([]int64, 0, len(agentSessions))
+	for _, a := range agentSessions {
+		if !seen[a.AgentId] {
+			seen[a.AgentId] = true
+			ids = append(ids, a.AgentId)
+		}
+	}
+	return ids, nil
+}
+
+// GetAgentSessions returns the sessions of the agents owned by query.OrgId.
+func GetAgentSessions(query *model.GetAgentSessionsQuery) ([]model.AgentSession, error) {
+	sess, err := newSession(false, "agent_session")
+	if err != nil {
+		return nil, err
+	}
+	return getAgentSessions(sess, query)
+}
+
+func getAgentSessions(sess *session, query *model.GetAgentSessionsQuery) ([]model.AgentSession, error) {
+	agentSessions := make([]model.AgentSession, 0)
+	sess.Where("agent_session.agent_id IN (SELECT id FROM agent WHERE org_id=?)", query.OrgId)
+	if query.AgentId != 0 {
+		sess.And("agent_session.agent_id=?", query.AgentId)
+	}
+	if query.Server != "" {
+		sess.And("agent_session.server=?", query.Server)
+	}
+	err := sess.Asc("agent_session.created").Find(&agentSessions)
+	if err != nil {
+		return nil, err
+	}
+	return agentSessions, nil
+}
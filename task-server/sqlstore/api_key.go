@@ -0,0 +1,17 @@
+package sqlstore
+
+import (
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/auth/keystore"
+)
+
+// ApiKeyStore is an auth.KeyStore backed by the api_key table.
+type ApiKeyStore struct{}
+
+func (ApiKeyStore) GetApiKey(keyHash string) (*auth.ApiKey, error) {
+	sess, err := newSession(false, "api_key")
+	if err != nil {
+		return nil, err
+	}
+	return keystore.GetApiKey(sess.Session, keyHash)
+}
@@ -0,0 +1,94 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+// AddDeadLetterEvent stores an event that could not be processed, so that
+// it can be listed and replayed.  It is used as the event.DeadLetter hook
+// for events received from the bus's dead-letter queue.
+func AddDeadLetterEvent(e event.RawEvent) error {
+	sess, err := newSession(true, "dead_letter_event")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	d := &model.DeadLetterEvent{
+		Type:      e.Type,
+		Handler:   e.Handler,
+		Source:    e.Source,
+		Timestamp: e.Timestamp,
+		Attempts:  e.Attempts,
+		Payload:   string(e.Body),
+		Error:     e.Error,
+		Created:   time.Now(),
+	}
+	if _, err := sess.Insert(d); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func GetDeadLetterEvents(query *model.GetDeadLetterEventsQuery) ([]*model.DeadLetterEvent, error) {
+	sess, err := newSession(false, "dead_letter_event")
+	if err != nil {
+		return nil, err
+	}
+	return getDeadLetterEvents(sess, query)
+}
+
+func getDeadLetterEvents(sess *session, query *model.GetDeadLetterEventsQuery) ([]*model.DeadLetterEvent, error) {
+	events := make([]*model.DeadLetterEvent, 0)
+	if query.Type != "" {
+		sess.Where("dead_letter_event.type=?", query.Type)
+	}
+	if query.Handler != "" {
+		sess.And("dead_letter_event.handler=?", query.Handler)
+	}
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	sess.Desc("dead_letter_event.id").Limit(query.Limit, (query.Page-1)*query.Limit)
+	err := sess.Find(&events)
+	return events, err
+}
+
+func GetDeadLetterEventById(id int64) (*model.DeadLetterEvent, error) {
+	sess, err := newSession(false, "dead_letter_event")
+	if err != nil {
+		return nil, err
+	}
+	return getDeadLetterEventById(sess, id)
+}
+
+func getDeadLetterEventById(sess *session, id int64) (*model.DeadLetterEvent, error) {
+	e := new(model.DeadLetterEvent)
+	has, err := sess.Id(id).Get(e)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, model.DeadLetterEventNotFound
+	}
+	return e, nil
+}
+
+func DeleteDeadLetterEvent(id int64) error {
+	sess, err := newSession(true, "dead_letter_event")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	if _, err := sess.Exec("DELETE FROM dead_letter_event WHERE id = ?", id); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
@@ -0,0 +1,50 @@
+package sqlstore
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/raintank/raintank-apps/task-server/event"
+)
+
+// EventIds returns the org, agent and task that an event relates to.
+// Task payloads include the orgId, but AgentDTO does not so agents are
+// looked up, falling back to the org of the actor for agents that have
+// since been deleted.
+func EventIds(e event.RawEvent) (orgId, agentId, taskId int64) {
+	type ids struct {
+		Id    int64 `json:"id"`
+		OrgId int64 `json:"orgId"`
+	}
+	payload := struct {
+		ids
+		New     *ids  `json:"new"`
+		Task    *ids  `json:"task"`
+		AgentId int64 `json:"agentId"`
+	}{}
+	if err := json.Unmarshal(e.Body, &payload); err != nil {
+		return 0, 0, 0
+	}
+	p := &payload.ids
+	if payload.New != nil {
+		p = payload.New
+	}
+	if payload.Task != nil {
+		p = payload.Task
+	}
+
+	switch {
+	case strings.HasPrefix(e.Type, "agent."):
+		agentId = p.Id
+		if agent, err := GetAgentById(agentId, 0); err == nil {
+			orgId = agent.OrgId
+		} else if e.Actor != nil {
+			orgId = e.Actor.OrgId
+		}
+	case strings.HasPrefix(e.Type, "task."):
+		taskId = p.Id
+		orgId = p.OrgId
+		agentId = payload.AgentId
+	}
+	return orgId, agentId, taskId
+}
@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"strings"
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+func AddEventLog(e event.RawEvent) error {
+	sess, err := newSession(true, "event_log")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	l := &model.EventLog{
+		Type:      e.Type,
+		Source:    e.Source,
+		Timestamp: e.Timestamp,
+		Payload:   string(e.Body),
+		Created:   time.Now(),
+	}
+	l.OrgId, l.AgentId, l.TaskId = EventIds(e)
+	if e.Actor != nil {
+		l.ActorId = e.Actor.Id
+		l.ActorName = e.Actor.Name
+		l.ActorOrgOverride = e.Actor.OrgOverride
+	}
+	if _, err := sess.Insert(l); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func GetEventLogs(query *model.GetEventLogsQuery) ([]*model.EventLog, error) {
+	sess, err := newSession(false, "event_log")
+	if err != nil {
+		return nil, err
+	}
+	return getEventLogs(sess, query)
+}
+
+func getEventLogs(sess *session, query *model.GetEventLogsQuery) ([]*model.EventLog, error) {
+	events := make([]*model.EventLog, 0)
+	if query.OrgId != 0 {
+		sess.Where("event_log.org_id=?", query.OrgId)
+	}
+	if query.Type != "" {
+		if strings.HasSuffix(query.Type, "*") {
+			sess.And("event_log.type like ?", strings.TrimSuffix(query.Type, "*")+"%")
+		} else {
+			sess.And("event_log.type=?", query.Type)
+		}
+	}
+	if query.AgentId != 0 {
+		sess.And("event_log.agent_id=?", query.AgentId)
+	}
+	if query.TaskId != 0 {
+		sess.And("event_log.task_id=?", query.TaskId)
+	}
+	if query.From != 0 {
+		sess.And("event_log.timestamp >= ?", time.Unix(query.From, 0))
+	}
+	if query.To != 0 {
+		sess.And("event_log.timestamp <= ?", time.Unix(query.To, 0))
+	}
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	sess.Desc("event_log.timestamp").Limit(query.Limit, (query.Page-1)*query.Limit)
+	err := sess.Find(&events)
+	return events, err
+}
+
+// DeleteEventLogsBefore removes events older than ts.
+func DeleteEventLogsBefore(ts time.Time) (int64, error) {
+	sess, err := newSession(true, "event_log")
+	if err != nil {
+		return 0, err
+	}
+	defer sess.Cleanup()
+	res, err := sess.Exec("DELETE FROM event_log WHERE timestamp < ?", ts)
+	if err != nil {
+		return 0, err
+	}
+	sess.Complete()
+	return res.RowsAffected()
+}
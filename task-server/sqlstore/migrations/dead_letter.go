@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func addDeadLetterEventMigrations(mg *migrator.Migrator) {
+	deadLetterEventV1 := migrator.Table{
+		Name: "dead_letter_event",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "type", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "handler", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "source", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "timestamp", Type: migrator.DB_DateTime},
+			{Name: "attempts", Type: migrator.DB_Int},
+			{Name: "payload", Type: migrator.DB_Text},
+			{Name: "error", Type: migrator.DB_Text},
+			{Name: "created", Type: migrator.DB_DateTime},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"type"}},
+			{Cols: []string{"handler"}},
+		},
+	}
+	mg.AddMigration("create dead_letter_event table v1", migrator.NewAddTableMigration(deadLetterEventV1))
+	for _, index := range deadLetterEventV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(deadLetterEventV1.Name), "v1")
+		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(deadLetterEventV1, index))
+	}
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func addEventLogMigrations(mg *migrator.Migrator) {
+	eventLogV1 := migrator.Table{
+		Name: "event_log",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "type", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "org_id", Type: migrator.DB_BigInt},
+			{Name: "agent_id", Type: migrator.DB_BigInt},
+			{Name: "task_id", Type: migrator.DB_BigInt},
+			{Name: "actor_id", Type: migrator.DB_BigInt},
+			{Name: "actor_name", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "source", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "timestamp", Type: migrator.DB_DateTime},
+			{Name: "payload", Type: migrator.DB_Text},
+			{Name: "created", Type: migrator.DB_DateTime},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "timestamp"}},
+			{Cols: []string{"agent_id"}},
+			{Cols: []string{"task_id"}},
+			{Cols: []string{"timestamp"}},
+		},
+	}
+	mg.AddMigration("create event_log table v1", migrator.NewAddTableMigration(eventLogV1))
+	for _, index := range eventLogV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(eventLogV1.Name), "v1")
+		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(eventLogV1, index))
+	}
+
+	mg.AddMigration("add actor_org_override column to event_log v1", migrator.NewAddColumnMigration(eventLogV1, &migrator.Column{
+		Name: "actor_org_override", Type: migrator.DB_Bool, Nullable: false, Default: "0",
+	}))
+}
@@ -1,6 +1,9 @@
 package migrations
 
-import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/raintank/raintank-apps/pkg/auth/keystore"
+)
 
 // --- Migration Guide line ---
 // 1. Never change a migration that is committed and pushed to master
@@ -21,4 +24,9 @@ func AddMigrations(mg *Migrator) {
 	addRouteByIdIndexMigrations(mg)
 	addRouteByTagIndexMigrations(mg)
 	addRouteByAnyIndexMigrations(mg)
+
+	addDeadLetterEventMigrations(mg)
+	addWebhookMigrations(mg)
+	addEventLogMigrations(mg)
+	keystore.AddMigrations(mg)
 }
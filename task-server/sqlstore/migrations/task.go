@@ -29,4 +29,20 @@ func addTaskMigrations(mg *migrator.Migrator) {
 		migrationId := fmt.Sprintf("create index %s - %s", index.XName(taskV1.Name), "v1")
 		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(taskV1, index))
 	}
+
+	mg.AddMigration("add provisioned_by column to task v1", migrator.NewAddColumnMigration(taskV1, &migrator.Column{
+		Name: "provisioned_by", Type: migrator.DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add external_name column to task v1", migrator.NewAddColumnMigration(taskV1, &migrator.Column{
+		Name: "external_name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+	provisionedIdx := &migrator.Index{Cols: []string{"provisioned_by"}}
+	mg.AddMigration(fmt.Sprintf("create index %s - %s", provisionedIdx.XName(taskV1.Name), "v1"), migrator.NewAddIndexMigration(taskV1, provisionedIdx))
+
+	// tasks that are not provisioned use their name, which is unique in the
+	// org, as their external_name so they do not collide in the index below.
+	mg.AddMigration("set external_name of unprovisioned tasks v1", migrator.NewRawSqlMigration(
+		"UPDATE task SET external_name = name WHERE provisioned_by = ''"))
+	externalNameIdx := &migrator.Index{Cols: []string{"provisioned_by", "org_id", "external_name"}, Type: migrator.UniqueIndex}
+	mg.AddMigration(fmt.Sprintf("create index %s - %s", externalNameIdx.XName(taskV1.Name), "v1"), migrator.NewAddIndexMigration(taskV1, externalNameIdx))
 }
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func addWebhookMigrations(mg *migrator.Migrator) {
+	webhookV1 := migrator.Table{
+		Name: "webhook",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "url", Type: migrator.DB_NVarchar, Length: 1024, Nullable: false},
+			{Name: "secret", Type: migrator.DB_NVarchar, Length: 255},
+			{Name: "events", Type: migrator.DB_Text, Nullable: false},
+			{Name: "enabled", Type: migrator.DB_Bool},
+			{Name: "created", Type: migrator.DB_DateTime},
+			{Name: "updated", Type: migrator.DB_DateTime},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id"}},
+		},
+	}
+	mg.AddMigration("create webhook table v1", migrator.NewAddTableMigration(webhookV1))
+	for _, index := range webhookV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(webhookV1.Name), "v1")
+		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(webhookV1, index))
+	}
+
+	webhookDeliveryV1 := migrator.Table{
+		Name: "webhook_delivery",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "webhook_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "delivery_id", Type: migrator.DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "event_type", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "attempt", Type: migrator.DB_Int},
+			{Name: "status_code", Type: migrator.DB_Int},
+			{Name: "success", Type: migrator.DB_Bool},
+			{Name: "error", Type: migrator.DB_Text},
+			{Name: "duration", Type: migrator.DB_BigInt},
+			{Name: "created", Type: migrator.DB_DateTime},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"webhook_id"}},
+			{Cols: []string{"created"}},
+		},
+	}
+	mg.AddMigration("create webhook_delivery table v1", migrator.NewAddTableMigration(webhookDeliveryV1))
+	for _, index := range webhookDeliveryV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(webhookDeliveryV1.Name), "v1")
+		mg.AddMigration(migrationId, migrator.NewAddIndexMigration(webhookDeliveryV1, index))
+	}
+}
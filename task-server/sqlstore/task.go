@@ -1,6 +1,7 @@
 package sqlstore
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -24,8 +25,11 @@ func (taskWithMetrics) TableName() string {
 	return "task"
 }
 
+// ToTaskDTO merges the rows of each task, keeping the order in which the
+// tasks first appear.
 func (rows taskWithMetrics) ToTaskDTO() []*model.TaskDTO {
 	taskById := make(map[int64]*model.TaskDTO)
+	tasks := make([]*model.TaskDTO, 0)
 	for _, r := range rows {
 		t, ok := taskById[r.Id]
 		if !ok {
@@ -40,16 +44,19 @@ func (rows taskWithMetrics) ToTaskDTO() []*model.TaskDTO {
 				Created:  r.Created,
 				Updated:  r.Updated,
 				Metrics:  map[string]int64{r.Namespace: r.Version},
+
+				ProvisionedBy: r.ProvisionedBy,
+			}
+			if r.ProvisionedBy != "" {
+				taskById[r.Id].ExternalName = r.ExternalName
 			}
+			tasks = append(tasks, taskById[r.Id])
 		} else {
 			t.Metrics[r.Namespace] = r.Version
 		}
 	}
-	tasks := make([]*model.TaskDTO, len(taskById))
-	i := 0
-	for _, t := range taskById {
-		tasks[i] = t
-		i++
+	for _, t := range tasks {
+		t.UpdateConfigHash()
 	}
 	return tasks
 }
@@ -62,52 +69,72 @@ func GetTasks(query *model.GetTasksQuery) ([]*model.TaskDTO, error) {
 	return getTasks(sess, query)
 }
 
+// taskOrderCols are the task columns results can be ordered by.
+var taskOrderCols = map[string]bool{
+	"id":       true,
+	"name":     true,
+	"org_id":   true,
+	"enabled":  true,
+	"interval": true,
+	"created":  true,
+	"updated":  true,
+}
+
+// getTasks pages by task, not by row.  A page of task ids is selected in a
+// subquery and then joined with task_metric, so tasks with several metrics
+// count once towards the limit.
 func getTasks(sess *session, query *model.GetTasksQuery) ([]*model.TaskDTO, error) {
 	var t taskWithMetrics
+	var pageSQL bytes.Buffer
+	args := make([]interface{}, 0)
+	prefix := "WHERE"
+
+	fmt.Fprint(&pageSQL, "SELECT task.id FROM task ")
+	if query.Metric != "" {
+		fmt.Fprint(&pageSQL, "INNER JOIN task_metric AS tm ON task.id = tm.task_id WHERE tm.namespace=? ")
+		args = append(args, query.Metric)
+		prefix = "AND"
+	}
 	if query.OrgId != 0 {
-		sess.Where("task.org_id = ?", query.OrgId)
+		fmt.Fprintf(&pageSQL, "%s task.org_id=? ", prefix)
+		args = append(args, query.OrgId)
+		prefix = "AND"
 	}
 	if query.Enabled != "" {
 		enabled, err := strconv.ParseBool(query.Enabled)
 		if err != nil {
 			return nil, err
 		}
-		sess.Where("task.enabled=?", enabled)
+		fmt.Fprintf(&pageSQL, "%s task.enabled=? ", prefix)
+		args = append(args, enabled)
+		prefix = "AND"
 	}
-
 	if query.Name != "" {
-		sess.And("task.name like ?", query.Name)
+		fmt.Fprintf(&pageSQL, "%s task.name like ? ", prefix)
+		args = append(args, query.Name)
+		prefix = "AND"
 	}
 
-	if query.Metric != "" {
-		sess.Join("INNER", []string{"task_metric", "tm"}, "task.id = tm.task_id").
-			Where("tm.namespace=?", query.Metric)
-	}
 	if query.OrderBy == "" {
 		query.OrderBy = "name"
 	}
+	if !taskOrderCols[query.OrderBy] {
+		return nil, fmt.Errorf("invalid orderBy %q", query.OrderBy)
+	}
 	if query.Limit == 0 {
 		query.Limit = 50
 	}
 	if query.Page == 0 {
 		query.Page = 1
 	}
-	sess.Asc(query.OrderBy).Limit(query.Limit, (query.Page-1)*query.Limit)
+	orderBy := fmt.Sprintf("ORDER BY task.`%s` ASC, task.id ASC", query.OrderBy)
+	fmt.Fprintf(&pageSQL, "%s LIMIT %d, %d", orderBy, (query.Page-1)*query.Limit, query.Limit)
 
-	sess.Cols(
-		"task.id",
-		"task.name",
-		"task.org_id",
-		"task.enabled",
-		"task.interval",
-		"task.config",
-		"task.route",
-		"task.created",
-		"task.updated",
-		"task_metric.namespace",
-		"task_metric.version",
-	)
-	err := sess.Join("LEFT", "task_metric", "task.id = task_metric.task_id").Find(&t)
+	rawSQL := fmt.Sprintf("SELECT `task`.*, task_metric.namespace, task_metric.version FROM task "+
+		"INNER JOIN (%s) AS page ON page.id = task.id "+
+		"LEFT JOIN task_metric ON task.id = task_metric.task_id %s", pageSQL.String(), orderBy)
+
+	err := sess.Sql(rawSQL, args...).Find(&t)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +168,28 @@ func getTaskById(sess *session, id int64, orgId int64) (*model.TaskDTO, error) {
 	return t.ToTaskDTO()[0], nil
 }
 
-func AddTask(t *model.TaskDTO) error {
+// GetProvisionedTasks returns all tasks, across all orgs, that are owned by
+// the provisioning source.
+func GetProvisionedTasks(source string) ([]*model.TaskDTO, error) {
+	sess, err := newSession(false, "task")
+	if err != nil {
+		return nil, err
+	}
+	var t taskWithMetrics
+	sess.Where("task.provisioned_by=?", source).Join("LEFT", "task_metric", "task.id = task_metric.task_id")
+	sess.Cols(
+		"`task`.*",
+		"task_metric.namespace",
+		"task_metric.version",
+	)
+	err = sess.Find(&t)
+	if err != nil {
+		return nil, err
+	}
+	return t.ToTaskDTO(), nil
+}
+
+func AddTask(t *model.TaskDTO, actor *event.Actor) error {
 	sess, err := newSession(true, "task")
 	if err != nil {
 		return err
@@ -151,7 +199,7 @@ func AddTask(t *model.TaskDTO) error {
 		return err
 	}
 	sess.Complete()
-	event.Publish(&event.TaskCreated{Ts: time.Now(), Payload: t}, 0)
+	event.PublishAs(&event.TaskCreated{Ts: time.Now(), Payload: t}, actor)
 	return nil
 }
 
@@ -165,6 +213,9 @@ func addTask(sess *session, t *model.TaskDTO) error {
 		Route:    t.Route,
 		Created:  time.Now(),
 		Updated:  time.Now(),
+
+		ProvisionedBy: t.ProvisionedBy,
+		ExternalName:  externalName(t.ProvisionedBy, t.ExternalName, t.Name),
 	}
 	sess.UseBool("enabled")
 	if _, err := sess.Insert(&task); err != nil {
@@ -173,6 +224,7 @@ func addTask(sess *session, t *model.TaskDTO) error {
 	t.Created = task.Created
 	t.Updated = task.Updated
 	t.Id = task.Id
+	t.UpdateConfigHash()
 
 	// handle metrics.
 	metrics := make([]*model.TaskMetric, 0, len(t.Metrics))
@@ -196,6 +248,16 @@ func addTask(sess *session, t *model.TaskDTO) error {
 
 }
 
+// externalName returns the external_name stored for a task.  Tasks that are
+// not provisioned store their name, so that they are unique in the
+// provisioned_by, org_id, external_name index.  It is not returned for them.
+func externalName(provisionedBy, external, name string) string {
+	if provisionedBy == "" {
+		return name
+	}
+	return external
+}
+
 func taskRouteAnyCandidates(sess *session, tid int64) ([]int64, error) {
 	// get Candidate Agents.
 	candidates := make([]struct{ AgentId int64 }, 0)
@@ -216,7 +278,7 @@ func taskRouteAnyCandidates(sess *session, tid int64) ([]int64, error) {
 	return resp, nil
 }
 
-func UpdateTask(t *model.TaskDTO) error {
+func UpdateTask(t *model.TaskDTO, actor *event.Actor) error {
 	sess, err := newSession(true, "task")
 	if err != nil {
 		return err
@@ -228,7 +290,7 @@ func UpdateTask(t *model.TaskDTO) error {
 	}
 	sess.Complete()
 	for _, e := range events {
-		event.Publish(e, 0)
+		event.PublishAs(e, actor)
 	}
 	return nil
 }
@@ -252,6 +314,8 @@ func updateTask(sess *session, t *model.TaskDTO) ([]event.Event, error) {
 		Route:    t.Route,
 		Created:  existing.Created,
 		Updated:  time.Now(),
+
+		ExternalName: externalName(existing.ProvisionedBy, t.ExternalName, t.Name),
 	}
 	sess.UseBool("enabled")
 	_, err = sess.Id(task.Id).Update(&task)
@@ -259,6 +323,7 @@ func updateTask(sess *session, t *model.TaskDTO) ([]event.Event, error) {
 		return nil, err
 	}
 	t.Updated = task.Updated
+	t.UpdateConfigHash()
 
 	// Update taskMetrics
 	metricsToAdd := make([]*model.TaskMetric, 0)
@@ -568,6 +633,12 @@ func relocateRouteAnyTasks(sess *session, agent *model.AgentDTO) ([]event.Event,
 		}
 		if len(candidates) == 0 {
 			log.Error(3, "Cant re-locate task %d, no online agents capable of providing requested metrics.", t.Id)
+			e := new(event.TaskPlacementFailed)
+			e.Ts = time.Now()
+			e.Payload.Task = t
+			e.Payload.AgentId = agent.Id
+			e.Payload.Reason = "no online agents capable of providing requested metrics"
+			events = append(events, e)
 			continue
 		}
 		newAgent := candidates[rand.Intn(len(candidates))]
@@ -647,7 +718,7 @@ func getAgentTasks(sess *session, agent *model.AgentDTO) ([]*model.TaskDTO, erro
 	return tasks.ToTaskDTO(), err
 }
 
-func DeleteTask(id int64, orgId int64) (*model.TaskDTO, error) {
+func DeleteTask(id int64, orgId int64, actor *event.Actor) (*model.TaskDTO, error) {
 	sess, err := newSession(true, "task")
 	if err != nil {
 		return nil, err
@@ -659,7 +730,9 @@ func DeleteTask(id int64, orgId int64) (*model.TaskDTO, error) {
 	}
 	sess.Complete()
 
-	event.Publish(&event.TaskDeleted{Ts: time.Now(), Payload: existing}, 0)
+	if existing != nil {
+		event.PublishAs(&event.TaskDeleted{Ts: time.Now(), Payload: existing}, actor)
+	}
 
 	return existing, nil
 }
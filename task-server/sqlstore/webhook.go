@@ -0,0 +1,163 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+)
+
+func GetWebhooks(query *model.GetWebhooksQuery) ([]*model.Webhook, error) {
+	sess, err := newSession(false, "webhook")
+	if err != nil {
+		return nil, err
+	}
+	return getWebhooks(sess, query)
+}
+
+func getWebhooks(sess *session, query *model.GetWebhooksQuery) ([]*model.Webhook, error) {
+	hooks := make([]*model.Webhook, 0)
+	sess.Where("webhook.org_id=?", query.OrgId)
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	sess.Asc("webhook.id").Limit(query.Limit, (query.Page-1)*query.Limit)
+	err := sess.Find(&hooks)
+	return hooks, err
+}
+
+// GetWebhooksForEvent returns the enabled webhooks of the org that are
+// subscribed to eventType.
+func GetWebhooksForEvent(orgId int64, eventType string) ([]*model.Webhook, error) {
+	sess, err := newSession(false, "webhook")
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]*model.Webhook, 0)
+	err = sess.Where("webhook.org_id=? AND webhook.enabled=?", orgId, true).Find(&hooks)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*model.Webhook, 0, len(hooks))
+	for _, h := range hooks {
+		if h.Matches(eventType) {
+			matched = append(matched, h)
+		}
+	}
+	return matched, nil
+}
+
+func GetWebhookById(id int64, orgId int64) (*model.Webhook, error) {
+	sess, err := newSession(false, "webhook")
+	if err != nil {
+		return nil, err
+	}
+	return getWebhookById(sess, id, orgId)
+}
+
+func getWebhookById(sess *session, id int64, orgId int64) (*model.Webhook, error) {
+	h := new(model.Webhook)
+	has, err := sess.Where("webhook.id=? AND webhook.org_id=?", id, orgId).Get(h)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, model.WebhookNotFound
+	}
+	return h, nil
+}
+
+func AddWebhook(h *model.Webhook) error {
+	sess, err := newSession(true, "webhook")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	h.Created = time.Now()
+	h.Updated = time.Now()
+	if _, err := sess.Insert(h); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func UpdateWebhook(h *model.Webhook) error {
+	sess, err := newSession(true, "webhook")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	existing, err := getWebhookById(sess, h.Id, h.OrgId)
+	if err != nil {
+		return err
+	}
+	if h.Secret == "" {
+		// the secret is never returned by the API, so keep the current
+		// one unless a new one is given.
+		h.Secret = existing.Secret
+	}
+	h.Created = existing.Created
+	h.Updated = time.Now()
+	sess.UseBool("enabled")
+	if _, err := sess.Id(h.Id).Update(h); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func DeleteWebhook(id int64, orgId int64) error {
+	sess, err := newSession(true, "webhook")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	if _, err := getWebhookById(sess, id, orgId); err != nil {
+		return err
+	}
+	deletes := []string{
+		"DELETE FROM webhook WHERE id = ?",
+		"DELETE FROM webhook_delivery WHERE webhook_id = ?",
+	}
+	for _, sql := range deletes {
+		if _, err := sess.Exec(sql, id); err != nil {
+			return err
+		}
+	}
+	sess.Complete()
+	return nil
+}
+
+func AddWebhookDelivery(d *model.WebhookDelivery) error {
+	sess, err := newSession(true, "webhook_delivery")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	if _, err := sess.Insert(d); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func GetWebhookDeliveries(query *model.GetWebhookDeliveriesQuery) ([]*model.WebhookDelivery, error) {
+	sess, err := newSession(false, "webhook_delivery")
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]*model.WebhookDelivery, 0)
+	sess.Where("webhook_delivery.webhook_id=? AND webhook_delivery.org_id=?", query.WebhookId, query.OrgId)
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	sess.Desc("webhook_delivery.id").Limit(query.Limit, (query.Page-1)*query.Limit)
+	err = sess.Find(&deliveries)
+	return deliveries, err
+}
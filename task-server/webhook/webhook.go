@@ -0,0 +1,184 @@
+// Package webhook delivers events to the webhooks that orgs subscribe to.
+// Failed deliveries are retried from memory, so deliveries that are still
+// pending when the task-server stops are lost.  Every attempt is recorded
+// in the delivery log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/codeskyblue/go-uuid"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/task-server/event"
+	"github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/task-server/sqlstore"
+)
+
+var (
+	// MaxAttempts is how many times a delivery is attempted.
+	MaxAttempts = 5
+	// RetryDelay is how long to wait before the first retry.  The delay
+	// doubles with every attempt.
+	RetryDelay = time.Second * 10
+	client     = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: &http.Transport{DialContext: dial},
+	}
+	dialer = &net.Dialer{}
+)
+
+// dial connects to a webhook, after checking that every address the host
+// resolves to is allowed by model.CheckWebhookIP.  The checked address is
+// the one dialed, so the host can not be changed to resolve to a private
+// address between the check and the connection.  Redirects are dialed the
+// same way.
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	for _, a := range addrs {
+		if err := model.CheckWebhookIP(a.IP); err != nil {
+			return nil, err
+		}
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+}
+
+// Payload is the body POSTed to webhooks.
+type Payload struct {
+	Id        string          `json:"id"`
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	OrgId     int64           `json:"orgId"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Init starts delivering events to webhooks.  Every task-server receives
+// every event, so each server only delivers the events that it published.
+func Init(timeout time.Duration) {
+	client.Timeout = timeout
+	c := make(chan event.RawEvent, 1000)
+	event.Subscribe("*", c)
+	go dispatch(c)
+}
+
+func dispatch(c chan event.RawEvent) {
+	hostname, _ := os.Hostname()
+	for e := range c {
+		if e.Source != hostname {
+			continue
+		}
+		orgId, _, _ := sqlstore.EventIds(e)
+		if orgId == 0 {
+			log.Debug("no orgId found in %s event. not sending webhooks.", e.Type)
+			continue
+		}
+		hooks, err := sqlstore.GetWebhooksForEvent(orgId, e.Type)
+		if err != nil {
+			log.Error(3, "failed to get webhooks for %s event. %s", e.Type, err)
+			continue
+		}
+		for _, h := range hooks {
+			go deliver(h, e, orgId)
+		}
+	}
+}
+
+func deliver(h *model.Webhook, e event.RawEvent, orgId int64) {
+	deliveryId := uuid.NewUUID().String()
+	body, err := json.Marshal(Payload{
+		Id:        deliveryId,
+		Type:      e.Type,
+		Timestamp: e.Timestamp,
+		OrgId:     orgId,
+		Payload:   e.Body,
+	})
+	if err != nil {
+		log.Error(3, "failed to encode webhook payload. %s", err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		d := &model.WebhookDelivery{
+			WebhookId:  h.Id,
+			OrgId:      h.OrgId,
+			DeliveryId: deliveryId,
+			EventType:  e.Type,
+			Attempt:    attempt,
+			Created:    time.Now(),
+		}
+		pre := time.Now()
+		d.StatusCode, err = send(h, deliveryId, e.Type, body)
+		d.Duration = int64(time.Since(pre) / time.Millisecond)
+		if err != nil {
+			d.Error = err.Error()
+		} else {
+			d.Success = true
+		}
+		if err := sqlstore.AddWebhookDelivery(d); err != nil {
+			log.Error(3, "failed to save webhook delivery. %s", err)
+		}
+		if d.Success {
+			return
+		}
+		if attempt >= MaxAttempts {
+			log.Error(3, "giving up delivering %s event to webhook %d after %d attempts. %s", e.Type, h.Id, attempt, err)
+			return
+		}
+		delay := RetryDelay << uint(attempt-1)
+		log.Debug("failed to deliver %s event to webhook %d. retrying in %s. %s", e.Type, h.Id, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+func send(h *model.Webhook, deliveryId, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", h.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "raintank-apps-task-server")
+	req.Header.Set("X-Raintank-Event", eventType)
+	req.Header.Set("X-Raintank-Delivery", deliveryId)
+	if h.Secret != "" {
+		req.Header.Set("X-Raintank-Signature", Sign(h.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the value of the X-Raintank-Signature header for body.
+// Receivers should compute the HMAC-SHA256 of the request body with the
+// webhook's secret and compare it to the header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raintank/raintank-apps/task-server/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSend(t *testing.T) {
+	Convey("Given a webhook on a loopback address", t, func() {
+		received := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received++
+		}))
+		Reset(func() {
+			server.Close()
+			model.AllowPrivateWebhooks = false
+		})
+		h := &model.Webhook{Url: server.URL, Events: []string{"*"}}
+
+		Convey("deliveries are refused when connecting", func() {
+			_, err := send(h, "delivery1", "test.event", []byte("{}"))
+			So(err, ShouldNotBeNil)
+			So(received, ShouldEqual, 0)
+		})
+
+		Convey("deliveries are sent when private addresses are allowed", func() {
+			model.AllowPrivateWebhooks = true
+			status, err := send(h, "delivery1", "test.event", []byte("{}"))
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(received, ShouldEqual, 1)
+		})
+	})
+}
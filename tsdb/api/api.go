@@ -2,17 +2,24 @@ package api
 
 import (
 	"github.com/Unknwon/macaron"
+	"github.com/raintank/raintank-apps/pkg/auth"
 )
 
 func InitRoutes(m *macaron.Macaron, adminKey string) {
 	m.Use(GetContextHandler())
+	m.Use(RateLimits.PreAuth(apiKey, func() string { return adminKey }))
 	m.Use(Auth(adminKey))
+	viewer := auth.RequireRole(signedInUser, auth.ViewerRoles...)
+	editor := auth.RequireRole(signedInUser, auth.EditorRoles...)
+	rateLimit := func(group string) macaron.Handler {
+		return RateLimits.Handler(group, apiKey, signedInUser)
+	}
 
 	m.Get("/", index)
-	m.Post("/metrics", Metrics)
-	m.Post("/events", Events)
-	m.Any("/graphite/*", GraphiteProxy)
-	m.Any("/elasticsearch/*", ElasticsearchProxy)
+	m.Post("/metrics", editor, rateLimit("metrics"), Metrics)
+	m.Post("/events", editor, rateLimit("events"), Events)
+	m.Any("/graphite/*", viewer, rateLimit("graphite"), GraphiteProxy)
+	m.Any("/elasticsearch/*", viewer, rateLimit("elasticsearch"), ElasticsearchProxy)
 }
 
 func index(ctx *macaron.Context) {
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Unknwon/macaron"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/raintank-apps/pkg/auth/authtest"
+)
+
+func TestRoles(t *testing.T) {
+	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, 4))
+	authtest.UseKeys()
+	m := macaron.Classic()
+	m.Use(macaron.Renderer())
+	InitRoutes(m, authtest.AdminKey)
+
+	authtest.CheckRoutes(t, m, []authtest.Route{
+		authtest.Viewer("GET", "/"),
+		authtest.Viewer("POST", "/elasticsearch/unknown"),
+		authtest.Editor("POST", "/metrics"),
+		authtest.Editor("POST", "/events"),
+	})
+}
@@ -37,7 +37,7 @@ func eventsJson(ctx *Context) {
 			ctx.JSON(400, fmt.Sprintf("unable to parse request body. %s", err))
 			return
 		}
-		if !ctx.IsAdmin {
+		if !ctx.IsAdmin || ctx.OrgOverride {
 			event.OrgId = ctx.OrgId
 		}
 
@@ -76,7 +76,7 @@ func eventsBinary(ctx *Context) {
 			ctx.JSON(500, err)
 			return
 		}
-		if !ctx.IsAdmin {
+		if !ctx.IsAdmin || ctx.OrgOverride {
 			ms.Event.OrgId = ctx.OrgId
 		}
 		u := uuid.NewUUID()
@@ -36,7 +36,8 @@ func metricsJson(ctx *Context) {
 			ctx.JSON(400, fmt.Sprintf("unable to parse request body. %s", err))
 			return
 		}
-		if !ctx.IsAdmin {
+		// admins may publish for any org, unless acting on behalf of one.
+		if !ctx.IsAdmin || ctx.OrgOverride {
 			for _, m := range metrics {
 				m.OrgId = int(ctx.OrgId)
 				m.SetId()
@@ -78,7 +79,7 @@ func metricsBinary(ctx *Context) {
 			ctx.JSON(500, err)
 			return
 		}
-		if !ctx.IsAdmin {
+		if !ctx.IsAdmin || ctx.OrgOverride {
 			for _, m := range metricData.Metrics {
 				m.OrgId = int(ctx.OrgId)
 				m.SetId()
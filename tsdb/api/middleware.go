@@ -2,11 +2,13 @@ package api
 
 import (
 	"encoding/base64"
+	"reflect"
 	"strings"
 
 	"github.com/Unknwon/macaron"
 	"github.com/grafana/grafana/pkg/log"
 	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/ratelimit"
 )
 
 type Context struct {
@@ -24,6 +26,11 @@ func GetContextHandler() macaron.Handler {
 	}
 }
 
+// signedInUser returns the user of a request, for the pkg/auth middleware.
+func signedInUser(c *macaron.Context) *auth.SignedInUser {
+	return c.GetVal(reflect.TypeOf(&Context{})).Interface().(*Context).SignedInUser
+}
+
 func RequireAdmin() macaron.Handler {
 	return func(ctx *Context) {
 		if !ctx.IsAdmin {
@@ -32,6 +39,10 @@ func RequireAdmin() macaron.Handler {
 	}
 }
 
+// RateLimits are the request rate limits of route groups.  Rate limiting is
+// disabled while it is nil.
+var RateLimits *ratelimit.Limits
+
 func Auth(adminKey string) macaron.Handler {
 	return func(ctx *Context) {
 		key, err := getApiKey(ctx)
@@ -51,10 +62,21 @@ func Auth(adminKey string) macaron.Handler {
 			ctx.JSON(500, err)
 			return
 		}
+		user, status, err := auth.ApplyOrgOverride(user, ctx.Req.Request)
+		if err != nil {
+			ctx.JSON(status, err.Error())
+			return
+		}
 		ctx.SignedInUser = user
 	}
 }
 
+// apiKey returns the API key of a request, for the pkg/ratelimit middleware.
+func apiKey(c *macaron.Context) string {
+	key, _ := getApiKey(&Context{Context: c})
+	return key
+}
+
 func getApiKey(c *Context) (string, error) {
 	header := c.Req.Header.Get("Authorization")
 	parts := strings.SplitN(header, " ", 2)
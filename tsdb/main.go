@@ -10,10 +10,13 @@ import (
 	"os/signal"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/Unknwon/macaron"
 	"github.com/grafana/grafana/pkg/log"
 	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/ratelimit"
 	"github.com/raintank/raintank-apps/tsdb/api"
 	"github.com/raintank/raintank-apps/tsdb/elasticsearch"
 	"github.com/raintank/raintank-apps/tsdb/event_publish"
@@ -49,6 +52,15 @@ var (
 	esIndex          = flag.String("es-index", "events", "elasticsearch index name")
 
 	adminKey = flag.String("admin-key", "not_very_secret_key", "Admin Secret Key")
+
+	authProviders     = flag.String("auth-providers", "grafana.net", "comma separated list of auth providers to check API keys against, in order. grafana.net|file")
+	authGrafanaNetUrl = flag.String("auth-grafana-net-url", auth.DefaultGrafanaNetUrl, "grafana.net api-keys check URL")
+	authKeyFile       = flag.String("auth-key-file", "", "JSON file of hashed API keys for the file auth provider")
+	authCacheSize     = flag.Int("auth-cache-size", 10000, "maximum number of API keys to cache")
+	authCacheStaleTtl = flag.Duration("auth-cache-stale-ttl", time.Hour, "how long to keep accepting expired API keys while they can not be revalidated. 0 disables")
+
+	rateLimitKey = flag.String("rate-limit-key", "", "request rate limits per API key, as group=rate:burst,... with rate in requests per second. the \"default\" group applies to unlisted groups and \"preauth\" limits requests per remote IP before they are authenticated")
+	rateLimitOrg = flag.String("rate-limit-org", "", "request rate limits per org, as group=rate:burst,...")
 )
 
 func main() {
@@ -101,9 +113,23 @@ func main() {
 	metric_publish.Init(stats, *metricTopic, *nsqdAddr, *publishMetrics)
 	event_publish.Init(stats, *eventTopic, *nsqdAddr, *publishEvents)
 
+	auth.InitMetrics(stats)
+	auth.CacheSize = *authCacheSize
+	auth.CacheStaleTTL = *authCacheStaleTtl
+	authProvider, err := auth.NewProvider(*authProviders, *authGrafanaNetUrl, *authKeyFile, nil)
+	if err != nil {
+		log.Fatal(4, "failed to initialize auth providers. %s", err)
+	}
+	auth.SetProvider(authProvider)
+
 	m := macaron.Classic()
 	m.Use(macaron.Renderer())
 
+	rateLimits, err := ratelimit.New(*rateLimitKey, *rateLimitOrg, stats)
+	if err != nil {
+		log.Fatal(4, "invalid rate limits. %s", err)
+	}
+	api.RateLimits = rateLimits
 	api.InitRoutes(m, *adminKey)
 
 	if err := graphite.Init(*graphiteUrl, *worldpingUrl); err != nil {
@@ -4,12 +4,18 @@ import (
 	"github.com/Unknwon/macaron"
 	"github.com/macaron-contrib/binding"
 	"github.com/raintank/met"
+	"github.com/raintank/raintank-apps/pkg/auth"
 	"github.com/raintank/raintank-apps/worldping-api/model"
 )
 
 func Init(m *macaron.Macaron, adminKey string, metrics met.Backend) {
 	m.Use(GetContextHandler())
 	bind := binding.Bind
+	viewer := auth.RequireRole(signedInUser, auth.ViewerRoles...)
+	editor := auth.RequireRole(signedInUser, auth.EditorRoles...)
+	rateLimit := func(group string) macaron.Handler {
+		return RateLimits.Handler(group, apiKey, signedInUser)
+	}
 
 	InitEndpointMetrics(metrics)
 	//InitProbeMetrics(metrics)
@@ -19,22 +25,22 @@ func Init(m *macaron.Macaron, adminKey string, metrics met.Backend) {
 		m.Group("/endpoints", func() {
 			m.Combo("/").
 				Get(bind(model.GetEndpointsQuery{}), GetEndpoints).
-				Post(bind(model.EndpointDTO{}), AddEndpoint).
-				Put(bind(model.EndpointDTO{}), UpdateEndpoint)
+				Post(editor, bind(model.EndpointDTO{}), AddEndpoint).
+				Put(editor, bind(model.EndpointDTO{}), UpdateEndpoint)
 			m.Get("/discover", bind(model.DiscoverEndpointCmd{}), DiscoverEndpoint)
 			m.Get("/:id", GetEndpointById)
 
-			m.Delete("/:id", DeleteEndpoint)
-		})
+			m.Delete("/:id", editor, DeleteEndpoint)
+		}, rateLimit("endpoints"))
 
 		m.Group("/probes", func() {
 			m.Combo("/").
 				Get(bind(model.GetProbesQuery{}), GetProbes).
-				Post(bind(model.ProbeDTO{}), AddProbe).
-				Put(bind(model.ProbeDTO{}), UpdateProbe)
+				Post(editor, bind(model.ProbeDTO{}), AddProbe).
+				Put(editor, bind(model.ProbeDTO{}), UpdateProbe)
 			m.Get("/:id", GetProbeById)
-			m.Delete("/:id", DeleteProbe)
-		})
+			m.Delete("/:id", editor, DeleteProbe)
+		}, rateLimit("probes"))
 
 		/*
 			m.Group("/admin", func() {
@@ -45,7 +51,7 @@ func Init(m *macaron.Macaron, adminKey string, metrics met.Backend) {
 
 			}, RequireAdmin())
 		*/
-	}, Auth(adminKey))
+	}, RateLimits.PreAuth(apiKey, func() string { return adminKey }), Auth(adminKey), viewer)
 }
 
 func index(ctx *macaron.Context) {
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Unknwon/macaron"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth/authtest"
+	"github.com/raintank/raintank-apps/worldping-api/sqlstore"
+)
+
+func TestRoles(t *testing.T) {
+	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, 4))
+	stats, err := helper.New(false, "localhost:8125", "standard", "worldping-api", "default")
+	if err != nil {
+		t.Fatalf("failed to initialize statsd. %s", err)
+	}
+	sqlstore.NewEngine(":memory:")
+	authtest.UseKeys()
+	m := macaron.Classic()
+	m.Use(macaron.Renderer())
+	Init(m, authtest.AdminKey, stats)
+
+	authtest.CheckRoutes(t, m, []authtest.Route{
+		authtest.Viewer("GET", "/api/endpoints"),
+		authtest.Viewer("GET", "/api/probes"),
+		authtest.Editor("POST", "/api/endpoints"),
+		authtest.Editor("PUT", "/api/endpoints"),
+		authtest.Editor("DELETE", "/api/endpoints/1"),
+		authtest.Editor("POST", "/api/probes"),
+		authtest.Editor("PUT", "/api/probes"),
+		authtest.Editor("DELETE", "/api/probes/1"),
+	})
+}
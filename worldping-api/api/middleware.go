@@ -1,10 +1,12 @@
 package api
 
 import (
+	"reflect"
 	"strings"
 
 	"github.com/Unknwon/macaron"
 	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/ratelimit"
 )
 
 type Context struct {
@@ -22,6 +24,11 @@ func GetContextHandler() macaron.Handler {
 	}
 }
 
+// signedInUser returns the user of a request, for the pkg/auth middleware.
+func signedInUser(c *macaron.Context) *auth.SignedInUser {
+	return c.GetVal(reflect.TypeOf(&Context{})).Interface().(*Context).SignedInUser
+}
+
 func RequireAdmin() macaron.Handler {
 	return func(ctx *Context) {
 		if !ctx.IsAdmin {
@@ -30,6 +37,10 @@ func RequireAdmin() macaron.Handler {
 	}
 }
 
+// RateLimits are the request rate limits of route groups.  Rate limiting is
+// disabled while it is nil.
+var RateLimits *ratelimit.Limits
+
 func Auth(adminKey string) macaron.Handler {
 	return func(ctx *Context) {
 		key := getApiKey(ctx)
@@ -46,10 +57,20 @@ func Auth(adminKey string) macaron.Handler {
 			ctx.JSON(500, err)
 			return
 		}
+		user, status, err := auth.ApplyOrgOverride(user, ctx.Req.Request)
+		if err != nil {
+			ctx.JSON(status, err.Error())
+			return
+		}
 		ctx.SignedInUser = user
 	}
 }
 
+// apiKey returns the API key of a request, for the pkg/ratelimit middleware.
+func apiKey(c *macaron.Context) string {
+	return getApiKey(&Context{Context: c})
+}
+
 func getApiKey(c *Context) string {
 	header := c.Req.Header.Get("Authorization")
 	parts := strings.SplitN(header, " ", 2)
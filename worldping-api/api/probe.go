@@ -21,7 +21,7 @@ func GetProbes(ctx *Context, query model.GetProbesQuery) {
 		Page:    query.Page,
 	}
 
-	agents, err := task_client.Client.GetAgents(&pQuery)
+	agents, err := task_client.ForOrg(ctx.OrgId).GetAgentsContext(ctx.Req.Context(), &pQuery)
 	if err != nil {
 		log.Error(3, "api.GetProbes failed. %s", err)
 		switch err.(type) {
@@ -48,7 +48,7 @@ func AddProbe(ctx *Context, p model.ProbeDTO) {
 		Online:        p.Online,
 		OnlineChange:  p.OnlineChange,
 	}
-	err := task_client.Client.AddAgent(agent)
+	err := task_client.ForOrg(ctx.OrgId).AddAgentContext(ctx.Req.Context(), agent)
 	if err != nil {
 		log.Error(3, "api.AddProbe failed. %s", err)
 		switch err.(type) {
@@ -76,7 +76,7 @@ func UpdateProbe(ctx *Context, p model.ProbeDTO) {
 		Online:        p.Online,
 		OnlineChange:  p.OnlineChange,
 	}
-	err := task_client.Client.UpdateAgent(agent)
+	err := task_client.ForOrg(ctx.OrgId).UpdateAgentContext(ctx.Req.Context(), agent)
 	if err != nil {
 		log.Error(3, "api.UpdateProbe failed. %s", err)
 		switch err.(type) {
@@ -94,7 +94,7 @@ func UpdateProbe(ctx *Context, p model.ProbeDTO) {
 
 func GetProbeById(ctx *Context) {
 	id := ctx.ParamsInt64(":id")
-	agent, err := task_client.Client.GetAgentById(id)
+	agent, err := task_client.ForOrg(ctx.OrgId).GetAgentByIdContext(ctx.Req.Context(), id)
 	if err != nil {
 		log.Error(3, "api.GetProbeById failed. %s", err)
 		switch err.(type) {
@@ -111,7 +111,7 @@ func GetProbeById(ctx *Context) {
 
 func DeleteProbe(ctx *Context) {
 	id := ctx.ParamsInt64(":id")
-	err := task_client.Client.DeleteAgent(&sModel.AgentDTO{Id: id})
+	err := task_client.ForOrg(ctx.OrgId).DeleteAgentContext(ctx.Req.Context(), &sModel.AgentDTO{Id: id})
 	if err != nil {
 		log.Error(3, "api.DeleteProbe failed. %s", err)
 		switch err.(type) {
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Unknwon/macaron"
+	"github.com/grafana/grafana/pkg/log"
+	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/task-server/client"
+	"github.com/raintank/raintank-apps/task-server/client/clienttest"
+	sModel "github.com/raintank/raintank-apps/task-server/model"
+	"github.com/raintank/raintank-apps/worldping-api/model"
+	"github.com/raintank/raintank-apps/worldping-api/sqlstore"
+	"github.com/raintank/raintank-apps/worldping-api/task_client"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// probeRequest sends a request to h using key, and decodes the response
+// into v.
+func probeRequest(h http.Handler, key, method, url string, body, v interface{}) int {
+	b, err := json.Marshal(body)
+	So(err, ShouldBeNil)
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	So(err, ShouldBeNil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if v != nil && resp.Code == 200 {
+		So(json.Unmarshal(resp.Body.Bytes(), v), ShouldBeNil)
+	}
+	return resp.Code
+}
+
+func TestProbeOrgs(t *testing.T) {
+	log.NewLogger(0, "console", fmt.Sprintf(`{"level": %d, "formatting":true}`, 4))
+	stats, err := helper.New(false, "localhost:8125", "standard", "worldping-api", "default")
+	if err != nil {
+		t.Fatalf("failed to initialize statsd. %s", err)
+	}
+	sqlstore.NewEngine(":memory:")
+	m := macaron.Classic()
+	m.Use(macaron.Renderer())
+	Init(m, "changeme", stats)
+
+	Convey("Given users in two orgs", t, func() {
+		auth.SetProvider(auth.NewLocalProvider(auth.KeyFile{
+			auth.HashKey("org2-key"): {Name: "org2", OrgId: 2, Role: auth.ROLE_EDITOR},
+			auth.HashKey("org3-key"): {Name: "org3", OrgId: 3, Role: auth.ROLE_EDITOR},
+		}))
+		server := clienttest.NewServer()
+		Reset(server.Close)
+		server.AddApiKey("task-server-admin", 1, true)
+		task_client.Client, err = client.New(server.URL, "task-server-admin", false)
+		So(err, ShouldBeNil)
+
+		Convey("probes are added to the org of the user", func() {
+			for _, key := range []string{"org2-key", "org3-key"} {
+				So(probeRequest(m, key, "POST", "/api/probes", model.ProbeDTO{Name: key + "-probe", Enabled: true}, nil), ShouldEqual, 200)
+			}
+			for orgId, key := range map[int64]string{2: "org2-key", 3: "org3-key"} {
+				probes := make([]*sModel.AgentDTO, 0)
+				So(probeRequest(m, key, "GET", "/api/probes", nil, &probes), ShouldEqual, 200)
+				So(probes, ShouldHaveLength, 1)
+				So(probes[0].Name, ShouldEqual, key+"-probe")
+
+				agents, err := task_client.Client.ForOrg(orgId).GetAgents(&sModel.GetAgentsQuery{})
+				So(err, ShouldBeNil)
+				So(agents, ShouldHaveLength, 1)
+				So(agents[0].Name, ShouldEqual, key+"-probe")
+			}
+		})
+	})
+}
@@ -8,10 +8,14 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/Unknwon/macaron"
 	"github.com/grafana/grafana/pkg/log"
 	"github.com/raintank/met/helper"
+	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/raintank-apps/pkg/ratelimit"
+	"github.com/raintank/raintank-apps/task-server/client"
 	"github.com/raintank/raintank-apps/worldping-api/api"
 	"github.com/raintank/raintank-apps/worldping-api/sqlstore"
 	"github.com/raintank/raintank-apps/worldping-api/task_client"
@@ -28,13 +32,24 @@ var (
 	addr   = flag.String("addr", "localhost:80", "http service address")
 	dbPath = flag.String("db-path", "/tmp/worldping-api.sqlite", "sqlite DB path")
 
-	taskServer = flag.String("task-server-addr", "http://localhost:80", "Task server address")
+	taskServer        = flag.String("task-server-addr", "http://localhost:80", "Task server address")
+	taskServerTimeout = flag.Duration("task-server-timeout", client.DefaultTimeout, "timeout for requests to the task server")
+	taskServerRetries = flag.Int("task-server-retries", client.DefaultRetries, "how many times to retry failed task server requests. requests that create objects are never retried")
 
 	statsEnabled = flag.Bool("stats-enabled", false, "enable statsd metrics")
 	statsdAddr   = flag.String("statsd-addr", "localhost:8125", "statsd address")
 	statsdType   = flag.String("statsd-type", "standard", "statsd type: standard or datadog")
 
 	adminKey = flag.String("admin-key", "not_very_secret_key", "Admin Secret Key")
+
+	authProviders     = flag.String("auth-providers", "grafana.net", "comma separated list of auth providers to check API keys against, in order. grafana.net|file|db")
+	authGrafanaNetUrl = flag.String("auth-grafana-net-url", auth.DefaultGrafanaNetUrl, "grafana.net api-keys check URL")
+	authKeyFile       = flag.String("auth-key-file", "", "JSON file of hashed API keys for the file auth provider")
+	authCacheSize     = flag.Int("auth-cache-size", 10000, "maximum number of API keys to cache")
+	authCacheStaleTtl = flag.Duration("auth-cache-stale-ttl", time.Hour, "how long to keep accepting expired API keys while they can not be revalidated. 0 disables")
+
+	rateLimitKey = flag.String("rate-limit-key", "", "request rate limits per API key, as group=rate:burst,... with rate in requests per second. the \"default\" group applies to unlisted groups and \"preauth\" limits requests per remote IP before they are authenticated")
+	rateLimitOrg = flag.String("rate-limit-org", "", "request rate limits per org, as group=rate:burst,...")
 )
 
 func init() {
@@ -82,8 +97,17 @@ func main() {
 	// initialize DB
 	sqlstore.NewEngine(*dbPath)
 
+	auth.InitMetrics(stats)
+	auth.CacheSize = *authCacheSize
+	auth.CacheStaleTTL = *authCacheStaleTtl
+	authProvider, err := auth.NewProvider(*authProviders, *authGrafanaNetUrl, *authKeyFile, sqlstore.ApiKeyStore{})
+	if err != nil {
+		log.Fatal(4, "failed to initialize auth providers. %s", err)
+	}
+	auth.SetProvider(authProvider)
+
 	// init taskServer client
-	if err := task_client.Init(*taskServer, *adminKey, false); err != nil {
+	if err := task_client.Init(*taskServer, *adminKey, false, *taskServerTimeout, *taskServerRetries); err != nil {
 		log.Fatal(4, "Failed in init task client. %s", err)
 	}
 
@@ -91,6 +115,11 @@ func main() {
 	//m.Use(macaron.Logger())
 	m.Use(macaron.Renderer())
 
+	rateLimits, err := ratelimit.New(*rateLimitKey, *rateLimitOrg, stats)
+	if err != nil {
+		log.Fatal(4, "invalid rate limits. %s", err)
+	}
+	api.RateLimits = rateLimits
 	api.Init(m, *adminKey, stats)
 
 	interrupt := make(chan os.Signal, 1)
@@ -1,6 +1,9 @@
 package migrations
 
-import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/raintank/raintank-apps/pkg/auth/keystore"
+)
 
 // --- Migration Guide line ---
 // 1. Never change a migration that is committed and pushed to master
@@ -13,5 +16,6 @@ func AddMigrations(mg *Migrator) {
 	addEndpointMigrations(mg)
 	addCheckMigrations(mg)
 	addEndpointTagMigrations(mg)
+	keystore.AddMigrations(mg)
 
 }
@@ -1,14 +1,27 @@
 package task_client
 
 import (
+	"time"
+
 	"github.com/grafana/grafana/pkg/log"
 	"github.com/raintank/raintank-apps/task-server/client"
 )
 
 var Client *client.Client
 
-func Init(addr, apiKey string, insecure bool) (err error) {
+func Init(addr, apiKey string, insecure bool, timeout time.Duration, retries int) (err error) {
 	log.Info("setting taskServer address to: %s", addr)
 	Client, err = client.New(addr, apiKey, insecure)
-	return err
+	if err != nil {
+		return err
+	}
+	Client.SetTimeout(timeout)
+	Client.Retries = retries
+	return nil
+}
+
+// ForOrg returns Client acting on behalf of orgId, so that probes are
+// managed in the org of the user rather than the org of the admin key.
+func ForOrg(orgId int64) *client.Client {
+	return Client.ForOrg(orgId)
 }